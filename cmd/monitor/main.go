@@ -2,15 +2,21 @@ package main
 
 import (
 	"context"
+	"errors"
 	"log"
+	"net/http"
 	"os/signal"
 	"regexp"
+	"strings"
 	"syscall"
 	"time"
 
+	"monitor-imap-webhook/internal/analysis"
 	"monitor-imap-webhook/internal/config"
 	"monitor-imap-webhook/internal/imapclient"
 	"monitor-imap-webhook/internal/parser"
+	"monitor-imap-webhook/internal/scanner"
+	"monitor-imap-webhook/internal/storage"
 	"monitor-imap-webhook/internal/webhook"
 )
 
@@ -24,9 +30,58 @@ func main() {
 	}
 	log.Printf("启动: host=%s port=%d mailbox=%s webhook=%s", cfg.IMAPHost, cfg.IMAPPort, cfg.Mailbox, cfg.WebhookURL)
 
+	if err := parser.LoadSecurityKeys(cfg); err != nil {
+		log.Fatalf("S/MIME / PGP 密钥加载失败: %v", err)
+	}
+
 	cl := imapclient.New(cfg)
 	events := make(chan imapclient.Event, 50)
 	sender := webhook.NewSender(cfg)
+	var downloadSrv *http.Server
+	if cfg.AttachmentDelivery == "store" {
+		st, err := newAttachmentStore(cfg)
+		if err != nil {
+			log.Fatalf("附件存储初始化失败: %v", err)
+		}
+		signer := storage.NewSigner(cfg.DownloadSecret, cfg.DownloadBaseURL, cfg.DownloadURLTTL)
+		sender.UseStore(st, signer)
+		downloadSrv = &http.Server{Addr: cfg.DownloadListen, Handler: storage.Handler(st, signer), ReadHeaderTimeout: 10 * time.Second}
+		go func() {
+			log.Printf("附件下载服务: listen=%s base=%s backend=%s", cfg.DownloadListen, cfg.DownloadBaseURL, cfg.StorageBackend)
+			if err := downloadSrv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Printf("附件下载服务退出: %v", err)
+			}
+		}()
+		go storage.RunJanitor(ctx, st, cfg.StorageRetention, time.Hour)
+	}
+
+	var analyzer *analysis.Analyzer
+	if cfg.RiskAnalysis {
+		if analyzer, err = analysis.New(cfg); err != nil {
+			log.Fatalf("风险分析初始化失败: %v", err)
+		}
+	}
+
+	skipAuto := make(map[string]bool)
+	for _, kind := range strings.Split(cfg.AutoMailSkip, ",") {
+		if kind = strings.TrimSpace(kind); kind != "" {
+			skipAuto[kind] = true
+		}
+	}
+	limiter := analysis.NewRateLimiter(cfg.SenderRateLimit, cfg.SenderRateWindow)
+
+	var av scanner.Scanner
+	if cfg.ClamdAddress != "" {
+		clamd, err := scanner.NewClamd(cfg.ClamdAddress, cfg.ClamdTimeout)
+		if err != nil {
+			log.Fatalf("clamd 配置错误: %v", err)
+		}
+		if err := clamd.Ping(ctx); err != nil { // 启动时不可用不致命；strip / quarantine 下扫描失败的附件不投递内容
+			log.Printf("clamd 暂不可用: %v", err)
+		}
+		log.Printf("附件扫描: clamd=%s policy=%s", cfg.ClamdAddress, cfg.ScanPolicy)
+		av = clamd
+	}
 
 	go func() {
 		if err := cl.IdleLoop(ctx, events); err != nil && ctx.Err() == nil {
@@ -58,12 +113,66 @@ func main() {
 				cl.EndProcess()
 				continue
 			}
-			base := webhook.Payload{UID: msg.UID, Subject: msg.Subject, From: msg.From, Date: msg.Date, Body: msg.Body, Mailbox: cfg.Mailbox, Timestamp: time.Now().Unix()}
+			if cfg.RequireAuth && (msg.Auth == nil || !msg.Auth.Authenticated) {
+				log.Printf("未通过认证, 丢弃 UID=%d 发件人=%s", ev.UID, msg.From)
+				cl.EndProcess()
+				continue
+			}
+			if a := msg.AutoMail; a != nil && (skipAuto[a.Kind] || skipAuto["all"]) {
+				log.Printf("跳过自动邮件 UID=%d 类型=%s 原因=%s", ev.UID, a.Kind, strings.Join(a.Reasons, "; "))
+				cl.EndProcess()
+				continue
+			}
+			if limiter != nil && msg.FromAddress != nil {
+				if ok, dropped := limiter.Allow(msg.FromAddress.Address, time.Now()); !ok {
+					if dropped == 1 || cfg.Debug { // 每轮风暴只记录第一封
+						log.Printf("发件人超过频率限制, 跳过 UID=%d 发件人=%s 本轮已跳过=%d", ev.UID, msg.FromAddress.Address, dropped)
+					}
+					cl.EndProcess()
+					continue
+				}
+			}
+			base := webhook.Payload{UID: msg.UID, Subject: msg.Subject, From: msg.From, Date: msg.Date, Body: msg.Body, Mailbox: cfg.Mailbox, Timestamp: time.Now().Unix(),
+				BodyCharset: msg.BodyCharset, CharsetDetected: msg.CharsetDetected,
+				FromAddress: msg.FromAddress, To: msg.To, Cc: msg.Cc, ReplyTo: msg.ReplyTo, Sender: msg.Sender,
+				MessageID: msg.MessageID, InReplyTo: msg.InReplyTo, References: msg.References,
+				ListID: msg.ListID, ReturnPath: msg.ReturnPath, Size: msg.Size, Headers: msg.Headers,
+				ThreadID: msg.ThreadID, ThreadSource: msg.ThreadSource, IsReply: msg.IsReply, IsForward: msg.IsForward,
+				Calendar: msg.Calendar, Bounce: msg.Bounce, AutoMail: msg.AutoMail, Category: msg.Category, Auth: msg.Auth, Security: msg.Security,
+				Unsubscribe: msg.Unsubscribe, Extracted: msg.Extracted,
+				StructuredData: msg.StructuredData, Forwarded: msg.Forwarded}
+			if cfg.ExtractLinks {
+				base.Links = msg.Links
+			}
+			if analyzer != nil {
+				base.Risk = analyzer.Analyze(msg)
+			}
+			if !msg.InternalDate.IsZero() {
+				base.InternalDate = msg.InternalDate.Format(time.RFC3339)
+			}
 			if msg.HasAttachments {
 				base.HasAttachments = true
 				base.Attachments = msg.AttachmentNames
 				base.AttachmentCount = len(msg.AttachmentNames)
+				base.AttachmentsDetail = webhook.NewAttachmentDetails(msg.Attachments)
 			}
+			if av != nil && len(base.AttachmentsDetail) > 0 {
+				base.Scan = webhook.ScanAttachments(ctx, av, base.AttachmentsDetail, cfg.ScanPolicy)
+				if len(base.Scan.Infected) > 0 {
+					log.Printf("发现感染附件 UID=%d: %v", ev.UID, base.Scan.Infected)
+					if cfg.ScanPolicy == "quarantine" {
+						err := cl.MoveUID(ctx, ev.UID, cfg.QuarantineMailbox)
+						if err == nil {
+							log.Printf("已隔离 UID=%d 到 %s, 不发送 Webhook", ev.UID, cfg.QuarantineMailbox)
+							cl.EndProcess()
+							continue
+						}
+						log.Printf("隔离失败 UID=%d, 改为剥离附件后发送: %v", ev.UID, err)
+					}
+				}
+			}
+			base.BodyMarkdown = msg.BodyMarkdown
+			base.BodyNew = msg.BodyNew
 			if cfg.IncludeRawHTML && msg.RawHTML != "" {
 				base.RawHTML = msg.RawHTML
 			}
@@ -86,9 +195,33 @@ func main() {
 	<-ctx.Done()
 	log.Println("shutting down")
 	_ = cl.Close()
+	if analyzer != nil {
+		if err := analyzer.Close(); err != nil {
+			log.Printf("sender history save: %v", err)
+		}
+	}
+	if downloadSrv != nil {
+		shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), time.Second)
+		_ = downloadSrv.Shutdown(shutdownCtx)
+		cancelShutdown()
+	}
 	time.Sleep(200 * time.Millisecond)
 }
 
+// newAttachmentStore 按 storage_backend 创建附件存储
+func newAttachmentStore(cfg *config.Config) (storage.Store, error) {
+	if cfg.StorageBackend == "s3" {
+		return storage.NewS3Store(storage.S3Options{
+			Endpoint:  cfg.S3Endpoint,
+			Bucket:    cfg.S3Bucket,
+			Region:    cfg.S3Region,
+			AccessKey: cfg.S3AccessKey,
+			SecretKey: cfg.S3SecretKey,
+		})
+	}
+	return storage.NewLocalStore(cfg.StorageDir)
+}
+
 // getRawClient: 暂时通过类型断言访问内部字段（可以改为导出方法）。
 // 为避免暴露内部实现，后续可以在 imapclient 包添加一个 ExportUnderlying() 方法。
 // 这里先写一个占位函数，需要你在 imapclient 包中补一个方法。
@@ -3,13 +3,21 @@ module monitor-imap-webhook
 go 1.22
 
 require (
+	github.com/ProtonMail/go-crypto v1.1.6
+	github.com/andybalholm/cascadia v1.3.2
 	github.com/emersion/go-imap v1.2.1
 	github.com/emersion/go-imap-idle v0.0.0-20210907174914-db2568431445
 	github.com/emersion/go-message v0.18.2
+	github.com/emersion/go-msgauth v0.6.8
+	go.mozilla.org/pkcs7 v0.9.0
+	golang.org/x/net v0.33.0
+	golang.org/x/text v0.21.0
 	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
+	github.com/cloudflare/circl v1.3.7 // indirect
 	github.com/emersion/go-sasl v0.0.0-20200509203442-7bfe0ed36a21 // indirect
-	golang.org/x/text v0.14.0 // indirect
+	golang.org/x/crypto v0.31.0 // indirect
+	golang.org/x/sys v0.28.0 // indirect
 )
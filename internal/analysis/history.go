@@ -0,0 +1,146 @@
+package analysis
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// historyFlushDelay 新发件人写入后延迟落盘的时间：邮件风暴中的多次写入合并为一次
+const historyFlushDelay = 5 * time.Second
+
+// History 已见发件人（小写地址 → 首次出现的 Unix 时间）；配置文件路径时持久化。
+// 条数超过 max 时淘汰首次出现最早的记录，超过 ttl 的记录视为未见过。
+type History struct {
+	mu    sync.Mutex
+	path  string
+	max   int
+	ttl   time.Duration
+	seen  map[string]int64
+	dirty bool
+	timer *time.Timer
+}
+
+// OpenHistory 加载记录文件；path 为空时只在内存中记录。max / ttl 为 0 表示不限制。
+func OpenHistory(path string, max int, ttl time.Duration) (*History, error) {
+	h := &History{path: path, max: max, ttl: ttl, seen: make(map[string]int64)}
+	if path == "" {
+		return h, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return h, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &h.seen); err != nil {
+			return nil, err
+		}
+	}
+	h.prune(time.Now())
+	return h, nil
+}
+
+// Observe 记录发件人；首次出现（或记录已过期）时返回 true
+func (h *History) Observe(addr string) bool {
+	addr = strings.ToLower(strings.TrimSpace(addr))
+	if addr == "" {
+		return false
+	}
+	now := time.Now()
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if first, ok := h.seen[addr]; ok && !h.expired(first, now) {
+		return false
+	}
+	h.seen[addr] = now.Unix()
+	if h.max > 0 && len(h.seen) > h.max {
+		h.prune(now)
+	}
+	if h.path != "" {
+		h.dirty = true
+		if h.timer == nil {
+			h.timer = time.AfterFunc(historyFlushDelay, func() {
+				if err := h.Flush(); err != nil {
+					log.Printf("sender history save: %v", err)
+				}
+			})
+		}
+	}
+	return true
+}
+
+// Flush 将未保存的记录写入文件
+func (h *History) Flush() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.timer != nil {
+		h.timer.Stop()
+		h.timer = nil
+	}
+	if !h.dirty {
+		return nil
+	}
+	h.prune(time.Now())
+	if err := h.save(); err != nil {
+		return err
+	}
+	h.dirty = false
+	return nil
+}
+
+func (h *History) expired(first int64, now time.Time) bool {
+	return h.ttl > 0 && now.Sub(time.Unix(first, 0)) > h.ttl
+}
+
+// prune 删除过期记录；超过 max 时按首次出现时间淘汰最早的记录，
+// 一次淘汰到 max 的 90%（至少保留 1 条），避免每个新发件人都触发一次排序
+func (h *History) prune(now time.Time) {
+	for addr, first := range h.seen {
+		if h.expired(first, now) {
+			delete(h.seen, addr)
+		}
+	}
+	if h.max <= 0 || len(h.seen) <= h.max {
+		return
+	}
+	addrs := make([]string, 0, len(h.seen))
+	for addr := range h.seen {
+		addrs = append(addrs, addr)
+	}
+	sort.Slice(addrs, func(i, j int) bool { return h.seen[addrs[i]] < h.seen[addrs[j]] })
+	for _, addr := range addrs[:len(addrs)-(h.max-h.max/10)] {
+		delete(h.seen, addr)
+	}
+}
+
+// save 先写临时文件再重命名，避免中途退出留下半个文件
+func (h *History) save() error {
+	data, err := json.Marshal(h.seen)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(h.path), ".sender-history-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), h.path)
+}
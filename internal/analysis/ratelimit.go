@@ -0,0 +1,53 @@
+package analysis
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// RateLimiter 按发件人的滑动窗口计数，用于抑制自动回复互相触发等邮件风暴
+type RateLimiter struct {
+	mu     sync.Mutex
+	limit  int
+	window time.Duration
+	hits   map[string][]time.Time // 窗口内已放行的时间
+	drops  map[string]int         // 本轮风暴中已丢弃的数量
+}
+
+// NewRateLimiter limit 为窗口内最多放行的邮件数；limit <= 0 时返回 nil（不限制）
+func NewRateLimiter(limit int, window time.Duration) *RateLimiter {
+	if limit <= 0 || window <= 0 {
+		return nil
+	}
+	return &RateLimiter{limit: limit, window: window, hits: make(map[string][]time.Time), drops: make(map[string]int)}
+}
+
+// Allow 判断发件人 key 此刻是否放行；不放行时 dropped 为本轮风暴中已丢弃的数量（含本封）
+func (l *RateLimiter) Allow(key string, now time.Time) (ok bool, dropped int) {
+	key = strings.ToLower(strings.TrimSpace(key))
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.hits) > 1024 { // 定期清理已过期的发件人
+		for k, ts := range l.hits {
+			if len(ts) == 0 || now.Sub(ts[len(ts)-1]) >= l.window {
+				delete(l.hits, k)
+				delete(l.drops, k)
+			}
+		}
+	}
+	ts := l.hits[key]
+	i := 0
+	for i < len(ts) && now.Sub(ts[i]) >= l.window {
+		i++
+	}
+	ts = ts[i:]
+	if len(ts) >= l.limit {
+		l.hits[key] = ts
+		l.drops[key]++
+		return false, l.drops[key]
+	}
+	l.hits[key] = append(ts, now)
+	delete(l.drops, key)
+	return true, 0
+}
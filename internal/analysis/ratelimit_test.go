@@ -0,0 +1,33 @@
+package analysis
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	if NewRateLimiter(0, time.Minute) != nil {
+		t.Fatal("limit 0 should disable")
+	}
+	l := NewRateLimiter(2, time.Minute)
+	now := time.Unix(1700000000, 0)
+	for i, want := range []bool{true, true, false, false} {
+		ok, dropped := l.Allow("Bot@Example.com", now.Add(time.Duration(i)*time.Second))
+		if ok != want {
+			t.Fatalf("#%d ok=%v", i, ok)
+		}
+		if !ok && dropped != i-1 {
+			t.Fatalf("#%d dropped=%d", i, dropped)
+		}
+	}
+	if ok, _ := l.Allow("alice@example.com", now); !ok {
+		t.Fatal("other sender should pass")
+	}
+	// 窗口滑过首封后恢复放行
+	if ok, dropped := l.Allow("bot@example.com", now.Add(time.Minute)); !ok || dropped != 0 {
+		t.Fatalf("after window ok=%v dropped=%d", ok, dropped)
+	}
+	if ok, _ := l.Allow("bot@example.com", now.Add(time.Minute+500*time.Millisecond)); ok {
+		t.Fatal("second message in new window should still be limited by the 1s hit")
+	}
+}
@@ -0,0 +1,357 @@
+// Package analysis 在解析完成后对邮件做钓鱼 / 仿冒启发式分析，输出风险分与原因。
+package analysis
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/idna"
+	"golang.org/x/net/publicsuffix"
+
+	"monitor-imap-webhook/internal/config"
+	"monitor-imap-webhook/internal/parser"
+)
+
+// 风险原因代码
+const (
+	ReasonDisplayName = "display_name_mismatch" // 显示名中的地址 / 品牌与实际发件域不符
+	ReasonLookalike   = "lookalike_domain"      // 域名仿冒受保护域名
+	ReasonPunycode    = "punycode_domain"       // 国际化域名（xn--），可能是同形字仿冒
+	ReasonLinkText    = "link_text_mismatch"    // 链接文字显示的域名与实际目标不同
+	ReasonReplyTo     = "reply_to_mismatch"     // Reply-To 与 From 不在同一域
+	ReasonFirstSender = "first_time_sender"     // 首次出现的发件人
+)
+
+// weights 各原因的分值（同一原因只计一次）
+var weights = map[string]int{
+	ReasonDisplayName: 30,
+	ReasonLookalike:   40,
+	ReasonPunycode:    20,
+	ReasonLinkText:    25,
+	ReasonReplyTo:     20,
+	ReasonFirstSender: 10,
+}
+
+// maxDetails 同一原因最多列出的明细条数
+const maxDetails = 3
+
+// Risk 风险评估结果
+type Risk struct {
+	Score   int      `json:"score"`             // 0-100
+	Level   string   `json:"level"`             // low | medium | high
+	Reasons []Reason `json:"reasons,omitempty"` // 命中的规则（按分值从高到低）
+}
+
+// Reason 一条命中的规则
+type Reason struct {
+	Code   string `json:"code"`
+	Score  int    `json:"score"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// defaultProtected 内置的常被仿冒域名
+var defaultProtected = []string{
+	"paypal.com", "apple.com", "icloud.com", "microsoft.com", "outlook.com",
+	"google.com", "gmail.com", "amazon.com", "facebook.com", "linkedin.com", "dropbox.com", "docusign.com",
+	"netflix.com", "github.com", "alipay.com", "taobao.com", "tmall.com", "jd.com", "qq.com", "163.com",
+	"126.com", "aliyun.com", "wechat.com",
+}
+
+// Analyzer 风险分析器；首次发件人依赖 History
+type Analyzer struct {
+	protected []protectedDomain
+	history   *History
+}
+
+type protectedDomain struct {
+	domain string // 可注册域名，如 paypal.com
+	label  string // 品牌标签，如 paypal
+}
+
+// New 根据配置创建分析器
+func New(cfg *config.Config) (*Analyzer, error) {
+	h, err := OpenHistory(cfg.SenderHistoryFile, cfg.SenderHistoryMax, cfg.SenderHistoryTTL)
+	if err != nil {
+		return nil, err
+	}
+	a := &Analyzer{history: h}
+	seen := map[string]bool{}
+	domains := append([]string{}, defaultProtected...)
+	for _, d := range strings.Split(cfg.RiskProtectedDomains, ",") {
+		domains = append(domains, d)
+	}
+	for _, d := range domains {
+		reg := registrable(d)
+		if reg == "" || seen[reg] {
+			continue
+		}
+		seen[reg] = true
+		a.protected = append(a.protected, protectedDomain{domain: reg, label: brandLabel(reg)})
+	}
+	return a, nil
+}
+
+// Close 保存尚未落盘的发件人记录
+func (a *Analyzer) Close() error {
+	return a.history.Flush()
+}
+
+// Analyze 计算风险；会把发件人记入 History
+func (a *Analyzer) Analyze(msg *parser.Message) *Risk {
+	var found []Reason
+	add := func(code, detail string) {
+		for i := range found {
+			if found[i].Code == code {
+				if strings.Count(found[i].Detail, "; ")+1 < maxDetails && !strings.Contains(found[i].Detail, detail) {
+					found[i].Detail += "; " + detail
+				}
+				return
+			}
+		}
+		found = append(found, Reason{Code: code, Score: weights[code], Detail: detail})
+	}
+
+	var fromDomain string
+	if msg.FromAddress != nil {
+		fromDomain = registrable(domainOf(msg.FromAddress.Address))
+		a.checkDomain(domainOf(msg.FromAddress.Address), "from", add)
+		a.checkDisplayName(msg.FromAddress, fromDomain, add)
+		if a.history != nil && a.history.Observe(msg.FromAddress.Address) {
+			add(ReasonFirstSender, strings.ToLower(msg.FromAddress.Address))
+		}
+	}
+	for _, r := range msg.ReplyTo {
+		d := registrable(domainOf(r.Address))
+		if d == "" {
+			continue
+		}
+		a.checkDomain(domainOf(r.Address), "reply-to", add)
+		if fromDomain != "" && d != fromDomain {
+			add(ReasonReplyTo, fmt.Sprintf("from=%s reply-to=%s", fromDomain, d))
+		}
+	}
+	for _, l := range msg.Links {
+		host := hostOf(l.URL)
+		if host == "" {
+			continue
+		}
+		a.checkDomain(host, "link", add)
+		if shown := textDomain(l.Text); shown != "" && shown != registrable(host) {
+			add(ReasonLinkText, fmt.Sprintf("%s -> %s", shown, host))
+		}
+	}
+
+	risk := &Risk{Level: "low"}
+	for _, r := range found {
+		risk.Score += r.Score
+	}
+	risk.Score = min(risk.Score, 100)
+	switch {
+	case risk.Score >= 60:
+		risk.Level = "high"
+	case risk.Score >= 30:
+		risk.Level = "medium"
+	}
+	// 按分值排序，便于规则引擎取首个原因
+	for i := 1; i < len(found); i++ {
+		for j := i; j > 0 && found[j].Score > found[j-1].Score; j-- {
+			found[j], found[j-1] = found[j-1], found[j]
+		}
+	}
+	risk.Reasons = found
+	return risk
+}
+
+// checkDomain 检查 punycode 与仿冒
+func (a *Analyzer) checkDomain(host, where string, add func(code, detail string)) {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if host == "" {
+		return
+	}
+	uni := host
+	if isIDN(host) {
+		if u, err := idna.ToUnicode(host); err == nil {
+			uni = u
+		}
+		ascii, err := idna.ToASCII(host)
+		if err != nil {
+			ascii = host
+		}
+		add(ReasonPunycode, fmt.Sprintf("%s %s (%s)", where, ascii, uni))
+	}
+	if p := a.lookalike(uni); p != "" {
+		add(ReasonLookalike, fmt.Sprintf("%s %s ~ %s", where, host, p))
+	}
+}
+
+// lookalike 返回 host 仿冒的受保护域名；非仿冒返回空
+func (a *Analyzer) lookalike(host string) string {
+	reg := registrable(host)
+	if reg == "" {
+		return ""
+	}
+	label := brandLabel(reg)
+	tokens := strings.Split(label, "-")
+	for _, p := range a.protected {
+		if reg == p.domain || label == p.label { // 本域及品牌自有的其他后缀（paypal.co.uk）
+			continue
+		}
+		if skeleton(label) == skeleton(p.label) {
+			return p.domain
+		}
+		if utf8.RuneCountInString(p.label) >= 5 && editDistance(label, p.label) == 1 {
+			return p.domain
+		}
+		// paypal-verify.com、paypal.com.secure-login.net
+		if utf8.RuneCountInString(p.label) >= 5 && len(tokens) > 1 {
+			for _, t := range tokens {
+				if t == p.label || skeleton(t) == skeleton(p.label) {
+					return p.domain
+				}
+			}
+		}
+		if strings.HasPrefix(host, p.domain+".") || strings.Contains(host, "."+p.domain+".") {
+			return p.domain
+		}
+	}
+	return ""
+}
+
+// emailInTextRe 显示名中的邮件地址
+var emailInTextRe = regexp.MustCompile(`[A-Za-z0-9._%+\-]+@([A-Za-z0-9\-]+(?:\.[A-Za-z0-9\-]+)+)`)
+
+// checkDisplayName 显示名写着其他域的地址，或写着受保护品牌但发件域不是该品牌
+func (a *Analyzer) checkDisplayName(from *parser.Address, fromDomain string, add func(code, detail string)) {
+	name := strings.ToLower(strings.TrimSpace(from.Name))
+	if name == "" || fromDomain == "" {
+		return
+	}
+	if m := emailInTextRe.FindStringSubmatch(name); m != nil {
+		if d := registrable(m[1]); d != "" && d != fromDomain {
+			add(ReasonDisplayName, fmt.Sprintf("%q <%s>", from.Name, from.Address))
+		}
+		return
+	}
+	words := strings.FieldsFunc(name, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '.' || r >= utf8.RuneSelf)
+	})
+	for _, p := range a.protected {
+		if utf8.RuneCountInString(p.label) < 5 || brandLabel(fromDomain) == p.label {
+			continue
+		}
+		for _, w := range words {
+			if w == p.label || w == p.domain {
+				add(ReasonDisplayName, fmt.Sprintf("%q <%s>", from.Name, from.Address))
+				return
+			}
+		}
+	}
+}
+
+// registrable 返回可注册域名（eTLD+1）；无法判断时返回小写主机名
+func registrable(host string) string {
+	host = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(host)), ".")
+	if host == "" {
+		return ""
+	}
+	if isIDN(host) {
+		if u, err := idna.ToUnicode(host); err == nil {
+			host = u
+		}
+	}
+	if d, err := publicsuffix.EffectiveTLDPlusOne(host); err == nil {
+		return d
+	}
+	return host
+}
+
+// brandLabel 可注册域名去掉公共后缀后的部分（paypal.co.uk → paypal）
+func brandLabel(reg string) string {
+	suffix, _ := publicsuffix.PublicSuffix(reg)
+	return strings.TrimSuffix(strings.TrimSuffix(reg, suffix), ".")
+}
+
+func isIDN(host string) bool {
+	if strings.HasPrefix(host, "xn--") || strings.Contains(host, ".xn--") {
+		return true
+	}
+	for i := 0; i < len(host); i++ {
+		if host[i] >= utf8.RuneSelf {
+			return true
+		}
+	}
+	return false
+}
+
+func domainOf(addr string) string {
+	if i := strings.LastIndexByte(addr, '@'); i >= 0 {
+		return strings.ToLower(addr[i+1:])
+	}
+	return ""
+}
+
+func hostOf(raw string) string {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(u.Hostname())
+}
+
+// textDomainRe 看起来像域名或网址的链接文字
+var textDomainRe = regexp.MustCompile(`^(?i)(?:https?://)?((?:[a-z0-9\-\p{L}]+\.)+[a-z\p{L}]{2,})(?:[:/?#].*)?$`)
+
+// textDomain 链接文字显示的可注册域名；文字不像网址时返回空
+func textDomain(text string) string {
+	text = strings.TrimSpace(text)
+	if text == "" || strings.ContainsAny(text, " \t\n@") {
+		return ""
+	}
+	m := textDomainRe.FindStringSubmatch(text)
+	if m == nil {
+		return ""
+	}
+	host := strings.ToLower(m[1])
+	if _, icann := publicsuffix.PublicSuffix(host); !icann && !isIDN(host) { // "file.pdf" 之类不是域名
+		return ""
+	}
+	return registrable(host)
+}
+
+// confusables 常见同形字符到 ASCII 的映射（西里尔 / 希腊字母、数字）
+var confusables = strings.NewReplacer(
+	"а", "a", "е", "e", "о", "o", "р", "p", "с", "c", "х", "x", "у", "y", "і", "l", "ј", "j", "ѕ", "s", "ԁ", "d", "һ", "h", "ɡ", "g",
+	"α", "a", "ο", "o", "ρ", "p", "ν", "v", "ι", "l", "κ", "k", "τ", "t",
+	"0", "o", "1", "l", "i", "l", "3", "e", "5", "s", "rn", "m", "vv", "w",
+)
+
+// skeleton 归一化同形字符后的比较键
+func skeleton(s string) string {
+	s = strings.ToLower(s)
+	return strings.ReplaceAll(confusables.Replace(s), "-", "")
+}
+
+// editDistance Levenshtein 距离（按 rune）
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(rb)]
+}
@@ -0,0 +1,151 @@
+package analysis
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"monitor-imap-webhook/internal/config"
+	"monitor-imap-webhook/internal/parser"
+)
+
+func newTestAnalyzer(t *testing.T) *Analyzer {
+	t.Helper()
+	a, err := New(&config.Config{RiskProtectedDomains: "example-corp.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
+
+func codes(r *Risk) map[string]string {
+	m := map[string]string{}
+	for _, x := range r.Reasons {
+		m[x.Code] = x.Detail
+	}
+	return m
+}
+
+func TestAnalyzePhish(t *testing.T) {
+	a := newTestAnalyzer(t)
+	msg := &parser.Message{
+		FromAddress: &parser.Address{Name: "PayPal Service", Address: "service@paypa1.com"},
+		ReplyTo:     []parser.Address{{Address: "collect@mail.ru"}},
+		Links: []parser.Link{
+			{URL: "https://login.evil.example/verify", Text: "https://www.paypal.com/signin", Source: "html"},
+			{URL: "https://xn--pypal-4ve.com/", Text: "点击这里", Source: "html"},
+		},
+	}
+	r := a.Analyze(msg)
+	got := codes(r)
+	for _, c := range []string{ReasonDisplayName, ReasonLookalike, ReasonPunycode, ReasonLinkText, ReasonReplyTo, ReasonFirstSender} {
+		if _, ok := got[c]; !ok {
+			t.Errorf("missing %s in %+v", c, r.Reasons)
+		}
+	}
+	if r.Score != 100 || r.Level != "high" || r.Reasons[0].Code != ReasonLookalike {
+		t.Fatalf("risk=%+v", r)
+	}
+	if !strings.Contains(got[ReasonLookalike], "paypa1.com ~ paypal.com") || !strings.Contains(got[ReasonPunycode], "pаypal.com") {
+		t.Fatalf("details=%v", got)
+	}
+	if got[ReasonLinkText] != "paypal.com -> login.evil.example" {
+		t.Fatalf("link=%q", got[ReasonLinkText])
+	}
+
+	// 同一发件人第二次出现不再是首次发件人
+	if _, ok := codes(a.Analyze(msg))[ReasonFirstSender]; ok {
+		t.Fatal("sender should be known")
+	}
+}
+
+func TestAnalyzeLegit(t *testing.T) {
+	a := newTestAnalyzer(t)
+	a.history.Observe("billing@example-corp.com")
+	msg := &parser.Message{
+		FromAddress: &parser.Address{Name: "Example Billing", Address: "billing@example-corp.com"},
+		ReplyTo:     []parser.Address{{Address: "support@help.example-corp.com"}},
+		Links: []parser.Link{
+			{URL: "https://www.example-corp.com/invoice/1", Text: "example-corp.com/invoice", Source: "html"},
+			{URL: "https://paypal.co.uk/pay", Text: "Pay now", Source: "html"},
+			{URL: "https://cdn.example.org/report.pdf", Text: "report.pdf", Source: "html"},
+		},
+	}
+	if r := a.Analyze(msg); r.Score != 0 || r.Level != "low" || len(r.Reasons) != 0 {
+		t.Fatalf("risk=%+v", r)
+	}
+}
+
+func TestLookalike(t *testing.T) {
+	a := newTestAnalyzer(t)
+	for host, want := range map[string]string{
+		"arnazon.com":                 "amazon.com",
+		"g00gle.com":                  "google.com",
+		"micros0ft-support.net":       "microsoft.com",
+		"paypal-verify.com":           "paypal.com",
+		"paypal.com.secure-login.net": "paypal.com",
+		"exarnple-corp.com":           "example-corp.com",
+		"mail.google.com":             "",
+		"news.ycombinator.com":        "",
+		"github.io":                   "",
+		"alipay.com.cn":               "",
+	} {
+		if got := a.lookalike(host); got != want {
+			t.Errorf("%s: got %q want %q", host, got, want)
+		}
+	}
+}
+
+func TestHistoryPersist(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "senders.json")
+	h, err := OpenHistory(path, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !h.Observe("Alice@Example.com") || h.Observe("alice@example.com") {
+		t.Fatal("observe")
+	}
+	// 延迟落盘：Flush 前不写文件
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("saved before flush: %v", err)
+	}
+	if err := h.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Fatal(err)
+	}
+	h2, err := OpenHistory(path, 0, 0)
+	if err != nil || h2.Observe("alice@example.com") {
+		t.Fatalf("reload err=%v", err)
+	}
+}
+
+func TestHistoryBounded(t *testing.T) {
+	h, err := OpenHistory("", 10, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now().Unix()
+	for i := 0; i < 10; i++ {
+		h.seen[fmt.Sprintf("s%d@example.com", i)] = now - int64(100-i) // s0 最早
+	}
+	h.seen["old@example.com"] = now - 2*3600
+	// 过期记录视为未见过
+	if !h.Observe("old@example.com") {
+		t.Fatal("expired sender should be first-time again")
+	}
+	// 超过上限：淘汰到 9 条，最早的 s0、s1 被移除
+	if len(h.seen) != 9 {
+		t.Fatalf("len=%d", len(h.seen))
+	}
+	if _, ok := h.seen["s1@example.com"]; ok {
+		t.Fatal("oldest entries should be evicted")
+	}
+	if h.Observe("s9@example.com") || h.Observe("old@example.com") {
+		t.Fatal("recent senders should be kept")
+	}
+}
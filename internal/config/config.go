@@ -5,57 +5,179 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"regexp"
+	"strings"
 	"time"
 
+	"github.com/andybalholm/cascadia"
 	"gopkg.in/yaml.v3"
 )
 
 // Config holds application configuration.
 type Config struct {
-	IMAPHost           string        `yaml:"imap_host"`
-	IMAPPort           int           `yaml:"imap_port"`
-	Username           string        `yaml:"username"`
-	Password           string        `yaml:"password"`
-	Mailbox            string        `yaml:"mailbox"`
-	UseTLS             bool          `yaml:"tls"`
-	StartTLS           bool          `yaml:"starttls"`
-	InsecureSkipVerify bool          `yaml:"insecure_skip_verify"`
-	CheckInterval      time.Duration `yaml:"interval"`
-	DrainTimeout       time.Duration `yaml:"drain_timeout"`
-	WebhookURL         string        `yaml:"webhook"`
-	WebhookHeader      string        `yaml:"webhook_header"`
-	FetchBodySize      int           `yaml:"fetch_body_bytes"`
-	RetryMax           int           `yaml:"retry_max"`
-	RetryBaseBackoff   time.Duration `yaml:"retry_backoff"`
-	HTMLToTextMode     string        `yaml:"html2text"`          // simple | preserve-line | none
-	IncludeRawHTML     bool          `yaml:"raw_html"`           // 是否在 payload 中包含原始 HTML（若存在）
-	EnableBlocks       bool          `yaml:"enable_blocks"`      // 是否基于 HTML 解析结构化 blocks
-	SkipInlineImages   bool          `yaml:"skip_inline_images"` // 是否忽略 disposition=inline 且 content-type image/* 的附件
-	Debug              bool          `yaml:"debug"`
+	IMAPHost             string        `yaml:"imap_host"`
+	IMAPPort             int           `yaml:"imap_port"`
+	Username             string        `yaml:"username"`
+	Password             string        `yaml:"password"`
+	Mailbox              string        `yaml:"mailbox"`
+	UseTLS               bool          `yaml:"tls"`
+	StartTLS             bool          `yaml:"starttls"`
+	InsecureSkipVerify   bool          `yaml:"insecure_skip_verify"`
+	CheckInterval        time.Duration `yaml:"interval"`
+	DrainTimeout         time.Duration `yaml:"drain_timeout"`
+	WebhookURL           string        `yaml:"webhook"`
+	WebhookHeader        string        `yaml:"webhook_header"`
+	FetchBodySize        int           `yaml:"fetch_body_bytes"`
+	RetryMax             int           `yaml:"retry_max"`
+	RetryBaseBackoff     time.Duration `yaml:"retry_backoff"`
+	HTMLToTextMode       string        `yaml:"html2text"`                   // simple | preserve-line | markdown | none
+	IncludeRawHTML       bool          `yaml:"raw_html"`                    // 是否在 payload 中包含原始 HTML（若存在）
+	EnableBlocks         bool          `yaml:"enable_blocks"`               // 是否基于 HTML 解析结构化 blocks
+	SkipInlineImages     bool          `yaml:"skip_inline_images"`          // 是否忽略 disposition=inline 且 content-type image/* 的附件
+	AttachmentSHA256     bool          `yaml:"attachment_sha256"`           // 是否计算附件解码内容的 SHA-256
+	AttachmentDelivery   string        `yaml:"attachment_delivery"`         // none | inline | multipart | store
+	AttachmentInlineMax  int           `yaml:"attachment_inline_max_bytes"` // inline 模式下单个附件内联的最大字节数
+	AttachmentMaxTotal   int           `yaml:"attachment_max_total_bytes"`  // 单封邮件投递附件内容的总字节上限
+	AttachmentAllowTypes string        `yaml:"attachment_allow_types"`      // 允许投递的 MIME 类型, 逗号分隔, 支持 image/*
+	AttachmentDenyTypes  string        `yaml:"attachment_deny_types"`       // 拒绝投递的 MIME 类型
+	AttachmentAllowExt   string        `yaml:"attachment_allow_ext"`        // 允许投递的扩展名, 如 .pdf,.xlsx
+	AttachmentDenyExt    string        `yaml:"attachment_deny_ext"`         // 拒绝投递的扩展名
+	StorageBackend       string        `yaml:"storage_backend"`             // local | s3 (attachment_delivery=store)
+	StorageDir           string        `yaml:"storage_dir"`                 // 本地附件存储目录
+	S3Endpoint           string        `yaml:"s3_endpoint"`                 // S3 兼容服务地址
+	S3Bucket             string        `yaml:"s3_bucket"`
+	S3Region             string        `yaml:"s3_region"`
+	S3AccessKey          string        `yaml:"s3_access_key"`
+	S3SecretKey          string        `yaml:"s3_secret_key"`
+	StorageRetention     time.Duration `yaml:"storage_retention"`      // 附件保留时长, 超过后由清理任务删除
+	DownloadListen       string        `yaml:"download_listen"`        // 内置下载服务监听地址
+	DownloadBaseURL      string        `yaml:"download_base_url"`      // 下载链接对外地址
+	DownloadSecret       string        `yaml:"download_secret"`        // 下载链接 HMAC 签名密钥
+	DownloadURLTTL       time.Duration `yaml:"download_url_ttl"`       // 下载链接有效期
+	IncludeHeaders       string        `yaml:"include_headers"`        // 逗号分隔的头部白名单，原样输出到 payload.headers（* 表示全部）
+	ThreadMode           string        `yaml:"thread_mode"`            // headers | server（优先使用 X-GM-THRID / IMAP THREAD，不支持时回退头部计算）
+	StripQuotes          bool          `yaml:"strip_quotes"`           // 剥离引用历史与签名，新内容输出到 body_new
+	AuthServID           string        `yaml:"auth_serv_id"`           // 受信任的 Authentication-Results authserv-id（逗号分隔），为空时最上方的头部仅供展示
+	VerifyDKIM           bool          `yaml:"verify_dkim"`            // 自行校验 DKIM 签名（需要 DNS 查询）
+	RequireAuth          bool          `yaml:"require_auth"`           // 丢弃未通过认证的邮件（auth.authenticated=false）
+	SMIMECAFile          string        `yaml:"smime_ca_file"`          // S/MIME 签名校验的信任库（PEM CA 证书）
+	SMIMECertFile        string        `yaml:"smime_cert_file"`        // S/MIME 解密用证书（PEM）
+	SMIMEKeyFile         string        `yaml:"smime_key_file"`         // S/MIME 解密用私钥（PEM）
+	PGPKeyringFile       string        `yaml:"pgp_keyring_file"`       // PGP 签名校验用公钥（ASCII armor）
+	PGPPrivateKeyFile    string        `yaml:"pgp_private_key_file"`   // PGP 解密用私钥（ASCII armor）
+	PGPPassphrase        string        `yaml:"pgp_passphrase"`         // PGP 私钥口令
+	ExtractLinks         bool          `yaml:"extract_links"`          // 提取正文超链接到 links
+	UnwrapLinks          bool          `yaml:"unwrap_links"`           // links 中解包已知跟踪跳转（Safe Links / google.com/url 等）
+	Extractors           []Extractor   `yaml:"extractors"`             // 字段提取规则，仅支持配置文件
+	InspectArchives      bool          `yaml:"inspect_archives"`       // 列出 zip/tar/gz 附件内的条目
+	ArchiveMaxDepth      int           `yaml:"archive_max_depth"`      // 嵌套压缩包的最大展开层数
+	ArchiveMaxEntries    int           `yaml:"archive_max_entries"`    // 单个附件最多列出的条目数
+	ArchiveMaxBytes      int           `yaml:"archive_max_bytes"`      // 检查单个附件时最多解压的字节数
+	ClamdAddress         string        `yaml:"clamd_address"`          // clamd 地址（unix:/path 或 tcp:host:port），为空不扫描
+	ClamdTimeout         time.Duration `yaml:"clamd_timeout"`          // 单个附件的扫描超时
+	ScanPolicy           string        `yaml:"scan_policy"`            // annotate | strip | quarantine
+	QuarantineMailbox    string        `yaml:"quarantine_mailbox"`     // scan_policy=quarantine 时的隔离文件夹
+	RiskAnalysis         bool          `yaml:"risk_analysis"`          // 钓鱼 / 仿冒启发式分析，输出 risk
+	RiskProtectedDomains string        `yaml:"risk_protected_domains"` // 额外的受保护域名（逗号分隔），检测仿冒
+	SenderHistoryFile    string        `yaml:"sender_history_file"`    // 已见发件人记录文件（首次发件人判断），为空仅内存
+	LoopHeader           string        `yaml:"loop_header"`            // 本服务下游发信时添加的标记头部，命中即视为回环
+	AutoMailSkip         string        `yaml:"auto_mail_skip"`         // 跳过（不发送 Webhook）的自动邮件类型，逗号分隔
+	SenderRateLimit      int           `yaml:"sender_rate_limit"`      // 每个发件人在 sender_rate_window 内最多发送的 Webhook 数，0 不限制
+	SenderRateWindow     time.Duration `yaml:"sender_rate_window"`     // 发件人频率限制的滑动窗口
+	SenderHistoryMax     int           `yaml:"sender_history_max"`     // 已见发件人记录的最大条数，超出时淘汰首次出现最早的发件人，0 不限制
+	SenderHistoryTTL     time.Duration `yaml:"sender_history_ttl"`     // 已见发件人记录的保留时长（自首次出现起），0 永久保留
+	Debug                bool          `yaml:"debug"`
+}
+
+// Extractor 命名的字段提取规则：regex / selector / jsonpath 三选一，结果写入 payload.extracted[name]
+type Extractor struct {
+	Name     string `yaml:"name"`
+	Regex    string `yaml:"regex"`    // 作用于 source 指定的文本；取名为 value 的分组，否则第一个分组，否则整个匹配
+	Source   string `yaml:"source"`   // regex 的作用对象: body(默认) | subject
+	Selector string `yaml:"selector"` // CSS 选择器，作用于 HTML 正文
+	Attr     string `yaml:"attr"`     // selector 取该属性值而非文本
+	JSONPath string `yaml:"jsonpath"` // JSON-LD 路径，如 acceptedOffer.price、items[0].name
+	LDType   string `yaml:"ld_type"`  // jsonpath 仅作用于该 @type 的 JSON-LD 对象
+	Type     string `yaml:"type"`     // string(默认) | number | date | currency
+	From     string `yaml:"from"`     // 仅对发件人地址匹配该正则的邮件生效
+	Subject  string `yaml:"subject"`  // 仅对主题匹配该正则的邮件生效
+	All      bool   `yaml:"all"`      // 输出全部匹配（数组），默认只取第一个
 }
 
 // pointer wrapper for YAML detection of presence
 type fileConfig struct {
-	IMAPHost           *string        `yaml:"imap_host"`
-	IMAPPort           *int           `yaml:"imap_port"`
-	Username           *string        `yaml:"username"`
-	Password           *string        `yaml:"password"`
-	Mailbox            *string        `yaml:"mailbox"`
-	UseTLS             *bool          `yaml:"tls"`
-	StartTLS           *bool          `yaml:"starttls"`
-	InsecureSkipVerify *bool          `yaml:"insecure_skip_verify"`
-	CheckInterval      *time.Duration `yaml:"interval"`
-	DrainTimeout       *time.Duration `yaml:"drain_timeout"`
-	WebhookURL         *string        `yaml:"webhook"`
-	WebhookHeader      *string        `yaml:"webhook_header"`
-	FetchBodySize      *int           `yaml:"fetch_body_bytes"`
-	RetryMax           *int           `yaml:"retry_max"`
-	RetryBaseBackoff   *time.Duration `yaml:"retry_backoff"`
-	HTMLToTextMode     *string        `yaml:"html2text"`
-	IncludeRawHTML     *bool          `yaml:"raw_html"`
-	EnableBlocks       *bool          `yaml:"enable_blocks"`
-	SkipInlineImages   *bool          `yaml:"skip_inline_images"`
-	Debug              *bool          `yaml:"debug"`
+	IMAPHost             *string        `yaml:"imap_host"`
+	IMAPPort             *int           `yaml:"imap_port"`
+	Username             *string        `yaml:"username"`
+	Password             *string        `yaml:"password"`
+	Mailbox              *string        `yaml:"mailbox"`
+	UseTLS               *bool          `yaml:"tls"`
+	StartTLS             *bool          `yaml:"starttls"`
+	InsecureSkipVerify   *bool          `yaml:"insecure_skip_verify"`
+	CheckInterval        *time.Duration `yaml:"interval"`
+	DrainTimeout         *time.Duration `yaml:"drain_timeout"`
+	WebhookURL           *string        `yaml:"webhook"`
+	WebhookHeader        *string        `yaml:"webhook_header"`
+	FetchBodySize        *int           `yaml:"fetch_body_bytes"`
+	RetryMax             *int           `yaml:"retry_max"`
+	RetryBaseBackoff     *time.Duration `yaml:"retry_backoff"`
+	HTMLToTextMode       *string        `yaml:"html2text"`
+	IncludeRawHTML       *bool          `yaml:"raw_html"`
+	EnableBlocks         *bool          `yaml:"enable_blocks"`
+	SkipInlineImages     *bool          `yaml:"skip_inline_images"`
+	AttachmentSHA256     *bool          `yaml:"attachment_sha256"`
+	AttachmentDelivery   *string        `yaml:"attachment_delivery"`
+	AttachmentInlineMax  *int           `yaml:"attachment_inline_max_bytes"`
+	AttachmentMaxTotal   *int           `yaml:"attachment_max_total_bytes"`
+	AttachmentAllowTypes *string        `yaml:"attachment_allow_types"`
+	AttachmentDenyTypes  *string        `yaml:"attachment_deny_types"`
+	AttachmentAllowExt   *string        `yaml:"attachment_allow_ext"`
+	AttachmentDenyExt    *string        `yaml:"attachment_deny_ext"`
+	StorageBackend       *string        `yaml:"storage_backend"`
+	StorageDir           *string        `yaml:"storage_dir"`
+	S3Endpoint           *string        `yaml:"s3_endpoint"`
+	S3Bucket             *string        `yaml:"s3_bucket"`
+	S3Region             *string        `yaml:"s3_region"`
+	S3AccessKey          *string        `yaml:"s3_access_key"`
+	S3SecretKey          *string        `yaml:"s3_secret_key"`
+	StorageRetention     *time.Duration `yaml:"storage_retention"`
+	DownloadListen       *string        `yaml:"download_listen"`
+	DownloadBaseURL      *string        `yaml:"download_base_url"`
+	DownloadSecret       *string        `yaml:"download_secret"`
+	DownloadURLTTL       *time.Duration `yaml:"download_url_ttl"`
+	IncludeHeaders       *string        `yaml:"include_headers"`
+	ThreadMode           *string        `yaml:"thread_mode"`
+	StripQuotes          *bool          `yaml:"strip_quotes"`
+	AuthServID           *string        `yaml:"auth_serv_id"`
+	VerifyDKIM           *bool          `yaml:"verify_dkim"`
+	RequireAuth          *bool          `yaml:"require_auth"`
+	SMIMECAFile          *string        `yaml:"smime_ca_file"`
+	SMIMECertFile        *string        `yaml:"smime_cert_file"`
+	SMIMEKeyFile         *string        `yaml:"smime_key_file"`
+	PGPKeyringFile       *string        `yaml:"pgp_keyring_file"`
+	PGPPrivateKeyFile    *string        `yaml:"pgp_private_key_file"`
+	PGPPassphrase        *string        `yaml:"pgp_passphrase"`
+	ExtractLinks         *bool          `yaml:"extract_links"`
+	UnwrapLinks          *bool          `yaml:"unwrap_links"`
+	Extractors           []Extractor    `yaml:"extractors"`
+	InspectArchives      *bool          `yaml:"inspect_archives"`
+	ArchiveMaxDepth      *int           `yaml:"archive_max_depth"`
+	ArchiveMaxEntries    *int           `yaml:"archive_max_entries"`
+	ArchiveMaxBytes      *int           `yaml:"archive_max_bytes"`
+	ClamdAddress         *string        `yaml:"clamd_address"`
+	ClamdTimeout         *time.Duration `yaml:"clamd_timeout"`
+	ScanPolicy           *string        `yaml:"scan_policy"`
+	QuarantineMailbox    *string        `yaml:"quarantine_mailbox"`
+	RiskAnalysis         *bool          `yaml:"risk_analysis"`
+	RiskProtectedDomains *string        `yaml:"risk_protected_domains"`
+	SenderHistoryFile    *string        `yaml:"sender_history_file"`
+	LoopHeader           *string        `yaml:"loop_header"`
+	AutoMailSkip         *string        `yaml:"auto_mail_skip"`
+	SenderRateLimit      *int           `yaml:"sender_rate_limit"`
+	SenderRateWindow     *time.Duration `yaml:"sender_rate_window"`
+	SenderHistoryMax     *int           `yaml:"sender_history_max"`
+	SenderHistoryTTL     *time.Duration `yaml:"sender_history_ttl"`
+	Debug                *bool          `yaml:"debug"`
 }
 
 // custom flag value types to know if user explicitly set
@@ -123,18 +245,38 @@ func (d *durationFlag) Set(v string) error {
 func Load() (*Config, error) {
 	// 1. 内部默认值
 	cfg := &Config{
-		IMAPPort:         993,
-		Mailbox:          "INBOX",
-		UseTLS:           true,
-		FetchBodySize:    200 * 1024,
-		RetryMax:         5,
-		RetryBaseBackoff: 1 * time.Second,
-		HTMLToTextMode:   "simple",
-		CheckInterval:    30 * time.Second,
-		DrainTimeout:     3 * time.Second,
-		IncludeRawHTML:   false,
-		EnableBlocks:     false,
-		SkipInlineImages: false,
+		IMAPPort:            993,
+		Mailbox:             "INBOX",
+		UseTLS:              true,
+		FetchBodySize:       200 * 1024,
+		RetryMax:            5,
+		RetryBaseBackoff:    1 * time.Second,
+		HTMLToTextMode:      "simple",
+		CheckInterval:       30 * time.Second,
+		DrainTimeout:        3 * time.Second,
+		IncludeRawHTML:      false,
+		EnableBlocks:        false,
+		SkipInlineImages:    false,
+		AttachmentDelivery:  "none",
+		AttachmentInlineMax: 1024 * 1024,
+		AttachmentMaxTotal:  10 * 1024 * 1024,
+		StorageBackend:      "local",
+		StorageDir:          "./attachments",
+		S3Region:            "us-east-1",
+		StorageRetention:    7 * 24 * time.Hour,
+		DownloadListen:      ":8090",
+		DownloadURLTTL:      24 * time.Hour,
+		ThreadMode:          "headers",
+		ArchiveMaxDepth:     2,
+		ArchiveMaxEntries:   1000,
+		ArchiveMaxBytes:     50 * 1024 * 1024,
+		ClamdTimeout:        30 * time.Second,
+		ScanPolicy:          "annotate",
+		QuarantineMailbox:   "Quarantine",
+		LoopHeader:          "X-Monitor-Imap-Webhook",
+		AutoMailSkip:        "loop",
+		SenderRateWindow:    10 * time.Minute,
+		SenderHistoryMax:    100000,
 	}
 
 	// 2. 环境变量覆盖 (若存在)
@@ -213,6 +355,197 @@ func Load() (*Config, error) {
 	if v, ok := os.LookupEnv("SKIP_INLINE_IMAGES"); ok {
 		cfg.SkipInlineImages = parseBool(v)
 	}
+	if v, ok := os.LookupEnv("ATTACHMENT_SHA256"); ok {
+		cfg.AttachmentSHA256 = parseBool(v)
+	}
+	if v, ok := os.LookupEnv("ATTACHMENT_DELIVERY"); ok {
+		cfg.AttachmentDelivery = v
+	}
+	if v, ok := os.LookupEnv("ATTACHMENT_INLINE_MAX_BYTES"); ok {
+		var n int
+		fmt.Sscanf(v, "%d", &n)
+		if n >= 0 {
+			cfg.AttachmentInlineMax = n
+		}
+	}
+	if v, ok := os.LookupEnv("ATTACHMENT_MAX_TOTAL_BYTES"); ok {
+		var n int
+		fmt.Sscanf(v, "%d", &n)
+		if n >= 0 {
+			cfg.AttachmentMaxTotal = n
+		}
+	}
+	if v, ok := os.LookupEnv("ATTACHMENT_ALLOW_TYPES"); ok {
+		cfg.AttachmentAllowTypes = v
+	}
+	if v, ok := os.LookupEnv("ATTACHMENT_DENY_TYPES"); ok {
+		cfg.AttachmentDenyTypes = v
+	}
+	if v, ok := os.LookupEnv("ATTACHMENT_ALLOW_EXT"); ok {
+		cfg.AttachmentAllowExt = v
+	}
+	if v, ok := os.LookupEnv("ATTACHMENT_DENY_EXT"); ok {
+		cfg.AttachmentDenyExt = v
+	}
+	if v, ok := os.LookupEnv("STORAGE_BACKEND"); ok {
+		cfg.StorageBackend = v
+	}
+	if v, ok := os.LookupEnv("STORAGE_DIR"); ok {
+		cfg.StorageDir = v
+	}
+	if v, ok := os.LookupEnv("S3_ENDPOINT"); ok {
+		cfg.S3Endpoint = v
+	}
+	if v, ok := os.LookupEnv("S3_BUCKET"); ok {
+		cfg.S3Bucket = v
+	}
+	if v, ok := os.LookupEnv("S3_REGION"); ok {
+		cfg.S3Region = v
+	}
+	if v, ok := os.LookupEnv("S3_ACCESS_KEY"); ok {
+		cfg.S3AccessKey = v
+	}
+	if v, ok := os.LookupEnv("S3_SECRET_KEY"); ok {
+		cfg.S3SecretKey = v
+	}
+	if v, ok := os.LookupEnv("STORAGE_RETENTION"); ok {
+		if d, err := time.ParseDuration(v); err == nil {
+			cfg.StorageRetention = d
+		}
+	}
+	if v, ok := os.LookupEnv("DOWNLOAD_LISTEN"); ok {
+		cfg.DownloadListen = v
+	}
+	if v, ok := os.LookupEnv("DOWNLOAD_BASE_URL"); ok {
+		cfg.DownloadBaseURL = v
+	}
+	if v, ok := os.LookupEnv("DOWNLOAD_SECRET"); ok {
+		cfg.DownloadSecret = v
+	}
+	if v, ok := os.LookupEnv("DOWNLOAD_URL_TTL"); ok {
+		if d, err := time.ParseDuration(v); err == nil {
+			cfg.DownloadURLTTL = d
+		}
+	}
+	if v, ok := os.LookupEnv("INCLUDE_HEADERS"); ok {
+		cfg.IncludeHeaders = v
+	}
+	if v, ok := os.LookupEnv("THREAD_MODE"); ok {
+		cfg.ThreadMode = v
+	}
+	if v, ok := os.LookupEnv("STRIP_QUOTES"); ok {
+		cfg.StripQuotes = parseBool(v)
+	}
+	if v, ok := os.LookupEnv("AUTH_SERV_ID"); ok {
+		cfg.AuthServID = v
+	}
+	if v, ok := os.LookupEnv("VERIFY_DKIM"); ok {
+		cfg.VerifyDKIM = parseBool(v)
+	}
+	if v, ok := os.LookupEnv("REQUIRE_AUTH"); ok {
+		cfg.RequireAuth = parseBool(v)
+	}
+	if v, ok := os.LookupEnv("SMIME_CA_FILE"); ok {
+		cfg.SMIMECAFile = v
+	}
+	if v, ok := os.LookupEnv("SMIME_CERT_FILE"); ok {
+		cfg.SMIMECertFile = v
+	}
+	if v, ok := os.LookupEnv("SMIME_KEY_FILE"); ok {
+		cfg.SMIMEKeyFile = v
+	}
+	if v, ok := os.LookupEnv("PGP_KEYRING_FILE"); ok {
+		cfg.PGPKeyringFile = v
+	}
+	if v, ok := os.LookupEnv("PGP_PRIVATE_KEY_FILE"); ok {
+		cfg.PGPPrivateKeyFile = v
+	}
+	if v, ok := os.LookupEnv("PGP_PASSPHRASE"); ok {
+		cfg.PGPPassphrase = v
+	}
+	if v, ok := os.LookupEnv("EXTRACT_LINKS"); ok {
+		cfg.ExtractLinks = parseBool(v)
+	}
+	if v, ok := os.LookupEnv("UNWRAP_LINKS"); ok {
+		cfg.UnwrapLinks = parseBool(v)
+	}
+	if v, ok := os.LookupEnv("INSPECT_ARCHIVES"); ok {
+		cfg.InspectArchives = parseBool(v)
+	}
+	if v, ok := os.LookupEnv("ARCHIVE_MAX_DEPTH"); ok {
+		var n int
+		fmt.Sscanf(v, "%d", &n)
+		if n >= 0 {
+			cfg.ArchiveMaxDepth = n
+		}
+	}
+	if v, ok := os.LookupEnv("ARCHIVE_MAX_ENTRIES"); ok {
+		var n int
+		fmt.Sscanf(v, "%d", &n)
+		if n >= 0 {
+			cfg.ArchiveMaxEntries = n
+		}
+	}
+	if v, ok := os.LookupEnv("ARCHIVE_MAX_BYTES"); ok {
+		var n int
+		fmt.Sscanf(v, "%d", &n)
+		if n >= 0 {
+			cfg.ArchiveMaxBytes = n
+		}
+	}
+	if v, ok := os.LookupEnv("CLAMD_ADDRESS"); ok {
+		cfg.ClamdAddress = v
+	}
+	if v, ok := os.LookupEnv("CLAMD_TIMEOUT"); ok {
+		if d, err := time.ParseDuration(v); err == nil {
+			cfg.ClamdTimeout = d
+		}
+	}
+	if v, ok := os.LookupEnv("SCAN_POLICY"); ok {
+		cfg.ScanPolicy = v
+	}
+	if v, ok := os.LookupEnv("QUARANTINE_MAILBOX"); ok {
+		cfg.QuarantineMailbox = v
+	}
+	if v, ok := os.LookupEnv("RISK_ANALYSIS"); ok {
+		cfg.RiskAnalysis = parseBool(v)
+	}
+	if v, ok := os.LookupEnv("RISK_PROTECTED_DOMAINS"); ok {
+		cfg.RiskProtectedDomains = v
+	}
+	if v, ok := os.LookupEnv("SENDER_HISTORY_FILE"); ok {
+		cfg.SenderHistoryFile = v
+	}
+	if v, ok := os.LookupEnv("LOOP_HEADER"); ok {
+		cfg.LoopHeader = v
+	}
+	if v, ok := os.LookupEnv("AUTO_MAIL_SKIP"); ok {
+		cfg.AutoMailSkip = v
+	}
+	if v, ok := os.LookupEnv("SENDER_RATE_LIMIT"); ok {
+		var n int
+		fmt.Sscanf(v, "%d", &n)
+		if n >= 0 {
+			cfg.SenderRateLimit = n
+		}
+	}
+	if v, ok := os.LookupEnv("SENDER_RATE_WINDOW"); ok {
+		if d, err := time.ParseDuration(v); err == nil {
+			cfg.SenderRateWindow = d
+		}
+	}
+	if v, ok := os.LookupEnv("SENDER_HISTORY_MAX"); ok {
+		var n int
+		fmt.Sscanf(v, "%d", &n)
+		if n >= 0 {
+			cfg.SenderHistoryMax = n
+		}
+	}
+	if v, ok := os.LookupEnv("SENDER_HISTORY_TTL"); ok {
+		if d, err := time.ParseDuration(v); err == nil {
+			cfg.SenderHistoryTTL = d
+		}
+	}
 	if v, ok := os.LookupEnv("DEBUG"); ok {
 		cfg.Debug = parseBool(v)
 	}
@@ -265,13 +598,115 @@ func Load() (*Config, error) {
 	dfRetryBackoff := &durationFlag{val: cfg.RetryBaseBackoff}
 	flag.Var(dfRetryBackoff, "retry-backoff", "Webhook 重试初始退避时间")
 	sfHTML := &stringFlag{val: cfg.HTMLToTextMode}
-	flag.Var(sfHTML, "html2text", "HTML 转纯文本策略: simple|preserve-line|none")
+	flag.Var(sfHTML, "html2text", "HTML 转纯文本策略: simple|preserve-line|markdown(额外输出 body_markdown)|none")
 	bfRaw := &boolFlag{val: cfg.IncludeRawHTML}
 	flag.Var(bfRaw, "raw-html", "在 Webhook Payload 中包含原始 HTML 内容 (可能较大)")
 	bfBlocks := &boolFlag{val: cfg.EnableBlocks}
 	flag.Var(bfBlocks, "enable-blocks", "基于 HTML 解析结构化 blocks (实验特性)")
 	bfSkipInline := &boolFlag{val: cfg.SkipInlineImages}
 	flag.Var(bfSkipInline, "skip-inline-images", "忽略 disposition=inline 且 content-type image/* 的嵌入图片附件")
+	bfAttachmentSHA256 := &boolFlag{val: cfg.AttachmentSHA256}
+	flag.Var(bfAttachmentSHA256, "attachment-sha256", "为每个附件计算解码内容的 SHA-256 (attachments_detail.sha256)")
+	sfAttachmentDelivery := &stringFlag{val: cfg.AttachmentDelivery}
+	flag.Var(sfAttachmentDelivery, "attachment-delivery", "附件内容投递方式: none|inline(base64 内联 JSON)|multipart(multipart/form-data 上传)|store(存储并下发签名下载链接)")
+	ifAttachmentInlineMax := &intFlag{val: cfg.AttachmentInlineMax}
+	flag.Var(ifAttachmentInlineMax, "attachment-inline-max-bytes", "inline 模式下单个附件 base64 内联的最大字节数, 超过则仅保留元数据")
+	ifAttachmentMaxTotal := &intFlag{val: cfg.AttachmentMaxTotal}
+	flag.Var(ifAttachmentMaxTotal, "attachment-max-total-bytes", "单封邮件随 webhook 投递的附件内容总字节上限 (0 不限制)")
+	sfAttachmentAllowTypes := &stringFlag{val: cfg.AttachmentAllowTypes}
+	flag.Var(sfAttachmentAllowTypes, "attachment-allow-types", "允许投递内容的 MIME 类型列表, 逗号分隔, 支持 image/* 通配 (空为不限制)")
+	sfAttachmentDenyTypes := &stringFlag{val: cfg.AttachmentDenyTypes}
+	flag.Var(sfAttachmentDenyTypes, "attachment-deny-types", "拒绝投递内容的 MIME 类型列表, 逗号分隔, 优先于允许列表")
+	sfAttachmentAllowExt := &stringFlag{val: cfg.AttachmentAllowExt}
+	flag.Var(sfAttachmentAllowExt, "attachment-allow-ext", "允许投递内容的文件扩展名列表, 逗号分隔, 如 .pdf,.xlsx (空为不限制)")
+	sfAttachmentDenyExt := &stringFlag{val: cfg.AttachmentDenyExt}
+	flag.Var(sfAttachmentDenyExt, "attachment-deny-ext", "拒绝投递内容的文件扩展名列表, 逗号分隔, 优先于允许列表")
+	sfStorageBackend := &stringFlag{val: cfg.StorageBackend}
+	flag.Var(sfStorageBackend, "storage-backend", "附件存储后端: local|s3 (attachment_delivery=store 时生效)")
+	sfStorageDir := &stringFlag{val: cfg.StorageDir}
+	flag.Var(sfStorageDir, "storage-dir", "本地附件存储目录 (内容寻址)")
+	sfS3Endpoint := &stringFlag{val: cfg.S3Endpoint}
+	flag.Var(sfS3Endpoint, "s3-endpoint", "S3 兼容服务地址, 如 https://s3.amazonaws.com 或 http://127.0.0.1:9000")
+	sfS3Bucket := &stringFlag{val: cfg.S3Bucket}
+	flag.Var(sfS3Bucket, "s3-bucket", "S3 bucket 名称")
+	sfS3Region := &stringFlag{val: cfg.S3Region}
+	flag.Var(sfS3Region, "s3-region", "S3 区域")
+	sfS3AccessKey := &stringFlag{val: cfg.S3AccessKey}
+	flag.Var(sfS3AccessKey, "s3-access-key", "S3 Access Key")
+	sfS3SecretKey := &stringFlag{val: cfg.S3SecretKey}
+	flag.Var(sfS3SecretKey, "s3-secret-key", "S3 Secret Key")
+	dfStorageRetention := &durationFlag{val: cfg.StorageRetention}
+	flag.Var(dfStorageRetention, "storage-retention", "已存储附件的保留时长 (0 表示不清理)")
+	sfDownloadListen := &stringFlag{val: cfg.DownloadListen}
+	flag.Var(sfDownloadListen, "download-listen", "内置附件下载服务监听地址")
+	sfDownloadBaseURL := &stringFlag{val: cfg.DownloadBaseURL}
+	flag.Var(sfDownloadBaseURL, "download-base-url", "下载链接中使用的对外访问地址, 如 https://files.example.com")
+	sfDownloadSecret := &stringFlag{val: cfg.DownloadSecret}
+	flag.Var(sfDownloadSecret, "download-secret", "下载链接 HMAC 签名密钥")
+	dfDownloadURLTTL := &durationFlag{val: cfg.DownloadURLTTL}
+	flag.Var(dfDownloadURLTTL, "download-url-ttl", "签名下载链接有效期")
+	sfIncludeHeaders := &stringFlag{val: cfg.IncludeHeaders}
+	flag.Var(sfIncludeHeaders, "include-headers", "原样输出到 payload.headers 的头部白名单, 逗号分隔 (* 表示全部)")
+	sfThreadMode := &stringFlag{val: cfg.ThreadMode}
+	flag.Var(sfThreadMode, "thread-mode", "thread_id 来源: headers|server (server 优先使用 X-GM-THRID / IMAP THREAD, 不支持时回退头部计算)")
+	bfStripQuotes := &boolFlag{val: cfg.StripQuotes}
+	flag.Var(bfStripQuotes, "strip-quotes", "剥离回复中的引用历史与签名, 仅含新内容的正文输出到 body_new (body 保持完整)")
+	sfAuthServID := &stringFlag{val: cfg.AuthServID}
+	flag.Var(sfAuthServID, "auth-serv-id", "受信任的 Authentication-Results authserv-id, 逗号分隔 (为空时最上方的头部仅供展示, 可能由发件方伪造)")
+	bfVerifyDKIM := &boolFlag{val: cfg.VerifyDKIM}
+	flag.Var(bfVerifyDKIM, "verify-dkim", "基于原始邮件自行校验 DKIM 签名 (需要 DNS 查询 TXT 公钥)")
+	bfRequireAuth := &boolFlag{val: cfg.RequireAuth}
+	flag.Var(bfRequireAuth, "require-auth", "丢弃未通过认证 (DMARC / 对齐的 DKIM 或 SPF) 的邮件, 不投递 webhook; 需配置 auth-serv-id 或启用 verify-dkim")
+	sfSMIMECAFile := &stringFlag{val: cfg.SMIMECAFile}
+	flag.Var(sfSMIMECAFile, "smime-ca-file", "S/MIME 签名校验使用的 CA 证书文件 (PEM, 可含多个证书)")
+	sfSMIMECertFile := &stringFlag{val: cfg.SMIMECertFile}
+	flag.Var(sfSMIMECertFile, "smime-cert-file", "S/MIME 解密使用的本方证书文件 (PEM)")
+	sfSMIMEKeyFile := &stringFlag{val: cfg.SMIMEKeyFile}
+	flag.Var(sfSMIMEKeyFile, "smime-key-file", "S/MIME 解密使用的私钥文件 (PEM, 与 --smime-cert-file 配对)")
+	sfPGPKeyringFile := &stringFlag{val: cfg.PGPKeyringFile}
+	flag.Var(sfPGPKeyringFile, "pgp-keyring-file", "PGP 签名校验使用的公钥文件 (ASCII armor, 可含多个公钥)")
+	sfPGPPrivateKeyFile := &stringFlag{val: cfg.PGPPrivateKeyFile}
+	flag.Var(sfPGPPrivateKeyFile, "pgp-private-key-file", "PGP 解密使用的私钥文件 (ASCII armor)")
+	sfPGPPassphrase := &stringFlag{val: cfg.PGPPassphrase}
+	flag.Var(sfPGPPassphrase, "pgp-passphrase", "PGP 私钥口令 (私钥未加密时留空)")
+	bfExtractLinks := &boolFlag{val: cfg.ExtractLinks}
+	flag.Var(bfExtractLinks, "extract-links", "提取 HTML 与纯文本正文中的超链接 (含锚文本, 去重) 输出到 links")
+	bfUnwrapLinks := &boolFlag{val: cfg.UnwrapLinks}
+	flag.Var(bfUnwrapLinks, "unwrap-links", "links 中还原已知跟踪跳转 (Outlook Safe Links / google.com/url / Proofpoint 等) 的目标地址")
+	bfInspectArchives := &boolFlag{val: cfg.InspectArchives}
+	flag.Var(bfInspectArchives, "inspect-archives", "列出 zip / tar / gz 附件内的文件名、大小、加密状态并标记危险扩展名 (attachments_detail.archive)")
+	ifArchiveMaxDepth := &intFlag{val: cfg.ArchiveMaxDepth}
+	flag.Var(ifArchiveMaxDepth, "archive-max-depth", "压缩包嵌套展开的最大层数 (1 表示不展开内层压缩包)")
+	ifArchiveMaxEntries := &intFlag{val: cfg.ArchiveMaxEntries}
+	flag.Var(ifArchiveMaxEntries, "archive-max-entries", "单个压缩包附件最多列出的条目数 (含嵌套), 超出时 truncated=true")
+	ifArchiveMaxBytes := &intFlag{val: cfg.ArchiveMaxBytes}
+	flag.Var(ifArchiveMaxBytes, "archive-max-bytes", "检查单个压缩包附件时最多解压的字节数 (gz 与嵌套压缩包需要解压), 防御压缩炸弹")
+	sfClamdAddress := &stringFlag{val: cfg.ClamdAddress}
+	flag.Var(sfClamdAddress, "clamd-address", "clamd 地址 (unix:/run/clamav/clamd.ctl 或 tcp:127.0.0.1:3310), 配置后以 INSTREAM 扫描每个附件; 为空不扫描")
+	dfClamdTimeout := &durationFlag{val: cfg.ClamdTimeout}
+	flag.Var(dfClamdTimeout, "clamd-timeout", "单个附件的 clamd 扫描超时")
+	sfScanPolicy := &stringFlag{val: cfg.ScanPolicy}
+	flag.Var(sfScanPolicy, "scan-policy", "发现感染附件时的处理: annotate(仅标注)|strip(不投递感染附件内容)|quarantine(移动邮件到隔离文件夹, 不投递 webhook)")
+	sfQuarantineMailbox := &stringFlag{val: cfg.QuarantineMailbox}
+	flag.Var(sfQuarantineMailbox, "quarantine-mailbox", "scan_policy=quarantine 时邮件移入的文件夹 (不存在时自动创建)")
+	bfRiskAnalysis := &boolFlag{val: cfg.RiskAnalysis}
+	flag.Var(bfRiskAnalysis, "risk-analysis", "启用钓鱼与可疑内容启发式分析 (显示名与地址不符、仿冒 / punycode 域名、链接文字与目标不符、Reply-To 域不同、首次发件人), 输出 risk")
+	sfRiskProtectedDomains := &stringFlag{val: cfg.RiskProtectedDomains}
+	flag.Var(sfRiskProtectedDomains, "risk-protected-domains", "额外的受保护域名 (逗号分隔, 如本组织域名), 与内置常见品牌域名一起用于仿冒检测")
+	sfSenderHistoryFile := &stringFlag{val: cfg.SenderHistoryFile}
+	flag.Var(sfSenderHistoryFile, "sender-history-file", "已见发件人记录文件 (JSON), 用于判断首次发件人; 为空时只保存在内存中, 重启后重新学习")
+	sfLoopHeader := &stringFlag{val: cfg.LoopHeader}
+	flag.Var(sfLoopHeader, "loop-header", "回环标记头部: Webhook 消费方发出的邮件带此头部, 回到监听邮箱时识别为 loop")
+	sfAutoMailSkip := &stringFlag{val: cfg.AutoMailSkip}
+	flag.Var(sfAutoMailSkip, "auto-mail-skip", "跳过的自动邮件类型 (逗号分隔): loop, auto_reply, auto_generated, bulk, all; 其余仅在 auto_mail 中标注")
+	ifSenderRateLimit := &intFlag{val: cfg.SenderRateLimit}
+	flag.Var(ifSenderRateLimit, "sender-rate-limit", "每个发件人在 sender-rate-window 内最多触发的 Webhook 数, 超出的邮件跳过以抑制邮件风暴; 0 不限制")
+	dfSenderRateWindow := &durationFlag{val: cfg.SenderRateWindow}
+	flag.Var(dfSenderRateWindow, "sender-rate-window", "发件人频率限制的滑动窗口")
+	ifSenderHistoryMax := &intFlag{val: cfg.SenderHistoryMax}
+	flag.Var(ifSenderHistoryMax, "sender-history-max", "已见发件人记录的最大条数, 超出时淘汰首次出现最早的发件人; 0 不限制")
+	dfSenderHistoryTTL := &durationFlag{val: cfg.SenderHistoryTTL}
+	flag.Var(dfSenderHistoryTTL, "sender-history-ttl", "已见发件人记录的保留时长 (自首次出现起算), 过期后再次来信视为首次发件人; 0 永久保留")
 	bfDebug := &boolFlag{val: cfg.Debug}
 	flag.Var(bfDebug, "debug", "启用调试日志")
 	// 也支持再次传入 --config (但不会再解析文件)
@@ -337,6 +772,159 @@ func Load() (*Config, error) {
 	if bfSkipInline.set {
 		cfg.SkipInlineImages = bfSkipInline.val
 	}
+	if bfAttachmentSHA256.set {
+		cfg.AttachmentSHA256 = bfAttachmentSHA256.val
+	}
+	if sfAttachmentDelivery.set {
+		cfg.AttachmentDelivery = sfAttachmentDelivery.val
+	}
+	if ifAttachmentInlineMax.set {
+		cfg.AttachmentInlineMax = ifAttachmentInlineMax.val
+	}
+	if ifAttachmentMaxTotal.set {
+		cfg.AttachmentMaxTotal = ifAttachmentMaxTotal.val
+	}
+	if sfAttachmentAllowTypes.set {
+		cfg.AttachmentAllowTypes = sfAttachmentAllowTypes.val
+	}
+	if sfAttachmentDenyTypes.set {
+		cfg.AttachmentDenyTypes = sfAttachmentDenyTypes.val
+	}
+	if sfAttachmentAllowExt.set {
+		cfg.AttachmentAllowExt = sfAttachmentAllowExt.val
+	}
+	if sfAttachmentDenyExt.set {
+		cfg.AttachmentDenyExt = sfAttachmentDenyExt.val
+	}
+	if sfStorageBackend.set {
+		cfg.StorageBackend = sfStorageBackend.val
+	}
+	if sfStorageDir.set {
+		cfg.StorageDir = sfStorageDir.val
+	}
+	if sfS3Endpoint.set {
+		cfg.S3Endpoint = sfS3Endpoint.val
+	}
+	if sfS3Bucket.set {
+		cfg.S3Bucket = sfS3Bucket.val
+	}
+	if sfS3Region.set {
+		cfg.S3Region = sfS3Region.val
+	}
+	if sfS3AccessKey.set {
+		cfg.S3AccessKey = sfS3AccessKey.val
+	}
+	if sfS3SecretKey.set {
+		cfg.S3SecretKey = sfS3SecretKey.val
+	}
+	if dfStorageRetention.set {
+		cfg.StorageRetention = dfStorageRetention.val
+	}
+	if sfDownloadListen.set {
+		cfg.DownloadListen = sfDownloadListen.val
+	}
+	if sfDownloadBaseURL.set {
+		cfg.DownloadBaseURL = sfDownloadBaseURL.val
+	}
+	if sfDownloadSecret.set {
+		cfg.DownloadSecret = sfDownloadSecret.val
+	}
+	if dfDownloadURLTTL.set {
+		cfg.DownloadURLTTL = dfDownloadURLTTL.val
+	}
+	if sfIncludeHeaders.set {
+		cfg.IncludeHeaders = sfIncludeHeaders.val
+	}
+	if sfThreadMode.set {
+		cfg.ThreadMode = sfThreadMode.val
+	}
+	if bfStripQuotes.set {
+		cfg.StripQuotes = bfStripQuotes.val
+	}
+	if sfAuthServID.set {
+		cfg.AuthServID = sfAuthServID.val
+	}
+	if bfVerifyDKIM.set {
+		cfg.VerifyDKIM = bfVerifyDKIM.val
+	}
+	if bfRequireAuth.set {
+		cfg.RequireAuth = bfRequireAuth.val
+	}
+	if sfSMIMECAFile.set {
+		cfg.SMIMECAFile = sfSMIMECAFile.val
+	}
+	if sfSMIMECertFile.set {
+		cfg.SMIMECertFile = sfSMIMECertFile.val
+	}
+	if sfSMIMEKeyFile.set {
+		cfg.SMIMEKeyFile = sfSMIMEKeyFile.val
+	}
+	if sfPGPKeyringFile.set {
+		cfg.PGPKeyringFile = sfPGPKeyringFile.val
+	}
+	if sfPGPPrivateKeyFile.set {
+		cfg.PGPPrivateKeyFile = sfPGPPrivateKeyFile.val
+	}
+	if sfPGPPassphrase.set {
+		cfg.PGPPassphrase = sfPGPPassphrase.val
+	}
+	if bfExtractLinks.set {
+		cfg.ExtractLinks = bfExtractLinks.val
+	}
+	if bfUnwrapLinks.set {
+		cfg.UnwrapLinks = bfUnwrapLinks.val
+	}
+	if bfInspectArchives.set {
+		cfg.InspectArchives = bfInspectArchives.val
+	}
+	if ifArchiveMaxDepth.set {
+		cfg.ArchiveMaxDepth = ifArchiveMaxDepth.val
+	}
+	if ifArchiveMaxEntries.set {
+		cfg.ArchiveMaxEntries = ifArchiveMaxEntries.val
+	}
+	if ifArchiveMaxBytes.set {
+		cfg.ArchiveMaxBytes = ifArchiveMaxBytes.val
+	}
+	if sfClamdAddress.set {
+		cfg.ClamdAddress = sfClamdAddress.val
+	}
+	if dfClamdTimeout.set {
+		cfg.ClamdTimeout = dfClamdTimeout.val
+	}
+	if sfScanPolicy.set {
+		cfg.ScanPolicy = sfScanPolicy.val
+	}
+	if sfQuarantineMailbox.set {
+		cfg.QuarantineMailbox = sfQuarantineMailbox.val
+	}
+	if bfRiskAnalysis.set {
+		cfg.RiskAnalysis = bfRiskAnalysis.val
+	}
+	if sfRiskProtectedDomains.set {
+		cfg.RiskProtectedDomains = sfRiskProtectedDomains.val
+	}
+	if sfSenderHistoryFile.set {
+		cfg.SenderHistoryFile = sfSenderHistoryFile.val
+	}
+	if sfLoopHeader.set {
+		cfg.LoopHeader = sfLoopHeader.val
+	}
+	if sfAutoMailSkip.set {
+		cfg.AutoMailSkip = sfAutoMailSkip.val
+	}
+	if ifSenderRateLimit.set {
+		cfg.SenderRateLimit = ifSenderRateLimit.val
+	}
+	if dfSenderRateWindow.set {
+		cfg.SenderRateWindow = dfSenderRateWindow.val
+	}
+	if ifSenderHistoryMax.set {
+		cfg.SenderHistoryMax = ifSenderHistoryMax.val
+	}
+	if dfSenderHistoryTTL.set {
+		cfg.SenderHistoryTTL = dfSenderHistoryTTL.val
+	}
 	if bfDebug.set {
 		cfg.Debug = bfDebug.val
 	}
@@ -348,9 +936,56 @@ func Load() (*Config, error) {
 	if cfg.UseTLS && cfg.StartTLS {
 		return nil, fmt.Errorf("参数冲突: 不能同时启用 tls 与 starttls")
 	}
-	if cfg.HTMLToTextMode != "simple" && cfg.HTMLToTextMode != "preserve-line" && cfg.HTMLToTextMode != "none" {
+	if cfg.HTMLToTextMode != "simple" && cfg.HTMLToTextMode != "preserve-line" && cfg.HTMLToTextMode != "markdown" && cfg.HTMLToTextMode != "none" {
 		return nil, fmt.Errorf("html2text 取值非法: %s", cfg.HTMLToTextMode)
 	}
+	if cfg.ThreadMode != "headers" && cfg.ThreadMode != "server" {
+		return nil, fmt.Errorf("thread_mode 取值非法: %s", cfg.ThreadMode)
+	}
+	if (cfg.SMIMECertFile == "") != (cfg.SMIMEKeyFile == "") {
+		return nil, fmt.Errorf("smime_cert_file 与 smime_key_file 需同时配置")
+	}
+	if cfg.RequireAuth && cfg.AuthServID == "" && !cfg.VerifyDKIM { // 最上方的 Authentication-Results 可能由发件方伪造
+		return nil, fmt.Errorf("require_auth 需要配置 auth_serv_id（收信服务器的 authserv-id）或启用 verify_dkim")
+	}
+	if err := validateExtractors(cfg.Extractors); err != nil {
+		return nil, err
+	}
+	for _, kind := range strings.Split(cfg.AutoMailSkip, ",") {
+		switch strings.TrimSpace(kind) {
+		case "", "loop", "auto_reply", "auto_generated", "bulk", "all":
+		default:
+			return nil, fmt.Errorf("auto_mail_skip 取值非法: %s", kind)
+		}
+	}
+	switch cfg.ScanPolicy {
+	case "annotate", "strip":
+	case "quarantine":
+		if cfg.QuarantineMailbox == "" || cfg.QuarantineMailbox == cfg.Mailbox {
+			return nil, fmt.Errorf("scan_policy=quarantine 需要配置与 mailbox 不同的 quarantine_mailbox")
+		}
+	default:
+		return nil, fmt.Errorf("scan_policy 取值非法: %s", cfg.ScanPolicy)
+	}
+	switch cfg.AttachmentDelivery {
+	case "none", "inline", "multipart":
+	case "store":
+		if cfg.DownloadBaseURL == "" || cfg.DownloadSecret == "" {
+			return nil, fmt.Errorf("attachment_delivery=store 需要配置 download_base_url 与 download_secret")
+		}
+		if cfg.StorageBackend != "local" && cfg.StorageBackend != "s3" {
+			return nil, fmt.Errorf("storage_backend 取值非法: %s", cfg.StorageBackend)
+		}
+		if cfg.StorageBackend == "s3" && (cfg.S3Endpoint == "" || cfg.S3Bucket == "") {
+			return nil, fmt.Errorf("storage_backend=s3 需要配置 s3_endpoint 与 s3_bucket")
+		}
+		if cfg.StorageRetention > 0 && cfg.StorageRetention < cfg.DownloadURLTTL {
+			// 清理任务会删除仍在有效期内的链接指向的对象
+			return nil, fmt.Errorf("storage_retention (%s) 不能小于 download_url_ttl (%s)", cfg.StorageRetention, cfg.DownloadURLTTL)
+		}
+	default:
+		return nil, fmt.Errorf("attachment_delivery 取值非法: %s", cfg.AttachmentDelivery)
+	}
 	return cfg, nil
 }
 
@@ -426,9 +1061,209 @@ func mergeFile(path string, base *Config) error {
 	if fc.SkipInlineImages != nil {
 		base.SkipInlineImages = *fc.SkipInlineImages
 	}
+	if fc.AttachmentSHA256 != nil {
+		base.AttachmentSHA256 = *fc.AttachmentSHA256
+	}
+	if fc.AttachmentDelivery != nil {
+		base.AttachmentDelivery = *fc.AttachmentDelivery
+	}
+	if fc.AttachmentInlineMax != nil {
+		base.AttachmentInlineMax = *fc.AttachmentInlineMax
+	}
+	if fc.AttachmentMaxTotal != nil {
+		base.AttachmentMaxTotal = *fc.AttachmentMaxTotal
+	}
+	if fc.AttachmentAllowTypes != nil {
+		base.AttachmentAllowTypes = *fc.AttachmentAllowTypes
+	}
+	if fc.AttachmentDenyTypes != nil {
+		base.AttachmentDenyTypes = *fc.AttachmentDenyTypes
+	}
+	if fc.AttachmentAllowExt != nil {
+		base.AttachmentAllowExt = *fc.AttachmentAllowExt
+	}
+	if fc.AttachmentDenyExt != nil {
+		base.AttachmentDenyExt = *fc.AttachmentDenyExt
+	}
+	if fc.StorageBackend != nil {
+		base.StorageBackend = *fc.StorageBackend
+	}
+	if fc.StorageDir != nil {
+		base.StorageDir = *fc.StorageDir
+	}
+	if fc.S3Endpoint != nil {
+		base.S3Endpoint = *fc.S3Endpoint
+	}
+	if fc.S3Bucket != nil {
+		base.S3Bucket = *fc.S3Bucket
+	}
+	if fc.S3Region != nil {
+		base.S3Region = *fc.S3Region
+	}
+	if fc.S3AccessKey != nil {
+		base.S3AccessKey = *fc.S3AccessKey
+	}
+	if fc.S3SecretKey != nil {
+		base.S3SecretKey = *fc.S3SecretKey
+	}
+	if fc.StorageRetention != nil {
+		base.StorageRetention = *fc.StorageRetention
+	}
+	if fc.DownloadListen != nil {
+		base.DownloadListen = *fc.DownloadListen
+	}
+	if fc.DownloadBaseURL != nil {
+		base.DownloadBaseURL = *fc.DownloadBaseURL
+	}
+	if fc.DownloadSecret != nil {
+		base.DownloadSecret = *fc.DownloadSecret
+	}
+	if fc.DownloadURLTTL != nil {
+		base.DownloadURLTTL = *fc.DownloadURLTTL
+	}
+	if fc.IncludeHeaders != nil {
+		base.IncludeHeaders = *fc.IncludeHeaders
+	}
+	if fc.ThreadMode != nil {
+		base.ThreadMode = *fc.ThreadMode
+	}
+	if fc.StripQuotes != nil {
+		base.StripQuotes = *fc.StripQuotes
+	}
+	if fc.AuthServID != nil {
+		base.AuthServID = *fc.AuthServID
+	}
+	if fc.VerifyDKIM != nil {
+		base.VerifyDKIM = *fc.VerifyDKIM
+	}
+	if fc.RequireAuth != nil {
+		base.RequireAuth = *fc.RequireAuth
+	}
+	if fc.SMIMECAFile != nil {
+		base.SMIMECAFile = *fc.SMIMECAFile
+	}
+	if fc.SMIMECertFile != nil {
+		base.SMIMECertFile = *fc.SMIMECertFile
+	}
+	if fc.SMIMEKeyFile != nil {
+		base.SMIMEKeyFile = *fc.SMIMEKeyFile
+	}
+	if fc.PGPKeyringFile != nil {
+		base.PGPKeyringFile = *fc.PGPKeyringFile
+	}
+	if fc.PGPPrivateKeyFile != nil {
+		base.PGPPrivateKeyFile = *fc.PGPPrivateKeyFile
+	}
+	if fc.PGPPassphrase != nil {
+		base.PGPPassphrase = *fc.PGPPassphrase
+	}
+	if fc.Extractors != nil {
+		base.Extractors = fc.Extractors
+	}
+	if fc.ExtractLinks != nil {
+		base.ExtractLinks = *fc.ExtractLinks
+	}
+	if fc.UnwrapLinks != nil {
+		base.UnwrapLinks = *fc.UnwrapLinks
+	}
+	if fc.InspectArchives != nil {
+		base.InspectArchives = *fc.InspectArchives
+	}
+	if fc.ArchiveMaxDepth != nil {
+		base.ArchiveMaxDepth = *fc.ArchiveMaxDepth
+	}
+	if fc.ArchiveMaxEntries != nil {
+		base.ArchiveMaxEntries = *fc.ArchiveMaxEntries
+	}
+	if fc.ArchiveMaxBytes != nil {
+		base.ArchiveMaxBytes = *fc.ArchiveMaxBytes
+	}
+	if fc.ClamdAddress != nil {
+		base.ClamdAddress = *fc.ClamdAddress
+	}
+	if fc.ClamdTimeout != nil {
+		base.ClamdTimeout = *fc.ClamdTimeout
+	}
+	if fc.ScanPolicy != nil {
+		base.ScanPolicy = *fc.ScanPolicy
+	}
+	if fc.QuarantineMailbox != nil {
+		base.QuarantineMailbox = *fc.QuarantineMailbox
+	}
+	if fc.RiskAnalysis != nil {
+		base.RiskAnalysis = *fc.RiskAnalysis
+	}
+	if fc.RiskProtectedDomains != nil {
+		base.RiskProtectedDomains = *fc.RiskProtectedDomains
+	}
+	if fc.SenderHistoryFile != nil {
+		base.SenderHistoryFile = *fc.SenderHistoryFile
+	}
+	if fc.LoopHeader != nil {
+		base.LoopHeader = *fc.LoopHeader
+	}
+	if fc.AutoMailSkip != nil {
+		base.AutoMailSkip = *fc.AutoMailSkip
+	}
+	if fc.SenderRateLimit != nil {
+		base.SenderRateLimit = *fc.SenderRateLimit
+	}
+	if fc.SenderRateWindow != nil {
+		base.SenderRateWindow = *fc.SenderRateWindow
+	}
+	if fc.SenderHistoryMax != nil {
+		base.SenderHistoryMax = *fc.SenderHistoryMax
+	}
+	if fc.SenderHistoryTTL != nil {
+		base.SenderHistoryTTL = *fc.SenderHistoryTTL
+	}
 	return nil
 }
 
 func parseBool(v string) bool { return v == "1" || v == "true" || v == "TRUE" || v == "yes" }
 
 // (legacy helper functions removed as unused)
+
+// validateExtractors 校验提取规则：名称唯一、恰好一种提取方式、正则可编译、取值合法
+func validateExtractors(list []Extractor) error {
+	seen := make(map[string]bool)
+	for i, e := range list {
+		if e.Name == "" {
+			return fmt.Errorf("extractors[%d]: 缺少 name", i)
+		}
+		if seen[e.Name] {
+			return fmt.Errorf("extractors[%d]: name 重复: %s", i, e.Name)
+		}
+		seen[e.Name] = true
+		n := 0
+		for _, v := range []string{e.Regex, e.Selector, e.JSONPath} {
+			if v != "" {
+				n++
+			}
+		}
+		if n != 1 {
+			return fmt.Errorf("extractor %s: regex / selector / jsonpath 需且只能配置一个", e.Name)
+		}
+		for _, re := range []string{e.Regex, e.From, e.Subject} {
+			if _, err := regexp.Compile(re); err != nil {
+				return fmt.Errorf("extractor %s: 正则非法: %w", e.Name, err)
+			}
+		}
+		if e.Selector != "" {
+			if _, err := cascadia.ParseGroup(e.Selector); err != nil {
+				return fmt.Errorf("extractor %s: selector 非法: %w", e.Name, err)
+			}
+		}
+		switch e.Source {
+		case "", "body", "subject":
+		default:
+			return fmt.Errorf("extractor %s: source 取值非法: %s", e.Name, e.Source)
+		}
+		switch e.Type {
+		case "", "string", "number", "date", "currency":
+		default:
+			return fmt.Errorf("extractor %s: type 取值非法: %s", e.Name, e.Type)
+		}
+	}
+	return nil
+}
@@ -264,6 +264,13 @@ func (cl *Client) IdleLoop(ctx context.Context, events chan<- Event) error {
 					}
 					continue
 				}
+				if expUpd, ok := upd.(*client.ExpungeUpdate); ok { // message removed (e.g. moved to quarantine)
+					applyExpunge(expUpd, &baseline)
+					if cl.cfg.Debug {
+						cl.log.Printf("ExpungeUpdate seq=%d baseline=%d", expUpd.SeqNum, baseline)
+					}
+					continue
+				}
 				if msgUpd, ok := upd.(*client.MessageUpdate); ok && msgUpd.Message != nil { // fallback: query status
 					if cl.cfg.Debug {
 						cl.log.Printf("MessageUpdate seq=%d baseline=%d", msgUpd.Message.SeqNum, baseline)
@@ -274,7 +281,7 @@ func (cl *Client) IdleLoop(ctx context.Context, events chan<- Event) error {
 						time.Sleep(2 * time.Second)
 						goto RECONNECT
 					}
-					st, err := cl.status()
+					st, err := cl.syncStatus(updates, &baseline)
 					if err != nil {
 						cl.reset("status after message update", err)
 						time.Sleep(2 * time.Second)
@@ -297,7 +304,7 @@ func (cl *Client) IdleLoop(ctx context.Context, events chan<- Event) error {
 					time.Sleep(2 * time.Second)
 					goto RECONNECT
 				}
-				st, err := cl.status()
+				st, err := cl.syncStatus(updates, &baseline)
 				if err != nil {
 					cl.reset("status poll", err)
 					time.Sleep(2 * time.Second)
@@ -326,6 +333,43 @@ func (cl *Client) status() (*imap.MailboxStatus, error) {
 	return cl.c.Select(cl.cfg.Mailbox, false)
 }
 
+// applyExpunge shifts baseline down only when the expunged message was already counted.
+func applyExpunge(upd *client.ExpungeUpdate, baseline *uint32) {
+	if upd.SeqNum <= *baseline && *baseline > 0 {
+		*baseline--
+	}
+}
+
+// syncStatus applies queued expunges, then re-selects and drops updates that the fresh
+// count already reflects, so one expunge is never counted by both paths.
+func (cl *Client) syncStatus(updates chan client.Update, baseline *uint32) (*imap.MailboxStatus, error) {
+	for pending := true; pending; {
+		select {
+		case upd := <-updates:
+			if expUpd, ok := upd.(*client.ExpungeUpdate); ok {
+				applyExpunge(expUpd, baseline)
+			}
+		default:
+			pending = false
+		}
+	}
+	st, err := cl.status()
+	if err != nil {
+		return nil, err
+	}
+	for pending := true; pending; {
+		select {
+		case <-updates:
+		default:
+			pending = false
+		}
+	}
+	if st.Messages < *baseline { // expunges we were not told about
+		*baseline = st.Messages
+	}
+	return st, nil
+}
+
 // reset closes the connection so Loop can reconnect.
 func (cl *Client) reset(reason string, err error) {
 	cl.mu.Lock()
@@ -463,6 +507,23 @@ func (cl *Client) handleNewMessages(ctx context.Context, newTotal uint32, baseli
 	return true
 }
 
+// MoveUID moves a message to mailbox, creating it on TRYCREATE-style failures.
+// go-imap falls back to COPY + STORE \Deleted + EXPUNGE when the server lacks MOVE.
+func (cl *Client) MoveUID(ctx context.Context, uid uint32, mailbox string) error {
+	seq := new(imap.SeqSet)
+	seq.AddNum(uid)
+	return cl.Exec(ctx, "move", func(c *client.Client) error {
+		err := c.UidMove(seq, mailbox)
+		if err == nil {
+			return nil
+		}
+		if cerr := c.Create(mailbox); cerr != nil {
+			return err
+		}
+		return c.UidMove(seq, mailbox)
+	})
+}
+
 // tickerC safely returns ticker.C or nil.
 func tickerC(t *time.Ticker) <-chan time.Time {
 	if t == nil {
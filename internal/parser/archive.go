@@ -0,0 +1,275 @@
+package parser
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"path"
+	"strings"
+	"unicode/utf8"
+
+	"monitor-imap-webhook/internal/config"
+)
+
+// ArchiveInfo 压缩包附件的内容清单（inspect_archives 启用时）
+type ArchiveInfo struct {
+	Format    string         `json:"format"`              // zip | tar | tar.gz | gzip | 7z | rar
+	Entries   []ArchiveEntry `json:"entries,omitempty"`   // 条目（按包内顺序）
+	Encrypted bool           `json:"encrypted,omitempty"` // 存在加密条目（含嵌套）
+	Dangerous bool           `json:"dangerous,omitempty"` // 存在危险扩展名的条目（含嵌套）
+	Truncated bool           `json:"truncated,omitempty"` // 超过条目数或解压字节上限，清单不完整
+	Error     string         `json:"error,omitempty"`     // 无法读取的原因（损坏、不支持的格式等）
+}
+
+// ArchiveEntry 压缩包内的一个条目
+type ArchiveEntry struct {
+	Name           string       `json:"name"`
+	Size           int64        `json:"size"`                      // 解压后大小
+	CompressedSize int64        `json:"compressed_size,omitempty"` // 压缩后大小（zip）
+	Dir            bool         `json:"dir,omitempty"`
+	Encrypted      bool         `json:"encrypted,omitempty"`
+	Danger         string       `json:"danger,omitempty"`  // executable | script | shortcut | macro | disk_image
+	Archive        *ArchiveInfo `json:"archive,omitempty"` // 嵌套压缩包的清单
+}
+
+// dangerousExt 危险扩展名及其类别
+var dangerousExt = map[string]string{}
+
+func init() {
+	for danger, exts := range map[string]string{
+		"executable": ".exe .com .scr .pif .msi .msp .dll .cpl .jar .apk .app .hta .msc .gadget .reg",
+		"script":     ".js .jse .vbs .vbe .wsf .wsh .ps1 .psm1 .bat .cmd .sh .py .pl",
+		"shortcut":   ".lnk .url .scf .desktop .website",
+		"macro":      ".docm .dotm .xlsm .xltm .xlam .xlsb .pptm .potm .ppam .ppsm .sldm",
+		"disk_image": ".iso .img .vhd .vhdx",
+	} {
+		for _, ext := range strings.Fields(exts) {
+			dangerousExt[ext] = danger
+		}
+	}
+}
+
+// dangerOf 按扩展名判断危险类别（"invoice.pdf.exe" 按最后一个扩展名）
+func dangerOf(name string) string {
+	return dangerousExt[strings.ToLower(path.Ext(strings.TrimRight(name, " .")))]
+}
+
+// archiveFormat 按魔数识别压缩格式
+func archiveFormat(data []byte) string {
+	switch {
+	case bytes.HasPrefix(data, []byte("PK\x03\x04")), bytes.HasPrefix(data, []byte("PK\x05\x06")):
+		return "zip"
+	case bytes.HasPrefix(data, []byte{0x1f, 0x8b}):
+		return "gzip"
+	case len(data) > 262 && string(data[257:262]) == "ustar":
+		return "tar"
+	case bytes.HasPrefix(data, []byte("7z\xbc\xaf\x27\x1c")):
+		return "7z"
+	case bytes.HasPrefix(data, []byte("Rar!\x1a\x07")):
+		return "rar"
+	}
+	return ""
+}
+
+// archiveInspector 单个附件的检查预算（条目数与解压字节在嵌套层之间共享）
+type archiveInspector struct {
+	maxDepth int
+	entries  int // 剩余可列出的条目数
+	bytes    int // 剩余可解压的字节数
+}
+
+// inspectArchives 为压缩包附件填充 Archive 清单
+func inspectArchives(atts []Attachment, cfg *config.Config) {
+	if !cfg.InspectArchives {
+		return
+	}
+	for i := range atts {
+		x := &archiveInspector{maxDepth: max(cfg.ArchiveMaxDepth, 1), entries: cfg.ArchiveMaxEntries, bytes: cfg.ArchiveMaxBytes}
+		atts[i].Archive = x.inspect(atts[i].Data, atts[i].Filename, 1)
+	}
+}
+
+// inspect 返回 data 的清单；不是压缩包时返回 nil
+func (x *archiveInspector) inspect(data []byte, name string, depth int) *ArchiveInfo {
+	format := archiveFormat(data)
+	if format == "" {
+		return nil
+	}
+	info := &ArchiveInfo{Format: format}
+	var err error
+	switch format {
+	case "zip":
+		err = x.listZip(info, data, depth)
+	case "tar":
+		err = x.listTar(info, bytes.NewReader(data), depth)
+	case "gzip":
+		err = x.listGzip(info, data, name, depth)
+	case "7z":
+		err = x.list7z(info, data)
+	default: // rar：无法检查内容，保守处理
+		info.Error = "unsupported format"
+		info.Truncated, info.Dangerous = true, true
+	}
+	if err != nil {
+		info.Error = err.Error()
+	}
+	for _, e := range info.Entries {
+		if e.Encrypted {
+			info.Encrypted = true
+		}
+		if e.Danger != "" {
+			info.Dangerous = true
+		}
+		if e.Archive != nil {
+			info.Encrypted = info.Encrypted || e.Archive.Encrypted
+			info.Dangerous = info.Dangerous || e.Archive.Dangerous
+			info.Truncated = info.Truncated || e.Archive.Truncated
+		}
+	}
+	return info
+}
+
+// add 追加条目；超过条目上限时返回 false
+func (x *archiveInspector) add(info *ArchiveInfo, e ArchiveEntry) bool {
+	if x.entries <= 0 {
+		info.Truncated = true
+		return false
+	}
+	x.entries--
+	if !e.Dir {
+		e.Danger = dangerOf(e.Name)
+	}
+	info.Entries = append(info.Entries, e)
+	return true
+}
+
+// readBudget 在解压预算内读取全部内容；超出预算返回 false
+func (x *archiveInspector) readBudget(r io.Reader) ([]byte, bool) {
+	b, err := io.ReadAll(io.LimitReader(r, int64(x.bytes)+1))
+	if err != nil {
+		return nil, false
+	}
+	if len(b) > x.bytes {
+		x.bytes = 0
+		return nil, false
+	}
+	x.bytes -= len(b)
+	return b, true
+}
+
+// nested 对可能是压缩包的条目展开一层（按扩展名预筛，避免解压普通文件）
+func (x *archiveInspector) nested(info *ArchiveInfo, open func() (io.Reader, error), name string, size int64, depth int) *ArchiveInfo {
+	if depth >= x.maxDepth || !looksLikeArchiveName(name) {
+		return nil
+	}
+	if size > int64(x.bytes) {
+		info.Truncated = true
+		return nil
+	}
+	r, err := open()
+	if err != nil {
+		return nil
+	}
+	b, ok := x.readBudget(r)
+	if !ok {
+		info.Truncated = true
+		return nil
+	}
+	return x.inspect(b, name, depth+1)
+}
+
+func looksLikeArchiveName(name string) bool {
+	lower := strings.ToLower(name)
+	for _, ext := range []string{".zip", ".tar", ".tgz", ".gz", ".7z", ".rar", ".jar"} {
+		if strings.HasSuffix(lower, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+func (x *archiveInspector) listZip(info *ArchiveInfo, data []byte, depth int) error {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return err
+	}
+	for _, f := range zr.File {
+		e := ArchiveEntry{
+			Name:           zipEntryName(f),
+			Size:           int64(f.UncompressedSize64),
+			CompressedSize: int64(f.CompressedSize64),
+			Dir:            f.FileInfo().IsDir(),
+			Encrypted:      f.Flags&0x1 != 0,
+		}
+		// 先占用条目名额再展开，名额用尽时不再解压
+		if !x.add(info, e) {
+			break
+		}
+		if !e.Dir && !e.Encrypted {
+			info.Entries[len(info.Entries)-1].Archive = x.nested(info, func() (io.Reader, error) { return f.Open() }, e.Name, e.Size, depth)
+		}
+	}
+	return nil
+}
+
+// zipEntryName 未设置 UTF-8 标志的文件名（Windows 中文压缩包多为 GBK）按字符集探测解码
+func zipEntryName(f *zip.File) string {
+	if !f.NonUTF8 || utf8.ValidString(f.Name) {
+		return f.Name
+	}
+	s, _ := decodeCharset([]byte(f.Name), "")
+	return s
+}
+
+func (x *archiveInspector) listTar(info *ArchiveInfo, r io.Reader, depth int) error {
+	tr := tar.NewReader(r)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		switch h.Typeflag {
+		case tar.TypeXGlobalHeader, tar.TypeXHeader, tar.TypeGNULongName, tar.TypeGNULongLink:
+			continue
+		}
+		e := ArchiveEntry{Name: h.Name, Size: h.Size, Dir: h.Typeflag == tar.TypeDir}
+		if !x.add(info, e) {
+			return nil
+		}
+		if h.Typeflag == tar.TypeReg {
+			info.Entries[len(info.Entries)-1].Archive = x.nested(info, func() (io.Reader, error) { return tr, nil }, e.Name, e.Size, depth)
+		}
+	}
+}
+
+// listGzip gzip 内为 tar 时按 tar.gz 列出，否则视为单个文件
+func (x *archiveInspector) listGzip(info *ArchiveInfo, data []byte, name string, depth int) error {
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+	b, ok := x.readBudget(zr)
+	if !ok {
+		info.Truncated = true
+		return errors.New("decompressed size exceeds archive_max_bytes")
+	}
+	if archiveFormat(b) == "tar" {
+		info.Format = "tar.gz"
+		return x.listTar(info, bytes.NewReader(b), depth)
+	}
+	inner := zr.Name
+	if inner == "" {
+		inner = strings.TrimSuffix(strings.TrimSuffix(path.Base(name), ".gz"), ".GZ")
+	}
+	if x.add(info, ArchiveEntry{Name: inner, Size: int64(len(b))}) && depth < x.maxDepth {
+		info.Entries[len(info.Entries)-1].Archive = x.inspect(b, inner, depth+1)
+	}
+	return nil
+}
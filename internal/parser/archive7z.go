@@ -0,0 +1,502 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"unicode/utf16"
+)
+
+// 7z 头部属性 ID（见 7-Zip 源码 DOC/7zFormat.txt）
+const (
+	k7zEnd               = 0x00
+	k7zHeader            = 0x01
+	k7zArchiveProperties = 0x02
+	k7zAdditionalStreams = 0x03
+	k7zMainStreams       = 0x04
+	k7zFilesInfo         = 0x05
+	k7zPackInfo          = 0x06
+	k7zUnpackInfo        = 0x07
+	k7zSubStreamsInfo    = 0x08
+	k7zSize              = 0x09
+	k7zCRC               = 0x0a
+	k7zFolder            = 0x0b
+	k7zCodersUnpackSize  = 0x0c
+	k7zNumUnpackStream   = 0x0d
+	k7zEmptyStream       = 0x0e
+	k7zEmptyFile         = 0x0f
+	k7zName              = 0x11
+	k7zEncodedHeader     = 0x17
+)
+
+// 7z 编码器 ID
+var (
+	coder7zCopy = []byte{0x00}
+	coder7zAES  = []byte{0x06, 0xf1, 0x07, 0x01} // 7zAES（AES-256 + SHA-256）
+)
+
+var errCorrupt7z = errors.New("corrupt 7z header")
+
+// list7z 解析 7z 头部列出条目（文件名、解压后大小、目录、加密）。
+// 标准库没有 LZMA 解码器：头部被压缩（7-Zip 默认）时无法列出，保守标记 truncated / dangerous；
+// 头部被加密（-mhe）时还会标记 encrypted。条目内容同样无法解压，嵌套压缩包不再展开。
+func (x *archiveInspector) list7z(info *ArchiveInfo, data []byte) error {
+	if len(data) < 32 {
+		return errCorrupt7z
+	}
+	off := binary.LittleEndian.Uint64(data[12:20])
+	size := binary.LittleEndian.Uint64(data[20:28])
+	avail := uint64(len(data) - 32)
+	if off > avail || size > avail-off {
+		info.Truncated, info.Dangerous = true, true
+		return errors.New("7z header out of range")
+	}
+	if size == 0 { // 空压缩包
+		return nil
+	}
+	hdr := data[32+off : 32+off+size]
+	if crc32.ChecksumIEEE(hdr) != binary.LittleEndian.Uint32(data[28:32]) {
+		return errors.New("7z header checksum mismatch")
+	}
+	r := &reader7z{b: hdr}
+	switch r.byte() {
+	case k7zHeader:
+		return x.read7zHeader(info, r)
+	case k7zEncodedHeader:
+	default:
+		return errCorrupt7z
+	}
+
+	s := r.streams()
+	if r.err != nil {
+		return r.err
+	}
+	for _, f := range s.folders {
+		if f.encrypted() {
+			info.Encrypted, info.Truncated, info.Dangerous = true, true, true
+			return errors.New("7z header is encrypted")
+		}
+	}
+	// 仅支持未压缩（Copy）的头部；其余编码器无法解码
+	if len(s.folders) != 1 || len(s.folders[0].coders) != 1 || !bytes.Equal(s.folders[0].coders[0], coder7zCopy) || len(s.packSizes) != 1 {
+		info.Truncated, info.Dangerous = true, true
+		return errors.New("compressed 7z header not supported")
+	}
+	pos, n := s.packPos, s.packSizes[0]
+	if pos > avail || n > avail-pos {
+		return errCorrupt7z
+	}
+	r = &reader7z{b: data[32+pos : 32+pos+n]}
+	if r.byte() != k7zHeader {
+		return errCorrupt7z
+	}
+	return x.read7zHeader(info, r)
+}
+
+// read7zHeader 解析 kHeader 之后的内容
+func (x *archiveInspector) read7zHeader(info *ArchiveInfo, r *reader7z) error {
+	var main *streams7z
+	for r.err == nil {
+		switch r.byte() {
+		case k7zArchiveProperties:
+			for r.err == nil && r.byte() != 0 {
+				r.bytes(r.number())
+			}
+		case k7zAdditionalStreams:
+			r.streams()
+		case k7zMainStreams:
+			main = r.streams()
+		case k7zFilesInfo:
+			if r.err != nil {
+				return r.err
+			}
+			return x.read7zFiles(info, r, main)
+		case k7zEnd:
+			return r.err
+		default:
+			r.err = errCorrupt7z
+		}
+	}
+	return r.err
+}
+
+// read7zFiles 按文件列表与子流大小生成条目：空流且非空文件的条目为目录
+func (x *archiveInspector) read7zFiles(info *ArchiveInfo, r *reader7z, main *streams7z) error {
+	n := r.count()
+	var emptyStream, emptyFile []bool
+	var names []string
+	for r.err == nil {
+		t := r.byte()
+		if t == k7zEnd {
+			break
+		}
+		data := r.bytes(r.number())
+		switch t {
+		case k7zEmptyStream:
+			emptyStream = bitVector(data, n)
+		case k7zEmptyFile:
+			empties := 0
+			for _, e := range emptyStream {
+				if e {
+					empties++
+				}
+			}
+			emptyFile = bitVector(data, empties)
+		case k7zName:
+			if len(data) == 0 || data[0] != 0 { // 文件名存放在其他流中（External）
+				return errCorrupt7z
+			}
+			names = utf16Names(data[1:])
+		}
+	}
+	if r.err != nil {
+		return r.err
+	}
+
+	type stream struct {
+		size      uint64
+		encrypted bool
+	}
+	var streams []stream
+	if main != nil {
+		k := 0
+		for i, f := range main.folders {
+			for j := 0; j < main.subCounts[i] && k < len(main.subSizes); j++ {
+				streams = append(streams, stream{main.subSizes[k], f.encrypted()})
+				k++
+			}
+		}
+	}
+	si, ei := 0, 0
+	for i := 0; i < n; i++ {
+		e := ArchiveEntry{}
+		if i < len(names) {
+			e.Name = names[i]
+		}
+		if i < len(emptyStream) && emptyStream[i] {
+			e.Dir = ei >= len(emptyFile) || !emptyFile[ei]
+			ei++
+		} else {
+			if si >= len(streams) {
+				return errCorrupt7z
+			}
+			e.Size, e.Encrypted = int64(streams[si].size), streams[si].encrypted
+			si++
+		}
+		if !x.add(info, e) {
+			break
+		}
+	}
+	return nil
+}
+
+// folder7z 一个 folder（编码器链）
+type folder7z struct {
+	coders      [][]byte     // 编码器 ID
+	unpackSizes []uint64     // 每个输出流的大小
+	bound       map[int]bool // 被 bind pair 消费的输出流
+}
+
+func (f *folder7z) encrypted() bool {
+	for _, c := range f.coders {
+		if bytes.Equal(c, coder7zAES) {
+			return true
+		}
+	}
+	return false
+}
+
+// unpackSize folder 最终输出（未被其他编码器消费的输出流）的大小
+func (f *folder7z) unpackSize() uint64 {
+	for i, s := range f.unpackSizes {
+		if !f.bound[i] {
+			return s
+		}
+	}
+	return 0
+}
+
+// streams7z StreamsInfo：打包流、folder 与子流（每个文件一个）
+type streams7z struct {
+	packPos   uint64
+	packSizes []uint64
+	folders   []*folder7z
+	subCounts []int    // 每个 folder 的子流数
+	subSizes  []uint64 // 全部子流大小（按 folder 顺序）
+}
+
+// reader7z 7z 头部读取器；出错后 err 非空，后续读取均返回零值
+type reader7z struct {
+	b   []byte
+	off int
+	err error
+}
+
+func (r *reader7z) byte() byte {
+	if r.err != nil || r.off >= len(r.b) {
+		r.err = errCorrupt7z
+		return 0
+	}
+	c := r.b[r.off]
+	r.off++
+	return c
+}
+
+func (r *reader7z) bytes(n uint64) []byte {
+	if r.err != nil || n > uint64(len(r.b)-r.off) {
+		r.err = errCorrupt7z
+		return nil
+	}
+	b := r.b[r.off : r.off+int(n)]
+	r.off += int(n)
+	return b
+}
+
+// number 7z 变长整数：首字节高位连续 1 的个数为后续字节数
+func (r *reader7z) number() uint64 {
+	first := r.byte()
+	var v uint64
+	mask := byte(0x80)
+	for i := 0; i < 8; i++ {
+		if first&mask == 0 {
+			return v | uint64(first&(mask-1))<<(8*i)
+		}
+		v |= uint64(r.byte()) << (8 * i)
+		mask >>= 1
+	}
+	return v
+}
+
+// count 读取数量；超过剩余字节数（每项至少 1 字节或 1 位）视为损坏，避免超大分配
+func (r *reader7z) count() int {
+	n := r.number()
+	if n > uint64(len(r.b)-r.off)*8 {
+		r.err = errCorrupt7z
+		return 0
+	}
+	return int(n)
+}
+
+// digests 跳过 CRC 列表，返回各项是否定义
+func (r *reader7z) digests(n int) []bool {
+	var defined []bool
+	if r.byte() != 0 {
+		defined = make([]bool, n)
+		for i := range defined {
+			defined[i] = true
+		}
+	} else {
+		defined = bitVector(r.bytes(uint64(n+7)/8), n)
+	}
+	for _, d := range defined {
+		if d {
+			r.bytes(4)
+		}
+	}
+	return defined
+}
+
+// streams 读取 StreamsInfo（PackInfo / CodersInfo / SubStreamsInfo）
+func (r *reader7z) streams() *streams7z {
+	s := &streams7z{}
+	var crcDefined []bool
+	for r.err == nil {
+		switch r.byte() {
+		case k7zPackInfo:
+			s.packPos = r.number()
+			n := r.count()
+			for r.err == nil {
+				t := r.byte()
+				if t == k7zEnd {
+					break
+				}
+				switch t {
+				case k7zSize:
+					for i := 0; i < n; i++ {
+						s.packSizes = append(s.packSizes, r.number())
+					}
+				case k7zCRC:
+					r.digests(n)
+				default:
+					r.err = errCorrupt7z
+				}
+			}
+		case k7zUnpackInfo:
+			if r.byte() != k7zFolder {
+				r.err = errCorrupt7z
+				break
+			}
+			n := r.count()
+			if r.byte() != 0 { // External
+				r.err = errCorrupt7z
+				break
+			}
+			for i := 0; i < n && r.err == nil; i++ {
+				s.folders = append(s.folders, r.folder())
+			}
+			if r.byte() != k7zCodersUnpackSize {
+				r.err = errCorrupt7z
+				break
+			}
+			for _, f := range s.folders {
+				for i := range f.unpackSizes {
+					f.unpackSizes[i] = r.number()
+				}
+			}
+			for r.err == nil {
+				t := r.byte()
+				if t == k7zEnd {
+					break
+				}
+				if t != k7zCRC {
+					r.err = errCorrupt7z
+					break
+				}
+				crcDefined = r.digests(len(s.folders))
+			}
+		case k7zSubStreamsInfo:
+			r.subStreams(s, crcDefined)
+		case k7zEnd:
+			if s.subCounts == nil {
+				for _, f := range s.folders {
+					s.subCounts = append(s.subCounts, 1)
+					s.subSizes = append(s.subSizes, f.unpackSize())
+				}
+			}
+			return s
+		default:
+			r.err = errCorrupt7z
+		}
+	}
+	return s
+}
+
+// subStreams 读取 SubStreamsInfo：每个 folder 的子流数与大小（最后一个子流大小由 folder 大小推出）
+func (r *reader7z) subStreams(s *streams7z, crcDefined []bool) {
+	s.subCounts = make([]int, len(s.folders))
+	for i := range s.subCounts {
+		s.subCounts[i] = 1
+	}
+	sized := false
+	fill := func(withSizes bool) {
+		for i, f := range s.folders {
+			c := s.subCounts[i]
+			if c == 0 {
+				continue
+			}
+			var sum uint64
+			for j := 0; j < c-1 && r.err == nil; j++ {
+				if !withSizes {
+					r.err = errCorrupt7z
+					return
+				}
+				v := r.number()
+				sum += v
+				s.subSizes = append(s.subSizes, v)
+			}
+			total := f.unpackSize()
+			if sum > total {
+				r.err = errCorrupt7z
+				return
+			}
+			s.subSizes = append(s.subSizes, total-sum)
+		}
+		sized = true
+	}
+	for r.err == nil {
+		t := r.byte()
+		switch t {
+		case k7zNumUnpackStream:
+			for i := range s.subCounts {
+				s.subCounts[i] = r.count()
+			}
+		case k7zSize:
+			fill(true)
+		case k7zCRC:
+			if !sized {
+				fill(false)
+			}
+			n := 0
+			for i, c := range s.subCounts {
+				if c != 1 || i >= len(crcDefined) || !crcDefined[i] {
+					n += c
+				}
+			}
+			r.digests(n)
+		case k7zEnd:
+			if !sized {
+				fill(false)
+			}
+			return
+		default:
+			r.err = errCorrupt7z
+		}
+	}
+}
+
+// folder 读取 folder 的编码器、bind pair 与打包流索引
+func (r *reader7z) folder() *folder7z {
+	f := &folder7z{bound: map[int]bool{}}
+	var totalIn, totalOut int
+	numCoders := r.count()
+	for i := 0; i < numCoders && r.err == nil; i++ {
+		flag := r.byte()
+		if flag&0x80 != 0 { // 备用编码器方法，实际未使用
+			r.err = errCorrupt7z
+			break
+		}
+		f.coders = append(f.coders, r.bytes(uint64(flag&0x0f)))
+		in, out := 1, 1
+		if flag&0x10 != 0 {
+			in, out = r.count(), r.count()
+		}
+		if flag&0x20 != 0 {
+			r.bytes(r.number())
+		}
+		totalIn += in
+		totalOut += out
+	}
+	if r.err != nil || totalOut == 0 || totalOut > 64 || totalIn > 64 {
+		r.err = errCorrupt7z
+		return f
+	}
+	for i := 0; i < totalOut-1; i++ {
+		r.number() // InIndex
+		f.bound[int(r.number())] = true
+	}
+	if packed := totalIn - (totalOut - 1); packed > 1 {
+		for i := 0; i < packed; i++ {
+			r.number()
+		}
+	}
+	f.unpackSizes = make([]uint64, totalOut)
+	return f
+}
+
+// bitVector 按高位在前解析 n 位
+func bitVector(b []byte, n int) []bool {
+	v := make([]bool, n)
+	for i := range v {
+		if i/8 < len(b) {
+			v[i] = b[i/8]&(0x80>>(i%8)) != 0
+		}
+	}
+	return v
+}
+
+// utf16Names 解析以 0x0000 结尾的 UTF-16LE 文件名列表
+func utf16Names(b []byte) []string {
+	var names []string
+	var cur []uint16
+	for i := 0; i+1 < len(b); i += 2 {
+		c := binary.LittleEndian.Uint16(b[i:])
+		if c == 0 {
+			names = append(names, string(utf16.Decode(cur)))
+			cur = cur[:0]
+			continue
+		}
+		cur = append(cur, c)
+	}
+	return names
+}
@@ -0,0 +1,139 @@
+package parser
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+	"testing"
+	"unicode/utf16"
+)
+
+// sevenZip 构造最小 7z：files 的内容存入同一个 folder（编码器 coder，不实际编码），dirs 为空目录；
+// encoded 为 true 时头部本身再用 hdrCoder 包装为 kEncodedHeader。数值均小于 0x80，按单字节写入。
+func sevenZip(t *testing.T, coder []byte, files map[string]int, order, dirs []string, encoded bool, hdrCoder []byte) []byte {
+	t.Helper()
+	num := func(n int) byte {
+		if n >= 0x80 {
+			t.Fatalf("test number too large: %d", n)
+		}
+		return byte(n)
+	}
+	total := 0
+	for _, name := range order {
+		total += files[name]
+	}
+	packed := make([]byte, total)
+
+	h := []byte{k7zHeader, k7zMainStreams,
+		k7zPackInfo, 0, 1, k7zSize, num(total), k7zEnd,
+		k7zUnpackInfo, k7zFolder, 1, 0, 1, byte(len(coder))}
+	h = append(h, coder...)
+	h = append(h, k7zCodersUnpackSize, num(total), k7zEnd,
+		k7zSubStreamsInfo, k7zNumUnpackStream, num(len(order)), k7zSize)
+	for _, name := range order[:len(order)-1] {
+		h = append(h, num(files[name]))
+	}
+	h = append(h, k7zEnd, k7zEnd)
+
+	n := len(order) + len(dirs)
+	h = append(h, k7zFilesInfo, num(n))
+	if len(dirs) > 0 {
+		bits := make([]byte, (n+7)/8)
+		for i := len(order); i < n; i++ {
+			bits[i/8] |= 0x80 >> (i % 8)
+		}
+		h = append(h, k7zEmptyStream, num(len(bits)))
+		h = append(h, bits...)
+	}
+	names := []byte{0}
+	for _, name := range append(append([]string{}, order...), dirs...) {
+		for _, c := range utf16.Encode([]rune(name)) {
+			names = binary.LittleEndian.AppendUint16(names, c)
+		}
+		names = append(names, 0, 0)
+	}
+	h = append(h, k7zName, num(len(names)))
+	h = append(h, names...)
+	h = append(h, k7zEnd, k7zEnd)
+
+	if encoded {
+		packed = append(packed, h...)
+		h = []byte{k7zEncodedHeader,
+			k7zPackInfo, num(total), 1, k7zSize, num(len(h)), k7zEnd,
+			k7zUnpackInfo, k7zFolder, 1, 0, 1, byte(len(hdrCoder))}
+		h = append(h, hdrCoder...)
+		h = append(h, k7zCodersUnpackSize, num(len(packed)-total), k7zEnd, k7zEnd)
+	}
+
+	out := append([]byte("7z\xbc\xaf\x27\x1c\x00\x04"), make([]byte, 24)...)
+	binary.LittleEndian.PutUint64(out[12:], uint64(len(packed)))
+	binary.LittleEndian.PutUint64(out[20:], uint64(len(h)))
+	binary.LittleEndian.PutUint32(out[28:], crc32.ChecksumIEEE(h))
+	binary.LittleEndian.PutUint32(out[8:], crc32.ChecksumIEEE(out[12:32]))
+	out = append(out, packed...)
+	return append(out, h...)
+}
+
+func TestInspect7z(t *testing.T) {
+	files := map[string]int{"readme.txt": 5, "docs/invoice.pdf.exe": 7}
+	order := []string{"readme.txt", "docs/invoice.pdf.exe"}
+	data := sevenZip(t, []byte{0x03, 0x01, 0x01}, files, order, []string{"docs"}, false, nil)
+
+	x := &archiveInspector{maxDepth: 2, entries: 10, bytes: 1 << 20}
+	info := x.inspect(data, "files.7z", 1)
+	if info.Format != "7z" || info.Error != "" || len(info.Entries) != 3 || !info.Dangerous || info.Encrypted || info.Truncated {
+		t.Fatalf("info=%+v", info)
+	}
+	e := info.Entries
+	if e[0].Name != "readme.txt" || e[0].Size != 5 || e[1].Name != "docs/invoice.pdf.exe" || e[1].Size != 7 || e[1].Danger != "executable" {
+		t.Fatalf("entries=%+v", e)
+	}
+	if !e[2].Dir || e[2].Name != "docs" {
+		t.Fatalf("dir=%+v", e[2])
+	}
+
+	// 未压缩（Copy）包装的头部可以直接读取
+	data = sevenZip(t, []byte{0x03, 0x01, 0x01}, files, order, nil, true, coder7zCopy)
+	if info := x.inspect(data, "files.7z", 1); info.Error != "" || len(info.Entries) != 2 {
+		t.Fatalf("copy header=%+v", info)
+	}
+}
+
+func TestInspect7zEncrypted(t *testing.T) {
+	files := map[string]int{"a.txt": 3}
+	order := []string{"a.txt"}
+	x := func() *archiveInspector { return &archiveInspector{maxDepth: 2, entries: 10, bytes: 1 << 20} }
+
+	// 内容加密、头部可见：列出条目并标记加密
+	info := x().inspect(sevenZip(t, coder7zAES, files, order, nil, false, nil), "a.7z", 1)
+	if !info.Encrypted || len(info.Entries) != 1 || !info.Entries[0].Encrypted || info.Truncated {
+		t.Fatalf("content encrypted=%+v", info)
+	}
+
+	// 头部加密（-mhe）：无法列出，保守标记
+	info = x().inspect(sevenZip(t, coder7zCopy, files, order, nil, true, coder7zAES), "a.7z", 1)
+	if !info.Encrypted || !info.Truncated || !info.Dangerous || info.Error == "" || len(info.Entries) != 0 {
+		t.Fatalf("header encrypted=%+v", info)
+	}
+
+	// LZMA 压缩的头部：无法列出，保守标记但不视为加密
+	info = x().inspect(sevenZip(t, coder7zCopy, files, order, nil, true, []byte{0x03, 0x01, 0x01}), "a.7z", 1)
+	if info.Encrypted || !info.Truncated || !info.Dangerous || info.Error == "" {
+		t.Fatalf("compressed header=%+v", info)
+	}
+
+	// rar 只识别格式
+	info = x().inspect([]byte("Rar!\x1a\x07\x01\x00"), "a.rar", 1)
+	if info.Format != "rar" || !info.Truncated || !info.Dangerous || info.Error != "unsupported format" {
+		t.Fatalf("rar=%+v", info)
+	}
+}
+
+func TestInspect7zCorrupt(t *testing.T) {
+	data := sevenZip(t, coder7zCopy, map[string]int{"a.txt": 3}, []string{"a.txt"}, nil, false, nil)
+	for _, cut := range []int{len(data) - 1, 40, 33} {
+		info := (&archiveInspector{maxDepth: 2, entries: 10, bytes: 1 << 20}).inspect(data[:cut], "a.7z", 1)
+		if info.Error == "" {
+			t.Fatalf("cut %d: %+v", cut, info)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package parser
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"testing"
+
+	"monitor-imap-webhook/internal/config"
+)
+
+func zipBytes(t *testing.T, files map[string][]byte, order []string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, name := range order {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write(files[name])
+	}
+	zw.Close()
+	return buf.Bytes()
+}
+
+func archiveCfg() *config.Config {
+	return &config.Config{InspectArchives: true, ArchiveMaxDepth: 2, ArchiveMaxEntries: 100, ArchiveMaxBytes: 1 << 20}
+}
+
+func TestInspectZip(t *testing.T) {
+	inner := zipBytes(t, map[string][]byte{"run.lnk": []byte("L")}, []string{"run.lnk"})
+	data := zipBytes(t, map[string][]byte{
+		"docs/":            nil,
+		"docs/invoice.pdf": []byte("%PDF"),
+		"invoice.pdf.exe":  []byte("MZ"),
+		"budget.xlsm":      []byte("PK"),
+		"nested/inner.zip": inner,
+	}, []string{"docs/", "docs/invoice.pdf", "invoice.pdf.exe", "budget.xlsm", "nested/inner.zip"})
+
+	atts := []Attachment{{Filename: "files.zip", Data: data}, {Filename: "a.txt", Data: []byte("hello")}}
+	inspectArchives(atts, archiveCfg())
+	info := atts[0].Archive
+	if info == nil || info.Format != "zip" || len(info.Entries) != 5 || !info.Dangerous || info.Encrypted || info.Truncated {
+		t.Fatalf("info=%+v", info)
+	}
+	if !info.Entries[0].Dir || info.Entries[1].Danger != "" || info.Entries[1].Size != 4 {
+		t.Fatalf("entries=%+v", info.Entries)
+	}
+	if info.Entries[2].Danger != "executable" || info.Entries[3].Danger != "macro" {
+		t.Fatalf("danger=%+v", info.Entries)
+	}
+	n := info.Entries[4].Archive
+	if n == nil || len(n.Entries) != 1 || n.Entries[0].Danger != "shortcut" {
+		t.Fatalf("nested=%+v", n)
+	}
+	if atts[1].Archive != nil {
+		t.Fatal("plain file should not be inspected")
+	}
+
+	cfg := archiveCfg()
+	cfg.ArchiveMaxDepth, cfg.ArchiveMaxEntries = 1, 2
+	atts[0].Archive = nil
+	inspectArchives(atts, cfg)
+	if info := atts[0].Archive; len(info.Entries) != 2 || !info.Truncated || info.Entries[1].Archive != nil {
+		t.Fatalf("limited=%+v", info)
+	}
+}
+
+func TestInspectEntryLimitSkipsNested(t *testing.T) {
+	inner := zipBytes(t, map[string][]byte{"run.lnk": []byte("L")}, []string{"run.lnk"})
+	data := zipBytes(t, map[string][]byte{"a.txt": []byte("a"), "inner.zip": inner}, []string{"a.txt", "inner.zip"})
+	// 名额用尽后的嵌套压缩包既不列出也不解压（不消耗字节预算）
+	x := &archiveInspector{maxDepth: 2, entries: 1, bytes: 1 << 20}
+	info := x.inspect(data, "files.zip", 1)
+	if len(info.Entries) != 1 || !info.Truncated || x.bytes != 1<<20 {
+		t.Fatalf("info=%+v bytes=%d", info, x.bytes)
+	}
+}
+
+func TestInspectEncryptedZip(t *testing.T) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, _ := zw.CreateHeader(&zip.FileHeader{Name: "secret.js", Flags: 0x1, Method: zip.Store})
+	w.Write([]byte("xx"))
+	zw.Close()
+	info := (&archiveInspector{maxDepth: 2, entries: 10, bytes: 1 << 20}).inspect(buf.Bytes(), "s.zip", 1)
+	if !info.Encrypted || !info.Entries[0].Encrypted || info.Entries[0].Danger != "script" {
+		t.Fatalf("info=%+v", info)
+	}
+}
+
+func TestInspectTarGz(t *testing.T) {
+	var tb bytes.Buffer
+	tw := tar.NewWriter(&tb)
+	tw.WriteHeader(&tar.Header{Name: "bin/", Typeflag: tar.TypeDir, Mode: 0o755})
+	tw.WriteHeader(&tar.Header{Name: "bin/setup.sh", Typeflag: tar.TypeReg, Size: 3, Mode: 0o755})
+	tw.Write([]byte("#!/"))
+	tw.Close()
+	var gb bytes.Buffer
+	gw := gzip.NewWriter(&gb)
+	gw.Write(tb.Bytes())
+	gw.Close()
+
+	x := &archiveInspector{maxDepth: 2, entries: 10, bytes: 1 << 20}
+	info := x.inspect(gb.Bytes(), "release.tgz", 1)
+	if info.Format != "tar.gz" || len(info.Entries) != 2 || info.Entries[1].Name != "bin/setup.sh" || info.Entries[1].Size != 3 || !info.Dangerous {
+		t.Fatalf("info=%+v", info)
+	}
+
+	// 单文件 gzip：解压后超过预算时标记 truncated
+	gb.Reset()
+	gw = gzip.NewWriter(&gb)
+	gw.Name = "dump.sql"
+	gw.Write(make([]byte, 4096))
+	gw.Close()
+	info = (&archiveInspector{maxDepth: 2, entries: 10, bytes: 1 << 20}).inspect(gb.Bytes(), "dump.sql.gz", 1)
+	if info.Format != "gzip" || len(info.Entries) != 1 || info.Entries[0].Name != "dump.sql" || info.Entries[0].Size != 4096 {
+		t.Fatalf("gzip=%+v", info)
+	}
+	info = (&archiveInspector{maxDepth: 2, entries: 10, bytes: 100}).inspect(gb.Bytes(), "dump.sql.gz", 1)
+	if !info.Truncated || info.Error == "" {
+		t.Fatalf("bomb=%+v", info)
+	}
+}
@@ -0,0 +1,360 @@
+package parser
+
+import (
+	"bytes"
+	"context"
+	"net"
+	mailpkg "net/mail"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/emersion/go-msgauth/dkim"
+)
+
+// Auth 邮件认证结论：各机制取值 pass | fail | softfail | neutral | none | temperror | permerror 等
+type Auth struct {
+	SPF           string       `json:"spf"`
+	DKIM          string       `json:"dkim"`
+	DMARC         string       `json:"dmarc"`
+	ARC           string       `json:"arc"`
+	Authenticated bool         `json:"authenticated"`         // 见 isAuthenticated
+	AuthServID    string       `json:"authserv_id,omitempty"` // 采用的 Authentication-Results 的 authserv-id
+	Results       []AuthResult `json:"results,omitempty"`     // 采用的 Authentication-Results 中的全部结果
+	ARCChain      *ARCChain    `json:"arc_chain,omitempty"`
+	Signatures    []DKIMCheck  `json:"dkim_signatures,omitempty"` // verify_dkim 启用时自行校验的结果
+}
+
+// AuthResult Authentication-Results 中的单条结果（RFC 8601 resinfo）
+type AuthResult struct {
+	Method string            `json:"method"`
+	Result string            `json:"result"`
+	Reason string            `json:"reason,omitempty"`
+	Props  map[string]string `json:"props,omitempty"` // header.d / smtp.mailfrom / header.from 等
+}
+
+// ARCChain 最新一跳 ARC 集合（i 最大）的信息；cv 为封印者声明的链状态，未经本地校验
+type ARCChain struct {
+	Instances  int          `json:"instances"`
+	Chain      string       `json:"cv,omitempty"`     // none | pass | fail
+	Sealer     string       `json:"sealer,omitempty"` // ARC-Seal 的 d=
+	AuthServID string       `json:"authserv_id,omitempty"`
+	Results    []AuthResult `json:"results,omitempty"` // ARC-Authentication-Results 中的结果
+}
+
+// DKIMCheck 单个 DKIM-Signature 的本地校验结果
+type DKIMCheck struct {
+	Domain string `json:"domain"`
+	Result string `json:"result"` // pass | fail | temperror | permerror
+	Error  string `json:"error,omitempty"`
+}
+
+// lookupTXT DKIM 公钥查询；测试中替换为本地桩
+var lookupTXT = func(domain string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return net.DefaultResolver.LookupTXT(ctx, domain)
+}
+
+// buildAuth 解析 Authentication-Results / ARC 头部，并按需自行校验 DKIM 签名。
+// trusted 为受信任的 authserv-id；为空时只展示最上方的头部（收信服务器未添加或未剥离
+// 该头部时它可能是发件方伪造的），authenticated 只依据本地 DKIM 校验（verify 关闭时恒为 false）。
+// 没有任何认证信息时返回 nil。
+func buildAuth(raw []byte, hdr mailpkg.Header, trusted []string, verify bool) *Auth {
+	a := &Auth{}
+	for _, v := range hdr["Authentication-Results"] {
+		id, results := parseAuthResults(v)
+		if id == "" || (len(trusted) > 0 && !containsFold(trusted, id)) {
+			continue
+		}
+		a.AuthServID, a.Results = id, results
+		break
+	}
+	a.ARCChain = parseARC(hdr)
+	if verify {
+		a.Signatures = verifyDKIM(raw)
+	}
+	if a.AuthServID == "" && a.ARCChain == nil && len(hdr["Dkim-Signature"]) == 0 {
+		return nil
+	}
+	a.SPF = verdict(a.Results, "spf")
+	a.DKIM = verdict(a.Results, "dkim")
+	a.DMARC = verdict(a.Results, "dmarc")
+	a.ARC = verdict(a.Results, "arc")
+	if a.ARC == "none" && a.ARCChain != nil && a.ARCChain.Chain != "" {
+		a.ARC = a.ARCChain.Chain
+	}
+	if verify {
+		a.DKIM = "none"
+		for _, s := range a.Signatures {
+			if a.DKIM == "none" || s.Result == "pass" {
+				a.DKIM = s.Result
+			}
+		}
+	}
+	a.Authenticated = isAuthenticated(a, hdr, len(trusted) == 0)
+	return a
+}
+
+// isAuthenticated 认证通过的判定：DMARC pass；没有 DMARC 结果时，
+// 要求与 From 域名（宽松）对齐的 DKIM pass 或 SPF pass。localOnly 时不采信头部中的结果。
+func isAuthenticated(a *Auth, hdr mailpkg.Header, localOnly bool) bool {
+	if localOnly {
+		from := parseAddress(hdr.Get("From"))
+		if from == nil {
+			return false
+		}
+		for _, s := range a.Signatures {
+			if s.Result == "pass" && alignedDomain(s.Domain, addrDomain(from.Address)) {
+				return true
+			}
+		}
+		return false
+	}
+	if a.DMARC == "pass" {
+		return true
+	}
+	if a.DMARC != "none" {
+		return false
+	}
+	from := parseAddress(hdr.Get("From"))
+	if from == nil {
+		return false
+	}
+	fromDomain := addrDomain(from.Address)
+	for _, s := range a.Signatures {
+		if s.Result == "pass" && alignedDomain(s.Domain, fromDomain) {
+			return true
+		}
+	}
+	for _, r := range a.Results {
+		if r.Result != "pass" {
+			continue
+		}
+		switch r.Method {
+		case "dkim":
+			if alignedDomain(r.Props["header.d"], fromDomain) {
+				return true
+			}
+		case "spf":
+			if alignedDomain(addrDomain(r.Props["smtp.mailfrom"]), fromDomain) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// verdict 同一机制有多条结果时任一 pass 即为 pass，否则取第一条；缺失为 none
+func verdict(results []AuthResult, method string) string {
+	v := "none"
+	for _, r := range results {
+		if r.Method != method {
+			continue
+		}
+		if v == "none" || r.Result == "pass" {
+			v = r.Result
+		}
+	}
+	return v
+}
+
+var authEqRe = regexp.MustCompile(`\s*=\s*`)
+
+// parseAuthResults 解析 Authentication-Results 值：authserv-id [version]; method=result reason=... ptype.prop=value; ...
+// 括号注释被忽略。
+func parseAuthResults(v string) (string, []AuthResult) {
+	fields := splitUnquoted(stripComments(v), ';')
+	if len(fields) == 0 {
+		return "", nil
+	}
+	id := strings.ToLower(firstField(fields[0]))
+	var results []AuthResult
+	for _, f := range fields[1:] {
+		tokens := strings.Fields(authEqRe.ReplaceAllString(f, "="))
+		if len(tokens) == 0 || tokens[0] == "none" {
+			continue
+		}
+		method, result, ok := strings.Cut(tokens[0], "=")
+		if !ok {
+			continue
+		}
+		method, _, _ = strings.Cut(method, "/") // 去掉方法版本号
+		r := AuthResult{Method: strings.ToLower(method), Result: strings.ToLower(result)}
+		for _, t := range tokens[1:] {
+			k, val, ok := strings.Cut(t, "=")
+			if !ok {
+				continue
+			}
+			k = strings.ToLower(k)
+			val = strings.Trim(val, `"`)
+			if k == "reason" {
+				r.Reason = val
+				continue
+			}
+			if r.Props == nil {
+				r.Props = make(map[string]string)
+			}
+			r.Props[k] = val
+		}
+		results = append(results, r)
+	}
+	return id, results
+}
+
+// parseARC 取 i 最大的 ARC-Seal 与 ARC-Authentication-Results；没有 ARC 头部返回 nil
+func parseARC(hdr mailpkg.Header) *ARCChain {
+	seals := hdr["Arc-Seal"]
+	aars := hdr["Arc-Authentication-Results"]
+	if len(seals) == 0 && len(aars) == 0 {
+		return nil
+	}
+	c := &ARCChain{}
+	for _, s := range seals {
+		tags := parseTagList(s)
+		i, _ := strconv.Atoi(tags["i"])
+		if i > c.Instances {
+			c.Instances = i
+			c.Chain = strings.ToLower(tags["cv"])
+			c.Sealer = strings.ToLower(tags["d"])
+		}
+	}
+	best := 0
+	for _, v := range aars {
+		inst, rest, ok := strings.Cut(v, ";")
+		if !ok {
+			continue
+		}
+		i, _ := strconv.Atoi(strings.TrimPrefix(strings.TrimSpace(inst), "i="))
+		if i > best {
+			best = i
+			c.AuthServID, c.Results = parseAuthResults(rest)
+		}
+	}
+	if best > c.Instances {
+		c.Instances = best
+	}
+	return c
+}
+
+// verifyDKIM 对原始字节校验全部 DKIM-Signature，按域名排序输出
+func verifyDKIM(raw []byte) []DKIMCheck {
+	verifs, err := dkim.VerifyWithOptions(bytes.NewReader(raw), &dkim.VerifyOptions{LookupTXT: lookupTXT})
+	if err != nil {
+		return nil
+	}
+	var out []DKIMCheck
+	for _, v := range verifs {
+		c := DKIMCheck{Domain: strings.ToLower(v.Domain), Result: "pass"}
+		if v.Err != nil {
+			c.Error = v.Err.Error()
+			switch {
+			case dkim.IsTempFail(v.Err):
+				c.Result = "temperror"
+			case dkim.IsPermFail(v.Err):
+				c.Result = "permerror"
+			default:
+				c.Result = "fail"
+			}
+		}
+		out = append(out, c)
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Domain < out[j].Domain })
+	return out
+}
+
+// parseTagList 解析 DKIM/ARC 的 tag=value; 列表，键小写
+func parseTagList(v string) map[string]string {
+	tags := make(map[string]string)
+	for _, f := range strings.Split(v, ";") {
+		k, val, ok := strings.Cut(f, "=")
+		if !ok {
+			continue
+		}
+		tags[strings.ToLower(strings.TrimSpace(k))] = strings.TrimSpace(val)
+	}
+	return tags
+}
+
+// stripComments 去掉括号注释（支持嵌套），引号内的括号保留
+func stripComments(s string) string {
+	var b strings.Builder
+	depth, quoted := 0, false
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		switch {
+		case ch == '\\' && i+1 < len(s) && (quoted || depth > 0):
+			if depth == 0 {
+				b.WriteByte(ch)
+				b.WriteByte(s[i+1])
+			}
+			i++
+			continue
+		case ch == '"' && depth == 0:
+			quoted = !quoted
+		case ch == '(' && !quoted:
+			depth++
+			continue
+		case ch == ')' && !quoted && depth > 0:
+			depth--
+			b.WriteByte(' ')
+			continue
+		}
+		if depth == 0 {
+			b.WriteByte(ch)
+		}
+	}
+	return b.String()
+}
+
+// splitUnquoted 按 sep 切分，忽略引号内的分隔符
+func splitUnquoted(s string, sep byte) []string {
+	var out []string
+	quoted, start := false, 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '"':
+			quoted = !quoted
+		case sep:
+			if !quoted {
+				out = append(out, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(out, s[start:])
+}
+
+func firstField(s string) string {
+	if f := strings.Fields(s); len(f) > 0 {
+		return f[0]
+	}
+	return ""
+}
+
+func addrDomain(addr string) string {
+	if i := strings.LastIndexByte(addr, '@'); i >= 0 {
+		addr = addr[i+1:]
+	}
+	return strings.ToLower(strings.Trim(strings.TrimSpace(addr), "<>."))
+}
+
+// alignedDomain 宽松对齐：两个域名相同或互为子域名
+func alignedDomain(a, b string) bool {
+	a, b = strings.ToLower(strings.TrimSpace(a)), strings.ToLower(strings.TrimSpace(b))
+	if a == "" || b == "" {
+		return false
+	}
+	return a == b || strings.HasSuffix(a, "."+b) || strings.HasSuffix(b, "."+a)
+}
+
+func containsFold(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,137 @@
+package parser
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/emersion/go-msgauth/dkim"
+
+	"monitor-imap-webhook/internal/config"
+)
+
+func TestParseAuthResults(t *testing.T) {
+	id, results := parseAuthResults(`mx.google.com;
+       dkim=pass header.i=@example.com header.s=s1 header.b="Ab/Cd+E=";
+       spf=pass (google.com: domain of bob@example.com designates 192.0.2.1 as permitted sender) smtp.mailfrom=bob@example.com;
+       dmarc=fail (p=REJECT sp=REJECT dis=NONE) header.from=example.com;
+       arc = pass (i=1)`)
+	if id != "mx.google.com" || len(results) != 4 {
+		t.Fatalf("id=%q results=%+v", id, results)
+	}
+	if r := results[0]; r.Method != "dkim" || r.Result != "pass" || r.Props["header.i"] != "@example.com" || r.Props["header.b"] != "Ab/Cd+E=" {
+		t.Fatalf("dkim=%+v", r)
+	}
+	if r := results[1]; r.Method != "spf" || r.Props["smtp.mailfrom"] != "bob@example.com" {
+		t.Fatalf("spf=%+v", r)
+	}
+	if r := results[2]; r.Method != "dmarc" || r.Result != "fail" || r.Props["header.from"] != "example.com" {
+		t.Fatalf("dmarc=%+v", r)
+	}
+	if r := results[3]; r.Method != "arc" || r.Result != "pass" {
+		t.Fatalf("arc=%+v", r)
+	}
+	if id, results := parseAuthResults("mx.example.net 1; none"); id != "mx.example.net" || len(results) != 0 {
+		t.Fatalf("none: id=%q results=%+v", id, results)
+	}
+}
+
+func TestBuildAuthFromHeaders(t *testing.T) {
+	raw := "Authentication-Results: mx.example.net; spf=pass smtp.mailfrom=bounce@mail.example.com; dkim=fail header.d=example.com\r\n" +
+		"Authentication-Results: forged.example.org; dmarc=pass header.from=example.com\r\n" +
+		"ARC-Seal: i=2; a=rsa-sha256; t=1; cv=pass; d=lists.example.org; s=arc; b=xx\r\n" +
+		"ARC-Seal: i=1; a=rsa-sha256; t=1; cv=none; d=example.com; s=arc; b=xx\r\n" +
+		"ARC-Authentication-Results: i=2; lists.example.org; dkim=pass header.d=example.com\r\n" +
+		"ARC-Authentication-Results: i=1; mx.example.com; spf=pass smtp.mailfrom=example.com\r\n" +
+		"From: Bob <bob@example.com>\r\nSubject: hi\r\n\r\nbody\r\n"
+	msg, err := parseRaw([]byte(raw), nil, &config.Config{HTMLToTextMode: "simple"})
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	a := msg.Auth
+	if a == nil || a.AuthServID != "mx.example.net" || a.SPF != "pass" || a.DKIM != "fail" || a.DMARC != "none" {
+		t.Fatalf("auth=%+v", a)
+	}
+	// 未配置 auth_serv_id 且未自行校验 DKIM：头部结论仅供展示，不视为通过
+	if a.Authenticated {
+		t.Fatalf("unconfigured auth should not be trusted: %+v", a)
+	}
+	if c := a.ARCChain; c == nil || c.Instances != 2 || c.Chain != "pass" || c.Sealer != "lists.example.org" || c.AuthServID != "lists.example.org" || len(c.Results) != 1 {
+		t.Fatalf("arc=%+v", a.ARCChain)
+	}
+	if a.ARC != "pass" {
+		t.Fatalf("arc verdict=%s", a.ARC)
+	}
+
+	// 信任 mx.example.net：没有 DMARC 结果时，对齐的 SPF pass（子域名）视为通过
+	msg, _ = parseRaw([]byte(raw), nil, &config.Config{HTMLToTextMode: "simple", AuthServID: "mx.example.net"})
+	if !msg.Auth.Authenticated || msg.Auth.AuthServID != "mx.example.net" {
+		t.Fatalf("expected authenticated: %+v", msg.Auth)
+	}
+
+	// 只信任指定 authserv-id：伪造头部被忽略
+	msg, _ = parseRaw([]byte(raw), nil, &config.Config{HTMLToTextMode: "simple", AuthServID: "MX.example.com, other.example.net"})
+	if msg.Auth.AuthServID != "" || msg.Auth.DMARC != "none" || msg.Auth.Authenticated {
+		t.Fatalf("untrusted auth=%+v", msg.Auth)
+	}
+
+	// 未配置任何信任来源：发件方伪造的 dmarc=pass 不视为通过
+	spoofed := "Authentication-Results: evil; dmarc=pass\r\nFrom: Bob <bob@example.com>\r\nSubject: hi\r\n\r\nbody\r\n"
+	msg, _ = parseRaw([]byte(spoofed), nil, &config.Config{HTMLToTextMode: "simple"})
+	if msg.Auth == nil || msg.Auth.DMARC != "pass" || msg.Auth.Authenticated {
+		t.Fatalf("spoofed auth=%+v", msg.Auth)
+	}
+
+	// 未配置 auth_serv_id 且自行校验 DKIM 时，不采信（可能伪造的）头部结论
+	forged := "Authentication-Results: mx.example.net; dmarc=pass header.from=example.com; spf=pass smtp.mailfrom=example.com\r\n" +
+		"From: Bob <bob@example.com>\r\nSubject: hi\r\n\r\nbody\r\n"
+	msg, _ = parseRaw([]byte(forged), nil, &config.Config{HTMLToTextMode: "simple", VerifyDKIM: true})
+	if msg.Auth == nil || msg.Auth.DMARC != "pass" || msg.Auth.Authenticated {
+		t.Fatalf("forged auth=%+v", msg.Auth)
+	}
+
+	plain := "From: a@example.com\r\nSubject: x\r\n\r\nbody\r\n"
+	msg, _ = parseRaw([]byte(plain), nil, &config.Config{HTMLToTextMode: "simple"})
+	if msg.Auth != nil {
+		t.Fatalf("expected nil auth: %+v", msg.Auth)
+	}
+}
+
+func TestVerifyDKIM(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	orig := lookupTXT
+	defer func() { lookupTXT = orig }()
+	lookupTXT = func(domain string) ([]string, error) {
+		if domain == "s1._domainkey.example.com" {
+			return []string{"v=DKIM1; k=ed25519; p=" + base64.StdEncoding.EncodeToString(pub)}, nil
+		}
+		return nil, errors.New("no such host")
+	}
+	msg := "From: Bob <bob@example.com>\r\nTo: a@example.org\r\nSubject: signed\r\n\r\nHello DKIM\r\n"
+	var signed bytes.Buffer
+	if err := dkim.Sign(&signed, strings.NewReader(msg), &dkim.SignOptions{Domain: "example.com", Selector: "s1", Signer: priv}); err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	cfg := &config.Config{HTMLToTextMode: "simple", VerifyDKIM: true}
+
+	m, err := parseRaw(signed.Bytes(), nil, cfg)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if m.Auth == nil || m.Auth.DKIM != "pass" || len(m.Auth.Signatures) != 1 || m.Auth.Signatures[0].Domain != "example.com" || !m.Auth.Authenticated {
+		t.Fatalf("auth=%+v", m.Auth)
+	}
+
+	tampered := bytes.Replace(signed.Bytes(), []byte("Hello DKIM"), []byte("Hello EVIL"), 1)
+	m, _ = parseRaw(tampered, nil, cfg)
+	if m.Auth == nil || m.Auth.DKIM != "fail" || m.Auth.Authenticated || m.Auth.Signatures[0].Error == "" {
+		t.Fatalf("tampered auth=%+v", m.Auth)
+	}
+}
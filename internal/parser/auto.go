@@ -0,0 +1,90 @@
+package parser
+
+import (
+	mailpkg "net/mail"
+	"net/textproto"
+	"regexp"
+	"strings"
+)
+
+// 自动邮件类型（按优先级从高到低）
+const (
+	AutoLoop      = "loop"           // 带本服务的回环标记头部
+	AutoReply     = "auto_reply"     // 自动回复 / 外出通知
+	AutoGenerated = "auto_generated" // 系统自动生成（通知、空 Return-Path 等）
+	AutoBulk      = "bulk"           // 群发 / 列表（Precedence: bulk / junk / list）
+)
+
+// AutoMail 自动生成邮件的识别结果
+type AutoMail struct {
+	Kind    string   `json:"kind"`    // loop | auto_reply | auto_generated | bulk
+	Reasons []string `json:"reasons"` // 命中的信号，如 "Auto-Submitted: auto-replied"
+}
+
+// outOfOfficeRe 常见外出 / 自动回复主题前缀（Outlook、Gmail、Exchange 中英德法西文）
+var outOfOfficeRe = regexp.MustCompile(`(?i)^\s*(?:` +
+	`out of (?:the )?office|automatic reply|auto[- ]?reply|autoreply|auto[- ]?response|away from (?:the )?office|on vacation|vacation reply|` +
+	`自动回复|自動回覆|自动答复|外出通知|不在办公室|` +
+	`abwesenheitsnotiz|automatische antwort|réponse automatique|respuesta automática|fuera de la oficina)(?:\s*[:：\-]|\s|$)`)
+
+// detectAutoMail 按 RFC 3834 与常见私有头部识别自动邮件；marker 为本服务的回环标记头部名。普通邮件返回 nil。
+func detectAutoMail(hdr mailpkg.Header, subject, marker string) *AutoMail {
+	a := &AutoMail{}
+	hit := func(kind, reason string) {
+		if a.Kind == "" || autoRank(kind) < autoRank(a.Kind) {
+			a.Kind = kind
+		}
+		a.Reasons = append(a.Reasons, reason)
+	}
+	if marker != "" {
+		if v, ok := hdr[textproto.CanonicalMIMEHeaderKey(strings.TrimSpace(marker))]; ok {
+			hit(AutoLoop, marker+": "+strings.TrimSpace(strings.Join(v, ",")))
+		}
+	}
+	if v := strings.ToLower(strings.TrimSpace(hdr.Get("Auto-Submitted"))); v != "" && v != "no" {
+		if strings.HasPrefix(v, "auto-replied") {
+			hit(AutoReply, "Auto-Submitted: "+v)
+		} else {
+			hit(AutoGenerated, "Auto-Submitted: "+v)
+		}
+	}
+	for _, name := range []string{"X-Autoreply", "X-Autorespond", "X-Autogenerated"} {
+		v := strings.TrimSpace(hdr.Get(name))
+		if v == "" || strings.EqualFold(v, "no") || strings.EqualFold(v, "false") {
+			continue
+		}
+		if name == "X-Autogenerated" && !strings.EqualFold(v, "reply") {
+			hit(AutoGenerated, name+": "+v)
+			continue
+		}
+		hit(AutoReply, name+": "+v)
+	}
+	switch v := strings.ToLower(strings.TrimSpace(hdr.Get("Precedence"))); v {
+	case "bulk", "junk", "list":
+		hit(AutoBulk, "Precedence: "+v)
+	case "auto_reply":
+		hit(AutoReply, "Precedence: "+v)
+	}
+	if rp := strings.TrimSpace(hdr.Get("Return-Path")); rp == "<>" {
+		hit(AutoGenerated, "Return-Path: <>")
+	}
+	if outOfOfficeRe.MatchString(subject) {
+		hit(AutoReply, "subject: "+subject)
+	}
+	if a.Kind == "" {
+		return nil
+	}
+	return a
+}
+
+func autoRank(kind string) int {
+	switch kind {
+	case AutoLoop:
+		return 0
+	case AutoReply:
+		return 1
+	case AutoGenerated:
+		return 2
+	}
+	return 3
+}
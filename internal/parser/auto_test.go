@@ -0,0 +1,44 @@
+package parser
+
+import (
+	"testing"
+
+	"monitor-imap-webhook/internal/config"
+)
+
+func TestDetectAutoMail(t *testing.T) {
+	cases := []struct {
+		headers, subject string
+		kind             string
+		reasons          int
+	}{
+		{"Auto-Submitted: auto-replied\r\nX-Autoreply: yes\r\n", "Re: hi", AutoReply, 2},
+		{"Auto-Submitted: auto-generated\r\n", "Build failed", AutoGenerated, 1},
+		{"Auto-Submitted: no\r\n", "hello", "", 0},
+		{"Precedence: bulk\r\n", "Weekly digest", AutoBulk, 1},
+		{"Precedence: list\r\nX-Monitor-Imap-Webhook: 1\r\n", "Re: ticket", AutoLoop, 2},
+		{"Return-Path: <>\r\n", "Delivery report", AutoGenerated, 1},
+		{"", "自动回复：项目周报", AutoReply, 1},
+		{"", "Automatic reply: Quarterly plan", AutoReply, 1},
+		{"", "Out of Office - back Monday", AutoReply, 1},
+		{"", "Autoreplying is hard", "", 0},
+		{"", "Re: out of office plans", "", 0},
+	}
+	for _, c := range cases {
+		raw := "From: bot@example.com\r\nTo: me@example.com\r\n" + c.headers + "Subject: " + c.subject + "\r\n\r\nbody\r\n"
+		msg, err := parseRaw([]byte(raw), nil, &config.Config{HTMLToTextMode: "simple", LoopHeader: "x-monitor-imap-webhook"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		a := msg.AutoMail
+		if c.kind == "" {
+			if a != nil {
+				t.Errorf("%q: unexpected %+v", c.subject, a)
+			}
+			continue
+		}
+		if a == nil || a.Kind != c.kind || len(a.Reasons) != c.reasons {
+			t.Errorf("%q: got %+v want %s", c.subject, a, c.kind)
+		}
+	}
+}
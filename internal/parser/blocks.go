@@ -0,0 +1,399 @@
+package parser
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// buildBlocksFromHTML 基于 DOM 按文档顺序生成 blocks AST（保留原文大小写）：
+//   - heading    {level, text, spans}
+//   - paragraph  {text, spans}
+//   - list       {ordered, items: [文本], entries: [{text, spans, children: [block]}]}（嵌套列表位于 children）
+//   - blockquote {text, blocks}
+//   - code       {text, language}
+//   - table      {rows: [[单元格文本]], header: 首行是否为表头}
+//   - image      {src, alt, content_id}
+//   - hr         {}
+//
+// spans 为行内片段 [{text, bold, italic, code, href}]（为 false/空的字段省略）。
+// HTML 为空或未解析出任何块时，按纯文本空行分段。
+func buildBlocksFromHTML(rawHTML, plain string) []map[string]any {
+	if rawHTML == "" {
+		return buildParagraphBlocksFromPlain(plain)
+	}
+	doc, err := html.Parse(strings.NewReader(rawHTML))
+	if err != nil {
+		return buildParagraphBlocksFromPlain(plain)
+	}
+	b := &blockBuilder{}
+	b.walk(doc)
+	b.flush()
+	if len(b.blocks) == 0 {
+		return buildParagraphBlocksFromPlain(plain)
+	}
+	return b.blocks
+}
+
+var blankLinesRe = regexp.MustCompile(`\n{2,}`)
+
+func buildParagraphBlocksFromPlain(plain string) []map[string]any {
+	if plain == "" {
+		return nil
+	}
+	parts := blankLinesRe.Split(plain, -1)
+	var blocks []map[string]any
+	for _, p := range parts {
+		pt := strings.TrimSpace(p)
+		if pt == "" {
+			continue
+		}
+		blocks = append(blocks, map[string]any{"type": "paragraph", "text": pt})
+	}
+	return blocks
+}
+
+// spanStyle 行内样式
+type spanStyle struct {
+	bold, italic, code bool
+	href               string
+}
+
+// blockBuilder 收集块；行内内容暂存于 spans，遇到块级元素时落为 paragraph
+type blockBuilder struct {
+	blocks []map[string]any
+	spans  []map[string]any
+	styles []spanStyle
+	style  spanStyle
+	space  bool // 待输出的空格
+}
+
+func (b *blockBuilder) walk(n *html.Node) {
+	switch n.Type {
+	case html.TextNode:
+		b.addText(n.Data)
+		return
+	case html.DocumentNode:
+		b.walkChildren(n)
+		return
+	case html.ElementNode:
+	default:
+		return
+	}
+	if skippedElements[n.DataAtom] {
+		return
+	}
+	switch n.DataAtom {
+	case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+		b.flush()
+		b.walkChildren(n)
+		if text, spans := b.takeInline(); text != "" {
+			b.blocks = append(b.blocks, map[string]any{"type": "heading", "level": n.Data[1:2], "text": text, "spans": spans})
+		}
+	case atom.Ul, atom.Ol:
+		b.flush()
+		if list := buildList(n); list != nil {
+			b.blocks = append(b.blocks, list)
+		}
+	case atom.Blockquote:
+		b.flush()
+		sub := &blockBuilder{}
+		sub.walkChildren(n)
+		sub.flush()
+		if len(sub.blocks) > 0 {
+			b.blocks = append(b.blocks, map[string]any{"type": "blockquote", "text": blocksText(sub.blocks), "blocks": sub.blocks})
+		}
+	case atom.Pre:
+		b.flush()
+		if text := strings.Trim(nodeText(n), "\n"); strings.TrimSpace(text) != "" {
+			block := map[string]any{"type": "code", "text": text}
+			if lang := codeLanguage(n); lang != "" {
+				block["language"] = lang
+			}
+			b.blocks = append(b.blocks, block)
+		}
+	case atom.Table:
+		b.flush()
+		if isDataTable(n) {
+			b.addTable(n)
+		} else {
+			b.walkLayoutTable(n)
+		}
+	case atom.Img:
+		src := strings.TrimSpace(attr(n, "src"))
+		if src == "" || isTrackingPixel(n) {
+			return
+		}
+		b.flush()
+		block := map[string]any{"type": "image", "src": src}
+		if alt := strings.TrimSpace(attr(n, "alt")); alt != "" {
+			block["alt"] = alt
+		}
+		if cid, ok := cutPrefixFold(src, "cid:"); ok {
+			block["content_id"] = cid
+		}
+		b.blocks = append(b.blocks, block)
+	case atom.Hr:
+		b.flush()
+		b.blocks = append(b.blocks, map[string]any{"type": "hr"})
+	case atom.Br:
+		b.appendSpan("\n")
+		b.space = false
+	case atom.B, atom.Strong:
+		b.withStyle(n, func(s *spanStyle) { s.bold = true })
+	case atom.I, atom.Em:
+		b.withStyle(n, func(s *spanStyle) { s.italic = true })
+	case atom.Code, atom.Kbd, atom.Samp, atom.Tt:
+		b.withStyle(n, func(s *spanStyle) { s.code = true })
+	case atom.A:
+		href := strings.TrimSpace(attr(n, "href"))
+		if linkTarget(href) == "" {
+			b.walkChildren(n)
+			return
+		}
+		b.withStyle(n, func(s *spanStyle) { s.href = href })
+	default:
+		if paragraphElements[n.DataAtom] || blockElements[n.DataAtom] || n.DataAtom == atom.Li {
+			b.flush()
+			b.walkChildren(n)
+			b.flush()
+			return
+		}
+		b.walkChildren(n)
+	}
+}
+
+func (b *blockBuilder) walkChildren(n *html.Node) {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		b.walk(c)
+	}
+}
+
+func (b *blockBuilder) withStyle(n *html.Node, set func(*spanStyle)) {
+	b.styles = append(b.styles, b.style)
+	set(&b.style)
+	b.walkChildren(n)
+	b.style = b.styles[len(b.styles)-1]
+	b.styles = b.styles[:len(b.styles)-1]
+}
+
+// addText 折叠空白后追加到当前行内内容
+func (b *blockBuilder) addText(s string) {
+	words := strings.Fields(s)
+	if len(words) == 0 {
+		if s != "" {
+			b.space = true
+		}
+		return
+	}
+	if r, _ := utf8.DecodeRuneInString(s); unicode.IsSpace(r) {
+		b.space = true
+	}
+	text := strings.Join(words, " ")
+	if b.space && len(b.spans) > 0 {
+		// 分隔空格优先并入无样式片段，避免出现带样式的首尾空格
+		last := b.spans[len(b.spans)-1]
+		switch lt := last["text"].(string); {
+		case strings.HasSuffix(lt, "\n"):
+		case spanStyleOf(last) == (spanStyle{}) || spanStyleOf(last) == b.style:
+			last["text"] = lt + " "
+		default:
+			text = " " + text
+		}
+	}
+	b.space = false
+	b.appendSpan(text)
+	if r, _ := utf8.DecodeLastRuneInString(s); unicode.IsSpace(r) {
+		b.space = true
+	}
+}
+
+// appendSpan 以当前样式追加文本；与上一片段样式相同时合并
+func (b *blockBuilder) appendSpan(text string) {
+	st := b.style
+	if n := len(b.spans); n > 0 && spanStyleOf(b.spans[n-1]) == st {
+		b.spans[n-1]["text"] = b.spans[n-1]["text"].(string) + text
+		return
+	}
+	span := map[string]any{"text": text}
+	if st.bold {
+		span["bold"] = true
+	}
+	if st.italic {
+		span["italic"] = true
+	}
+	if st.code {
+		span["code"] = true
+	}
+	if st.href != "" {
+		span["href"] = st.href
+	}
+	b.spans = append(b.spans, span)
+}
+
+func spanStyleOf(span map[string]any) spanStyle {
+	var st spanStyle
+	st.bold, _ = span["bold"].(bool)
+	st.italic, _ = span["italic"].(bool)
+	st.code, _ = span["code"].(bool)
+	st.href, _ = span["href"].(string)
+	return st
+}
+
+// takeInline 取出当前行内内容（首尾空白已去除）
+func (b *blockBuilder) takeInline() (string, []map[string]any) {
+	spans := b.spans
+	b.spans, b.space = nil, false
+	for len(spans) > 0 && strings.TrimSpace(spans[0]["text"].(string)) == "" {
+		spans = spans[1:]
+	}
+	for len(spans) > 0 && strings.TrimSpace(spans[len(spans)-1]["text"].(string)) == "" {
+		spans = spans[:len(spans)-1]
+	}
+	if len(spans) == 0 {
+		return "", nil
+	}
+	spans[0]["text"] = strings.TrimLeftFunc(spans[0]["text"].(string), unicode.IsSpace)
+	last := spans[len(spans)-1]
+	last["text"] = strings.TrimRightFunc(last["text"].(string), unicode.IsSpace)
+	var sb strings.Builder
+	for _, s := range spans {
+		sb.WriteString(s["text"].(string))
+	}
+	return sb.String(), spans
+}
+
+// flush 将暂存的行内内容落为 paragraph
+func (b *blockBuilder) flush() {
+	if text, spans := b.takeInline(); text != "" {
+		b.blocks = append(b.blocks, map[string]any{"type": "paragraph", "text": text, "spans": spans})
+	}
+}
+
+// buildList 构建列表块；li 内的段落并入条目文本，嵌套列表等其他块放入 children
+func buildList(n *html.Node) map[string]any {
+	var items []string
+	var entries []map[string]any
+	for li := n.FirstChild; li != nil; li = li.NextSibling {
+		if li.Type != html.ElementNode || li.DataAtom != atom.Li {
+			continue
+		}
+		sub := &blockBuilder{}
+		sub.walkChildren(li)
+		sub.flush()
+		entry := map[string]any{}
+		var texts []string
+		var spans, children []map[string]any
+		for _, blk := range sub.blocks {
+			if blk["type"] == "paragraph" {
+				if len(spans) > 0 {
+					spans = append(spans, map[string]any{"text": "\n"})
+				}
+				texts = append(texts, blk["text"].(string))
+				spans = append(spans, blk["spans"].([]map[string]any)...)
+				continue
+			}
+			children = append(children, blk)
+		}
+		text := strings.Join(texts, "\n")
+		if text == "" && len(children) == 0 {
+			continue
+		}
+		entry["text"] = text
+		if len(spans) > 0 {
+			entry["spans"] = spans
+		}
+		if len(children) > 0 {
+			entry["children"] = children
+		}
+		items = append(items, text)
+		entries = append(entries, entry)
+	}
+	if len(entries) == 0 {
+		return nil
+	}
+	return map[string]any{"type": "list", "ordered": n.DataAtom == atom.Ol, "items": items, "entries": entries}
+}
+
+// addTable 数据表格：按行收集单元格文本
+func (b *blockBuilder) addTable(n *html.Node) {
+	var rows [][]string
+	header := false
+	var visit func(*html.Node)
+	visit = func(n *html.Node) {
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if c.Type != html.ElementNode {
+				continue
+			}
+			if c.DataAtom != atom.Tr {
+				visit(c)
+				continue
+			}
+			var row []string
+			allTH := true
+			for td := c.FirstChild; td != nil; td = td.NextSibling {
+				if td.Type != html.ElementNode || (td.DataAtom != atom.Td && td.DataAtom != atom.Th) {
+					continue
+				}
+				allTH = allTH && td.DataAtom == atom.Th
+				row = append(row, strings.Join(strings.Fields(nodeText(td)), " "))
+			}
+			if len(rows) == 0 {
+				header = allTH || (c.Parent != nil && c.Parent.DataAtom == atom.Thead)
+			}
+			rows = append(rows, row)
+		}
+	}
+	visit(n)
+	if len(rows) > 0 {
+		b.blocks = append(b.blocks, map[string]any{"type": "table", "rows": rows, "header": header})
+	}
+}
+
+// walkLayoutTable 排版表格：单元格作为普通容器按块处理
+func (b *blockBuilder) walkLayoutTable(n *html.Node) {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.ElementNode && (c.DataAtom == atom.Td || c.DataAtom == atom.Th) {
+			b.flush()
+			b.walkChildren(c)
+			b.flush()
+			continue
+		}
+		if c.Type == html.ElementNode {
+			b.walkLayoutTable(c)
+		}
+	}
+}
+
+// isTrackingPixel 1x1 / 0x0 的追踪像素
+func isTrackingPixel(n *html.Node) bool {
+	small := func(v string) bool {
+		v = strings.TrimSuffix(strings.TrimSpace(v), "px")
+		i, err := strconv.Atoi(v)
+		return err == nil && i <= 1
+	}
+	return small(attr(n, "width")) && small(attr(n, "height"))
+}
+
+func cutPrefixFold(s, prefix string) (string, bool) {
+	if len(s) >= len(prefix) && strings.EqualFold(s[:len(prefix)], prefix) {
+		return s[len(prefix):], true
+	}
+	return s, false
+}
+
+// blocksText 拼接块文本（blockquote 等容器的 text 字段）
+func blocksText(blocks []map[string]any) string {
+	var parts []string
+	for _, blk := range blocks {
+		if t, ok := blk["text"].(string); ok && t != "" {
+			parts = append(parts, t)
+		}
+	}
+	return strings.Join(parts, "\n")
+}
@@ -0,0 +1,61 @@
+package parser
+
+import (
+	"reflect"
+	"testing"
+)
+
+func blockTypes(blocks []map[string]any) []string {
+	var out []string
+	for _, b := range blocks {
+		out = append(out, b["type"].(string))
+	}
+	return out
+}
+
+func TestBlocksDocumentOrder(t *testing.T) {
+	h := `<p>Intro Text</p><h2>Order <em>#42</em></h2><ul><li>One</li><li><p>Two</p><ol><li>Sub <i>a</i></li></ol></li></ul>
+<blockquote><p>Quoted</p></blockquote><table><tr><th>Name</th><th>Qty</th></tr><tr><td>A</td><td>3</td></tr></table>
+<pre><code class="language-go">x := 1</code></pre><hr><img src="cid:logo@x" alt="Logo"><img src="https://t.example/p.gif" width="1" height="1"><p>Hi <b>Bob</b>, <a href="https://ex.com">Visit</a></p>`
+	blocks := buildBlocksFromHTML(h, "")
+	want := []string{"paragraph", "heading", "list", "blockquote", "table", "code", "hr", "image", "paragraph"}
+	if got := blockTypes(blocks); !reflect.DeepEqual(got, want) {
+		t.Fatalf("order=%v", got)
+	}
+	if blocks[0]["text"] != "Intro Text" {
+		t.Fatalf("casing lost: %v", blocks[0]["text"])
+	}
+	if blocks[1]["level"] != "2" || blocks[1]["text"] != "Order #42" {
+		t.Fatalf("heading=%v", blocks[1])
+	}
+	list := blocks[2]
+	if !reflect.DeepEqual(list["items"], []string{"One", "Two"}) {
+		t.Fatalf("items=%v", list["items"])
+	}
+	nested := list["entries"].([]map[string]any)[1]["children"].([]map[string]any)[0]
+	if nested["ordered"] != true || !reflect.DeepEqual(nested["items"], []string{"Sub a"}) {
+		t.Fatalf("nested=%v", nested)
+	}
+	if !reflect.DeepEqual(blocks[4]["rows"], [][]string{{"Name", "Qty"}, {"A", "3"}}) || blocks[4]["header"] != true {
+		t.Fatalf("table=%v", blocks[4])
+	}
+	if blocks[5]["language"] != "go" || blocks[7]["content_id"] != "logo@x" {
+		t.Fatalf("code/image=%v %v", blocks[5], blocks[7])
+	}
+	wantSpans := []map[string]any{
+		{"text": "Hi "},
+		{"text": "Bob", "bold": true},
+		{"text": ", "},
+		{"text": "Visit", "href": "https://ex.com"},
+	}
+	if got := blocks[8]["spans"]; !reflect.DeepEqual(got, wantSpans) {
+		t.Fatalf("spans=%v", got)
+	}
+}
+
+func TestBlocksPlainFallback(t *testing.T) {
+	blocks := buildBlocksFromHTML("", "first\n\nsecond")
+	if got := blockTypes(blocks); !reflect.DeepEqual(got, []string{"paragraph", "paragraph"}) {
+		t.Fatalf("got %v", got)
+	}
+}
@@ -0,0 +1,244 @@
+package parser
+
+import (
+	"bytes"
+	"io"
+	mailpkg "net/mail"
+	"regexp"
+	"strings"
+)
+
+// Bounce 退信 / 投递状态通知（DSN）的结构化结果
+type Bounce struct {
+	Format            string            `json:"format"`                        // dsn（RFC 3464）| heuristic（非标准退信）
+	ReportingMTA      string            `json:"reporting_mta,omitempty"`       // 生成通知的 MTA
+	OriginalMessageID string            `json:"original_message_id,omitempty"` // 被退回邮件的 Message-ID（不含尖括号）
+	Recipients        []BounceRecipient `json:"recipients"`
+}
+
+// BounceRecipient 单个收件人的投递结果
+type BounceRecipient struct {
+	Recipient         string `json:"recipient"`                    // Final-Recipient
+	OriginalRecipient string `json:"original_recipient,omitempty"` // Original-Recipient（转发/别名前的地址）
+	Action            string `json:"action"`                       // failed | delayed | delivered | relayed | expanded
+	Status            string `json:"status,omitempty"`             // 增强状态码，如 5.1.1（5 永久失败，4 暂时失败）
+	Diagnostic        string `json:"diagnostic,omitempty"`         // 远端服务器返回的诊断信息
+	RemoteMTA         string `json:"remote_mta,omitempty"`
+}
+
+// buildBounce 识别退信：优先解析 message/delivery-status part（RFC 3464 / RFC 6533），
+// 否则对发件人或主题像退信的邮件从正文启发式提取收件人与错误码。非退信返回 nil。
+func buildBounce(parts []mimePart, hdr mailpkg.Header, body string) *Bounce {
+	var b *Bounce
+	for i := range parts {
+		p := &parts[i]
+		if p.MediaType == "message/delivery-status" || p.MediaType == "message/global-delivery-status" {
+			if b = parseDeliveryStatus(p.Body); b != nil {
+				break
+			}
+		}
+	}
+	if b == nil {
+		if !looksLikeBounce(hdr) {
+			return nil
+		}
+		if b = parseBounceText(hdr, body); b == nil {
+			return nil
+		}
+	}
+	b.OriginalMessageID = originalMessageID(parts, body)
+	return b
+}
+
+// parseDeliveryStatus 解析 DSN 字段组：首组为 per-message 字段，其后每组对应一个收件人
+func parseDeliveryStatus(data []byte) *Bounce {
+	groups := parseFieldGroups(string(data))
+	if len(groups) == 0 {
+		return nil
+	}
+	b := &Bounce{Format: "dsn"}
+	if _, ok := groups[0]["final-recipient"]; !ok {
+		b.ReportingMTA = dsnValue(groups[0]["reporting-mta"])
+		groups = groups[1:]
+	}
+	for _, g := range groups {
+		r := BounceRecipient{
+			Recipient:         dsnValue(g["final-recipient"]),
+			OriginalRecipient: dsnValue(g["original-recipient"]),
+			Action:            strings.ToLower(g["action"]),
+			Status:            statusCode(g["status"]),
+			Diagnostic:        dsnValue(g["diagnostic-code"]),
+			RemoteMTA:         dsnValue(g["remote-mta"]),
+		}
+		if r.Recipient == "" {
+			r.Recipient = r.OriginalRecipient
+		}
+		if r.Recipient == "" {
+			continue
+		}
+		if r.Status == "" {
+			r.Status = statusCode(r.Diagnostic)
+		}
+		b.Recipients = append(b.Recipients, r)
+	}
+	if len(b.Recipients) == 0 {
+		return nil
+	}
+	return b
+}
+
+// parseFieldGroups 按空行切分 "Name: value" 字段组（处理续行），键小写
+func parseFieldGroups(s string) []map[string]string {
+	var groups []map[string]string
+	var cur map[string]string
+	var last string
+	for _, line := range strings.Split(strings.ReplaceAll(s, "\r\n", "\n"), "\n") {
+		if strings.TrimSpace(line) == "" {
+			if cur != nil {
+				groups = append(groups, cur)
+				cur = nil
+			}
+			continue
+		}
+		if (line[0] == ' ' || line[0] == '\t') && cur != nil && last != "" {
+			cur[last] += " " + strings.TrimSpace(line)
+			continue
+		}
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		if cur == nil {
+			cur = make(map[string]string)
+		}
+		last = strings.ToLower(strings.TrimSpace(name))
+		if _, dup := cur[last]; !dup {
+			cur[last] = strings.TrimSpace(value)
+		}
+	}
+	if cur != nil {
+		groups = append(groups, cur)
+	}
+	return groups
+}
+
+// dsnValue 去掉 "rfc822; " / "smtp; " / "dns; " 等类型前缀
+func dsnValue(v string) string {
+	if typ, rest, ok := strings.Cut(v, ";"); ok && !strings.ContainsAny(typ, " @<") {
+		v = rest
+	}
+	return strings.Trim(strings.TrimSpace(v), "<>")
+}
+
+var (
+	enhancedStatusRe = regexp.MustCompile(`\b([245]\.\d{1,3}\.\d{1,3})\b`)
+	smtpReplyRe      = regexp.MustCompile(`\b([45]\d\d)[\s-]`)
+)
+
+// statusCode 提取增强状态码；只有 SMTP 回复码时退化为 5.0.0 / 4.0.0
+func statusCode(s string) string {
+	if m := enhancedStatusRe.FindStringSubmatch(s); m != nil {
+		return m[1]
+	}
+	if m := smtpReplyRe.FindStringSubmatch(s + " "); m != nil {
+		return m[1][:1] + ".0.0"
+	}
+	return ""
+}
+
+var (
+	bounceSenderRe  = regexp.MustCompile(`(?i)^(mailer-daemon|postmaster|mail-daemon|mailerdaemon)@`)
+	bounceSubjectRe = regexp.MustCompile(`(?i)(undeliver|undelivered mail|delivery status notification|delivery (has )?failed|delivery failure|failure notice|mail delivery (failed|system)|returned mail|could not be delivered|delivery delayed|退信|未能送达|无法投递|投递失败|系统退信)`)
+)
+
+// looksLikeBounce 非标准退信的识别条件：X-Failed-Recipients 头、退信发件人或退信主题
+func looksLikeBounce(hdr mailpkg.Header) bool {
+	if hdr.Get("X-Failed-Recipients") != "" {
+		return true
+	}
+	if from := parseAddress(hdr.Get("From")); from != nil && bounceSenderRe.MatchString(from.Address) {
+		return true
+	}
+	return bounceSubjectRe.MatchString(decodeHeader(hdr.Get("Subject")))
+}
+
+var (
+	bounceAddrLineRe   = regexp.MustCompile(`^\s*<?([^\s<>@:;,"]+@[^\s<>@:;,"]+\.[A-Za-z]{2,})>?:?\s*$`)
+	bounceAddrInlineRe = regexp.MustCompile(`(?i)(?:delivered to|delivery to|failed recipients?:|recipients? address rejected:|could not be delivered to:?)\s*<?([^\s<>@:;,"]+@[^\s<>@:;,"]+\.[A-Za-z]{2,})>?`)
+	bounceDelayRe      = regexp.MustCompile(`(?i)(delay|will be retried|still trying|暂时|延迟)`)
+	// 正文中附带的原邮件从这些行开始，其后的地址不再视为收件人
+	bounceCopyRe = regexp.MustCompile(`(?i)^\s*(-+\s*(original message|this is a copy|below this line|undelivered message)|(received|return-path):\s)`)
+)
+
+// parseBounceText 启发式解析：收件人来自 X-Failed-Recipients，或正文中独占一行的地址
+// （qmail "<a@b>:"、Exim 缩进地址）及 "wasn't delivered to a@b" 一类句式；
+// 诊断取第一条带 SMTP 回复码的行。
+func parseBounceText(hdr mailpkg.Header, body string) *Bounce {
+	var recipients []string
+	seen := make(map[string]bool)
+	add := func(addr string) {
+		addr = strings.TrimSpace(strings.Trim(addr, "<>"))
+		key := strings.ToLower(addr)
+		if addr == "" || seen[key] || bounceSenderRe.MatchString(addr) {
+			return
+		}
+		seen[key] = true
+		recipients = append(recipients, addr)
+	}
+	for _, a := range strings.Split(hdr.Get("X-Failed-Recipients"), ",") {
+		add(a)
+	}
+	fromHeader := len(recipients) > 0
+	diagnostic := ""
+	for _, line := range strings.Split(strings.ReplaceAll(body, "\r\n", "\n"), "\n") {
+		if bounceCopyRe.MatchString(line) {
+			break
+		}
+		if !fromHeader {
+			if m := bounceAddrLineRe.FindStringSubmatch(line); m != nil {
+				add(m[1])
+			} else if m := bounceAddrInlineRe.FindStringSubmatch(line); m != nil {
+				add(m[1])
+			}
+		}
+		if diagnostic == "" && smtpReplyRe.MatchString(line+" ") {
+			diagnostic = strings.Join(strings.Fields(line), " ")
+		}
+	}
+	if len(recipients) == 0 {
+		return nil
+	}
+	status := statusCode(diagnostic)
+	action := "failed"
+	if strings.HasPrefix(status, "4") || (status == "" && bounceDelayRe.MatchString(decodeHeader(hdr.Get("Subject")))) {
+		action = "delayed"
+	}
+	b := &Bounce{Format: "heuristic"}
+	for _, r := range recipients {
+		b.Recipients = append(b.Recipients, BounceRecipient{Recipient: r, Action: action, Status: status, Diagnostic: diagnostic})
+	}
+	return b
+}
+
+var quotedMessageIDRe = regexp.MustCompile(`(?im)^\s*message-id:\s*(<[^>\s]+>)`)
+
+// originalMessageID 从退信附带的原邮件（message/rfc822 或 text/rfc822-headers）中取 Message-ID，
+// 没有附带时查找正文中引用的原始头部
+func originalMessageID(parts []mimePart, body string) string {
+	for i := range parts {
+		switch parts[i].MediaType {
+		case "message/rfc822", "message/global", "text/rfc822-headers", "message/global-headers":
+			// text/rfc822-headers 可能缺少头部结束的空行
+			r := io.MultiReader(bytes.NewReader(bytes.TrimLeft(parts[i].Body, "\r\n")), strings.NewReader("\r\n\r\n"))
+			if m, err := mailpkg.ReadMessage(r); err == nil {
+				if id := firstMsgID(m.Header.Get("Message-Id")); id != "" {
+					return id
+				}
+			}
+		}
+	}
+	if m := quotedMessageIDRe.FindStringSubmatch(body); m != nil {
+		return firstMsgID(m[1])
+	}
+	return ""
+}
@@ -0,0 +1,102 @@
+package parser
+
+import (
+	"testing"
+
+	"monitor-imap-webhook/internal/config"
+)
+
+func TestBounceDSN(t *testing.T) {
+	raw := "From: Mail Delivery System <MAILER-DAEMON@mx.example.com>\r\n" +
+		"Subject: Undelivered Mail Returned to Sender\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: multipart/report; report-type=delivery-status; boundary=r\r\n\r\n" +
+		"--r\r\nContent-Type: text/plain\r\n\r\nI'm sorry to have to inform you that your message could not be delivered.\r\n" +
+		"--r\r\nContent-Type: message/delivery-status\r\n\r\n" +
+		"Reporting-MTA: dns; mx.example.com\r\nArrival-Date: Mon, 1 Jan 2024 10:00:00 +0800\r\n\r\n" +
+		"Final-Recipient: rfc822; nobody@example.org\r\nOriginal-Recipient: rfc822;alias@example.org\r\n" +
+		"Action: failed\r\nStatus: 5.1.1\r\nRemote-MTA: dns; mx.example.org\r\n" +
+		"Diagnostic-Code: smtp; 550 5.1.1 <nobody@example.org>: Recipient address\r\n rejected: User unknown\r\n\r\n" +
+		"Final-Recipient: rfc822; busy@example.org\r\nAction: delayed\r\nStatus: 4.2.2\r\n\r\n" +
+		"--r\r\nContent-Type: text/rfc822-headers\r\n\r\n" +
+		"From: alice@example.com\r\nTo: nobody@example.org\r\nMessage-ID: <orig-1@example.com>\r\nSubject: hi\r\n" +
+		"--r--\r\n"
+	msg, err := parseRaw([]byte(raw), nil, &config.Config{HTMLToTextMode: "simple"})
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	b := msg.Bounce
+	if b == nil || b.Format != "dsn" || b.ReportingMTA != "mx.example.com" || b.OriginalMessageID != "orig-1@example.com" {
+		t.Fatalf("bounce=%+v", b)
+	}
+	if len(b.Recipients) != 2 {
+		t.Fatalf("recipients=%+v", b.Recipients)
+	}
+	r := b.Recipients[0]
+	if r.Recipient != "nobody@example.org" || r.OriginalRecipient != "alias@example.org" || r.Action != "failed" || r.Status != "5.1.1" || r.RemoteMTA != "mx.example.org" {
+		t.Fatalf("recipient=%+v", r)
+	}
+	if r.Diagnostic != "550 5.1.1 <nobody@example.org>: Recipient address rejected: User unknown" {
+		t.Fatalf("diagnostic=%q", r.Diagnostic)
+	}
+	if b.Recipients[1].Action != "delayed" || b.Recipients[1].Status != "4.2.2" {
+		t.Fatalf("second=%+v", b.Recipients[1])
+	}
+}
+
+func TestBounceHeuristic(t *testing.T) {
+	cases := []struct {
+		name, raw, recipient, status, msgID string
+	}{
+		{
+			name: "qmail",
+			raw: "From: MAILER-DAEMON@mail.example.net\r\nSubject: failure notice\r\n\r\n" +
+				"Hi. This is the qmail-send program at mail.example.net.\r\nI'm afraid I wasn't able to deliver your message to the following addresses.\r\n\r\n" +
+				"<gone@example.org>:\r\n192.0.2.1 does not like recipient.\r\nRemote host said: 550 No such user here\r\n\r\n" +
+				"--- Below this line is a copy of the message.\r\n\r\nReturn-Path: <alice@example.com>\r\nMessage-ID: <q-1@example.com>\r\nTo: other@example.org\r\n",
+			recipient: "gone@example.org", status: "5.0.0", msgID: "q-1@example.com",
+		},
+		{
+			name: "exim",
+			raw: "From: Mail Delivery System <Mailer-Daemon@exim.example.net>\r\nSubject: Mail delivery failed: returning message to sender\r\nX-Failed-Recipients: full@example.org\r\n\r\n" +
+				"This message was created automatically by mail delivery software.\r\n\r\n" +
+				"  full@example.org\r\n    host mx.example.org [192.0.2.2]\r\n    SMTP error from remote mail server after RCPT TO:<full@example.org>:\r\n    452 4.2.2 Mailbox full\r\n",
+			recipient: "full@example.org", status: "4.2.2",
+		},
+		{
+			name: "gmail",
+			raw: "From: Mail Delivery Subsystem <mailer-daemon@googlemail.com>\r\nSubject: Delivery Status Notification (Failure)\r\n\r\n" +
+				"Your message wasn't delivered to missing@example.org because the address couldn't be found.\r\n\r\n" +
+				"The response was:\r\n\r\n550 5.1.1 The email account that you tried to reach does not exist.\r\n",
+			recipient: "missing@example.org", status: "5.1.1",
+		},
+	}
+	for _, c := range cases {
+		msg, err := parseRaw([]byte(c.raw), nil, &config.Config{HTMLToTextMode: "simple"})
+		if err != nil {
+			t.Fatalf("%s: parse: %v", c.name, err)
+		}
+		b := msg.Bounce
+		if b == nil || b.Format != "heuristic" || len(b.Recipients) != 1 {
+			t.Fatalf("%s: bounce=%+v", c.name, b)
+		}
+		r := b.Recipients[0]
+		if r.Recipient != c.recipient || r.Status != c.status || r.Diagnostic == "" || b.OriginalMessageID != c.msgID {
+			t.Fatalf("%s: recipient=%+v msgid=%q", c.name, r, b.OriginalMessageID)
+		}
+		if want := map[bool]string{true: "delayed", false: "failed"}[c.status[0] == '4']; r.Action != want {
+			t.Fatalf("%s: action=%s", c.name, r.Action)
+		}
+	}
+}
+
+func TestNotBounce(t *testing.T) {
+	raw := "From: bob@example.com\r\nSubject: lunch?\r\n\r\nping me at bob@example.com\r\n550 people attended\r\n"
+	msg, err := parseRaw([]byte(raw), nil, &config.Config{HTMLToTextMode: "simple"})
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if msg.Bounce != nil {
+		t.Fatalf("unexpected bounce: %+v", msg.Bounce)
+	}
+}
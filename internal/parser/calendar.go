@@ -0,0 +1,377 @@
+package parser
+
+import (
+	"strconv"
+	"strings"
+	"time"
+	_ "time/tzdata" // 容器镜像可能缺少系统时区库
+)
+
+// Calendar 邮件中 text/calendar（会议邀请 / 更新 / 取消）的解析结果
+type Calendar struct {
+	Method string          `json:"method,omitempty"` // REQUEST | REPLY | CANCEL | PUBLISH ...
+	Events []CalendarEvent `json:"events"`
+}
+
+// CalendarEvent 单个 VEVENT
+type CalendarEvent struct {
+	UID          string             `json:"uid,omitempty"`
+	Summary      string             `json:"summary,omitempty"`
+	Description  string             `json:"description,omitempty"`
+	Location     string             `json:"location,omitempty"`
+	Start        string             `json:"start,omitempty"` // RFC 3339；全天事件为 YYYY-MM-DD；浮动时间无时区后缀
+	End          string             `json:"end,omitempty"`
+	AllDay       bool               `json:"all_day,omitempty"`
+	TimeZone     string             `json:"timezone,omitempty"` // DTSTART 的 TZID
+	Organizer    *CalendarAttendee  `json:"organizer,omitempty"`
+	Attendees    []CalendarAttendee `json:"attendees,omitempty"`
+	Recurrence   []string           `json:"recurrence,omitempty"`    // RRULE / RDATE / EXDATE 原始行
+	RecurrenceID string             `json:"recurrence_id,omitempty"` // 重复事件中被修改的单次实例
+	Sequence     int                `json:"sequence,omitempty"`
+	Status       string             `json:"status,omitempty"` // CONFIRMED | TENTATIVE | CANCELLED
+	Cancelled    bool               `json:"cancelled,omitempty"`
+	URL          string             `json:"url,omitempty"`
+}
+
+// CalendarAttendee 组织者 / 参会人
+type CalendarAttendee struct {
+	Name   string `json:"name,omitempty"`
+	Email  string `json:"email,omitempty"`
+	Role   string `json:"role,omitempty"`   // REQ-PARTICIPANT | OPT-PARTICIPANT | CHAIR ...
+	Status string `json:"status,omitempty"` // PARTSTAT：NEEDS-ACTION | ACCEPTED | DECLINED | TENTATIVE
+	RSVP   bool   `json:"rsvp,omitempty"`
+}
+
+// maxCalendarEvents 单封邮件最多解析的 VEVENT 数量
+const maxCalendarEvents = 50
+
+// icsProp 展开后的一行属性
+type icsProp struct {
+	Name   string
+	Params map[string]string
+	Value  string
+}
+
+// buildCalendar 解析全部 text/calendar（及 .ics 附件）part；同一事件（UID + RECURRENCE-ID）
+// 在多个 part 中重复出现时只保留一次（Outlook 常同时内联与附带 invite.ics）。
+func buildCalendar(parts []mimePart) *Calendar {
+	var cal *Calendar
+	seen := make(map[string]bool)
+	for i := range parts {
+		p := &parts[i]
+		if !isCalendarPart(p) {
+			continue
+		}
+		text, _ := decodeCharset(p.Body, p.Params["charset"])
+		c := parseICS(text)
+		if c == nil {
+			continue
+		}
+		if cal == nil {
+			cal = &Calendar{}
+		}
+		if cal.Method == "" {
+			cal.Method = c.Method
+		}
+		if cal.Method == "" {
+			cal.Method = strings.ToUpper(p.Params["method"])
+		}
+		for _, ev := range c.Events {
+			key := ev.UID + "|" + ev.RecurrenceID
+			if ev.UID != "" && seen[key] {
+				continue
+			}
+			seen[key] = true
+			cal.Events = append(cal.Events, ev)
+		}
+	}
+	if cal == nil || len(cal.Events) == 0 {
+		return nil
+	}
+	if cal.Method == "CANCEL" {
+		for i := range cal.Events {
+			cal.Events[i].Cancelled = true
+		}
+	}
+	return cal
+}
+
+func isCalendarPart(p *mimePart) bool {
+	switch p.MediaType {
+	case "text/calendar", "application/ics":
+		return true
+	}
+	return strings.HasSuffix(strings.ToLower(p.Filename()), ".ics")
+}
+
+// parseICS 解析 iCalendar 文本（RFC 5545），只关心 VCALENDAR 的 METHOD、VEVENT 与 VTIMEZONE
+func parseICS(text string) *Calendar {
+	props := unfoldICS(text)
+	if len(props) == 0 {
+		return nil
+	}
+	cal := &Calendar{}
+	zones := parseVTimezones(props)
+	var stack []string
+	var ev *CalendarEvent
+	for _, p := range props {
+		switch p.Name {
+		case "BEGIN":
+			stack = append(stack, strings.ToUpper(p.Value))
+			if strings.EqualFold(p.Value, "VEVENT") && len(cal.Events) < maxCalendarEvents {
+				ev = &CalendarEvent{}
+			}
+			continue
+		case "END":
+			if len(stack) > 0 {
+				stack = stack[:len(stack)-1]
+			}
+			if strings.EqualFold(p.Value, "VEVENT") && ev != nil {
+				if ev.Status == "CANCELLED" {
+					ev.Cancelled = true
+				}
+				cal.Events = append(cal.Events, *ev)
+				ev = nil
+			}
+			continue
+		}
+		if len(stack) == 0 {
+			continue
+		}
+		switch stack[len(stack)-1] {
+		case "VCALENDAR":
+			if p.Name == "METHOD" {
+				cal.Method = strings.ToUpper(strings.TrimSpace(p.Value))
+			}
+		case "VEVENT":
+			if ev != nil {
+				applyEventProp(ev, p, zones)
+			}
+		}
+	}
+	if len(cal.Events) == 0 {
+		return nil
+	}
+	return cal
+}
+
+func applyEventProp(ev *CalendarEvent, p icsProp, zones map[string]*time.Location) {
+	switch p.Name {
+	case "UID":
+		ev.UID = p.Value
+	case "SUMMARY":
+		ev.Summary = unescapeICS(p.Value)
+	case "DESCRIPTION":
+		ev.Description = unescapeICS(p.Value)
+	case "LOCATION":
+		ev.Location = unescapeICS(p.Value)
+	case "URL":
+		ev.URL = p.Value
+	case "DTSTART":
+		ev.Start, ev.AllDay = formatICSTime(p, zones)
+		ev.TimeZone = p.Params["TZID"]
+	case "DTEND":
+		ev.End, _ = formatICSTime(p, zones)
+	case "RECURRENCE-ID":
+		ev.RecurrenceID, _ = formatICSTime(p, zones)
+	case "RRULE", "RDATE", "EXDATE":
+		ev.Recurrence = append(ev.Recurrence, p.Name+":"+p.Value)
+	case "SEQUENCE":
+		ev.Sequence, _ = strconv.Atoi(strings.TrimSpace(p.Value))
+	case "STATUS":
+		ev.Status = strings.ToUpper(strings.TrimSpace(p.Value))
+	case "ORGANIZER":
+		a := parseICSAttendee(p)
+		ev.Organizer = &a
+	case "ATTENDEE":
+		ev.Attendees = append(ev.Attendees, parseICSAttendee(p))
+	}
+}
+
+func parseICSAttendee(p icsProp) CalendarAttendee {
+	a := CalendarAttendee{
+		Name:   strings.Trim(p.Params["CN"], `"`),
+		Role:   strings.ToUpper(p.Params["ROLE"]),
+		Status: strings.ToUpper(p.Params["PARTSTAT"]),
+		RSVP:   strings.EqualFold(p.Params["RSVP"], "TRUE"),
+	}
+	v := strings.TrimSpace(p.Value)
+	if addr, ok := cutPrefixFold(v, "mailto:"); ok {
+		a.Email = addr
+	} else if strings.Contains(v, "@") {
+		a.Email = v
+	}
+	if a.Email == "" && strings.Contains(p.Params["EMAIL"], "@") {
+		a.Email = p.Params["EMAIL"]
+	}
+	return a
+}
+
+// formatICSTime 将 DATE / DATE-TIME 值转为 RFC 3339（全天事件为日期）。
+// 时区优先使用 IANA 名，其次 Windows 时区名映射，再次邮件内 VTIMEZONE 的标准时偏移。
+func formatICSTime(p icsProp, zones map[string]*time.Location) (string, bool) {
+	v := strings.TrimSpace(p.Value)
+	if strings.EqualFold(p.Params["VALUE"], "DATE") || len(v) == 8 {
+		t, err := time.Parse("20060102", v)
+		if err != nil {
+			return v, true
+		}
+		return t.Format("2006-01-02"), true
+	}
+	if strings.HasSuffix(v, "Z") {
+		t, err := time.Parse("20060102T150405Z", v)
+		if err != nil {
+			return v, false
+		}
+		return t.UTC().Format(time.RFC3339), false
+	}
+	if tzid := strings.Trim(p.Params["TZID"], `"`); tzid != "" {
+		if loc := resolveTZ(tzid, zones); loc != nil {
+			if t, err := time.ParseInLocation("20060102T150405", v, loc); err == nil {
+				return t.Format(time.RFC3339), false
+			}
+		}
+	}
+	t, err := time.Parse("20060102T150405", v)
+	if err != nil {
+		return v, false
+	}
+	return t.Format("2006-01-02T15:04:05"), false // 浮动时间
+}
+
+// windowsZones Outlook / Exchange 常见的 Windows 时区名
+var windowsZones = map[string]string{
+	"China Standard Time":            "Asia/Shanghai",
+	"Taipei Standard Time":           "Asia/Taipei",
+	"Tokyo Standard Time":            "Asia/Tokyo",
+	"Korea Standard Time":            "Asia/Seoul",
+	"Singapore Standard Time":        "Asia/Singapore",
+	"India Standard Time":            "Asia/Kolkata",
+	"GMT Standard Time":              "Europe/London",
+	"W. Europe Standard Time":        "Europe/Berlin",
+	"Romance Standard Time":          "Europe/Paris",
+	"Central Europe Standard Time":   "Europe/Budapest",
+	"Russian Standard Time":          "Europe/Moscow",
+	"Eastern Standard Time":          "America/New_York",
+	"Central Standard Time":          "America/Chicago",
+	"Mountain Standard Time":         "America/Denver",
+	"Pacific Standard Time":          "America/Los_Angeles",
+	"AUS Eastern Standard Time":      "Australia/Sydney",
+	"UTC":                            "UTC",
+	"Coordinated Universal Time":     "UTC",
+	"E. South America Standard Time": "America/Sao_Paulo",
+}
+
+func resolveTZ(tzid string, zones map[string]*time.Location) *time.Location {
+	name := strings.TrimPrefix(tzid, "/") // 部分客户端使用 "/Asia/Shanghai" 形式
+	if loc, err := time.LoadLocation(name); err == nil {
+		return loc
+	}
+	if iana, ok := windowsZones[name]; ok {
+		if loc, err := time.LoadLocation(iana); err == nil {
+			return loc
+		}
+	}
+	return zones[tzid]
+}
+
+// parseVTimezones 从 VTIMEZONE 中取 STANDARD 的 TZOFFSETTO，作为无法识别时区名时的固定偏移（不处理夏令时）
+func parseVTimezones(props []icsProp) map[string]*time.Location {
+	zones := make(map[string]*time.Location)
+	tzid, inStandard := "", false
+	for _, p := range props {
+		switch {
+		case p.Name == "BEGIN" && strings.EqualFold(p.Value, "VTIMEZONE"):
+			tzid = ""
+		case p.Name == "BEGIN" && strings.EqualFold(p.Value, "STANDARD"):
+			inStandard = true
+		case p.Name == "END" && strings.EqualFold(p.Value, "STANDARD"):
+			inStandard = false
+		case p.Name == "TZID":
+			tzid = p.Value
+		case p.Name == "TZOFFSETTO" && inStandard && tzid != "":
+			if off, ok := parseUTCOffset(p.Value); ok {
+				zones[tzid] = time.FixedZone(tzid, off)
+			}
+		}
+	}
+	return zones
+}
+
+// parseUTCOffset 解析 +0800 / -0530 / +053000
+func parseUTCOffset(v string) (int, bool) {
+	v = strings.TrimSpace(v)
+	if len(v) < 5 || (v[0] != '+' && v[0] != '-') {
+		return 0, false
+	}
+	h, err1 := strconv.Atoi(v[1:3])
+	m, err2 := strconv.Atoi(v[3:5])
+	if err1 != nil || err2 != nil {
+		return 0, false
+	}
+	off := h*3600 + m*60
+	if v[0] == '-' {
+		off = -off
+	}
+	return off, true
+}
+
+// unfoldICS 展开折行并拆分属性名 / 参数 / 值
+func unfoldICS(text string) []icsProp {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	var lines []string
+	for _, l := range strings.Split(text, "\n") {
+		if (strings.HasPrefix(l, " ") || strings.HasPrefix(l, "\t")) && len(lines) > 0 {
+			lines[len(lines)-1] += l[1:]
+			continue
+		}
+		lines = append(lines, strings.TrimRight(l, "\r"))
+	}
+	var props []icsProp
+	for _, l := range lines {
+		if l == "" {
+			continue
+		}
+		if p, ok := parseICSLine(l); ok {
+			props = append(props, p)
+		}
+	}
+	return props
+}
+
+// parseICSLine 解析 NAME;P1=v1;P2="v;2":value（引号内的 ; 与 : 不作为分隔符）
+func parseICSLine(l string) (icsProp, bool) {
+	inQuote := false
+	colon := -1
+	for i := 0; i < len(l); i++ {
+		if l[i] == '"' {
+			inQuote = !inQuote
+		} else if l[i] == ':' && !inQuote {
+			colon = i
+			break
+		}
+	}
+	if colon <= 0 {
+		return icsProp{}, false
+	}
+	head, value := l[:colon], l[colon+1:]
+	fields := splitParams(head, ';')
+	if len(fields) == 0 {
+		return icsProp{}, false
+	}
+	p := icsProp{Name: strings.ToUpper(strings.TrimSpace(fields[0])), Params: make(map[string]string), Value: value}
+	for _, f := range fields[1:] {
+		k, v, ok := strings.Cut(f, "=")
+		if !ok {
+			continue
+		}
+		p.Params[strings.ToUpper(strings.TrimSpace(k))] = strings.Trim(v, `"`)
+	}
+	return p, true
+}
+
+var icsUnescaper = strings.NewReplacer(`\n`, "\n", `\N`, "\n", `\,`, ",", `\;`, ";", `\\`, `\`)
+
+func unescapeICS(v string) string {
+	return strings.TrimSpace(icsUnescaper.Replace(v))
+}
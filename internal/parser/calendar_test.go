@@ -0,0 +1,76 @@
+package parser
+
+import (
+	"strings"
+	"testing"
+
+	"monitor-imap-webhook/internal/config"
+)
+
+const inviteICS = "BEGIN:VCALENDAR\r\n" +
+	"METHOD:REQUEST\r\n" +
+	"PRODID:Microsoft Exchange Server 2010\r\n" +
+	"BEGIN:VTIMEZONE\r\nTZID:Custom Zone\r\nBEGIN:STANDARD\r\nDTSTART:16010101T000000\r\nTZOFFSETFROM:+0800\r\nTZOFFSETTO:+0800\r\nEND:STANDARD\r\nEND:VTIMEZONE\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:040000008200E00074C5B7101A82E008\r\n" +
+	"SUMMARY;LANGUAGE=zh-CN:周会\\, 第 3 季度\r\n" +
+	"DTSTART;TZID=China Standard Time:20240105T100000\r\n" +
+	"DTEND;TZID=Custom Zone:20240105T110000\r\n" +
+	"LOCATION:会议室 A\r\n" +
+	"ORGANIZER;CN=\"Zhang, San\":mailto:zhang@example.com\r\n" +
+	"ATTENDEE;ROLE=REQ-PARTICIPANT;PARTSTAT=NEEDS-ACTION;RSVP=TRUE;CN=Li Si:mailto:l\r\n" +
+	" isi@example.com\r\n" +
+	"RRULE:FREQ=WEEKLY;BYDAY=FR\r\n" +
+	"DESCRIPTION:第一行\\n第二行\r\n" +
+	"SEQUENCE:2\r\n" +
+	"BEGIN:VALARM\r\nACTION:DISPLAY\r\nDESCRIPTION:Reminder\r\nEND:VALARM\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\nUID:allday@example.com\r\nSUMMARY:Holiday\r\nDTSTART;VALUE=DATE:20240201\r\nDTSTART:20240202T090000Z\r\nEND:VEVENT\r\n" +
+	"END:VCALENDAR\r\n"
+
+func TestParseICS(t *testing.T) {
+	cal := parseICS(inviteICS)
+	if cal == nil || cal.Method != "REQUEST" || len(cal.Events) != 2 {
+		t.Fatalf("cal=%+v", cal)
+	}
+	ev := cal.Events[0]
+	if ev.Summary != "周会, 第 3 季度" || ev.Location != "会议室 A" || ev.Description != "第一行\n第二行" {
+		t.Fatalf("text fields: %+v", ev)
+	}
+	if ev.Start != "2024-01-05T10:00:00+08:00" || ev.End != "2024-01-05T11:00:00+08:00" || ev.TimeZone != "China Standard Time" {
+		t.Fatalf("times: start=%s end=%s tz=%s", ev.Start, ev.End, ev.TimeZone)
+	}
+	if ev.Organizer == nil || ev.Organizer.Name != "Zhang, San" || ev.Organizer.Email != "zhang@example.com" {
+		t.Fatalf("organizer=%+v", ev.Organizer)
+	}
+	if len(ev.Attendees) != 1 || ev.Attendees[0].Email != "lisi@example.com" || !ev.Attendees[0].RSVP || ev.Attendees[0].Status != "NEEDS-ACTION" {
+		t.Fatalf("attendees=%+v", ev.Attendees)
+	}
+	if len(ev.Recurrence) != 1 || ev.Recurrence[0] != "RRULE:FREQ=WEEKLY;BYDAY=FR" || ev.Sequence != 2 {
+		t.Fatalf("recurrence=%v sequence=%d", ev.Recurrence, ev.Sequence)
+	}
+	if day := cal.Events[1]; day.Start != "2024-02-02T09:00:00Z" {
+		t.Fatalf("last DTSTART wins: %+v", day)
+	}
+}
+
+func TestCalendarCancelAndDedup(t *testing.T) {
+	ics := strings.Replace(inviteICS, "METHOD:REQUEST", "METHOD:CANCEL", 1)
+	raw := "Subject: Canceled: 周会\r\nMIME-Version: 1.0\r\nContent-Type: multipart/mixed; boundary=b\r\n\r\n" +
+		"--b\r\nContent-Type: text/plain\r\n\r\ncancelled\r\n" +
+		"--b\r\nContent-Type: text/calendar; charset=utf-8; method=CANCEL\r\n\r\n" + ics +
+		"--b\r\nContent-Type: application/ics; name=invite.ics\r\nContent-Disposition: attachment; filename=invite.ics\r\n\r\n" + ics +
+		"--b--\r\n"
+	msg, err := parseRaw([]byte(raw), nil, &config.Config{HTMLToTextMode: "simple"})
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if msg.Calendar == nil || msg.Calendar.Method != "CANCEL" || len(msg.Calendar.Events) != 2 {
+		t.Fatalf("calendar=%+v", msg.Calendar)
+	}
+	for _, ev := range msg.Calendar.Events {
+		if !ev.Cancelled {
+			t.Fatalf("event not cancelled: %+v", ev)
+		}
+	}
+}
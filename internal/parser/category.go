@@ -0,0 +1,116 @@
+package parser
+
+import (
+	mailpkg "net/mail"
+	"regexp"
+	"strings"
+)
+
+// 邮件分类
+const (
+	CategoryTransactional = "transactional" // 订单、收据、验证码、密码重置等一对一系统邮件
+	CategoryNewsletter    = "newsletter"    // 营销、订阅、邮件列表
+	CategoryNotification  = "notification"  // 监控告警、代码托管、工单等自动通知
+	CategoryPersonal      = "personal"      // 人与人之间的往来
+)
+
+// espHeaders 邮件服务商（ESP）头部前缀 → 更可能的分类（空表示只说明是程序发出）
+var espHeaders = []struct{ prefix, category string }{
+	{"X-Mailchimp-", CategoryNewsletter}, {"X-Mc-User", CategoryNewsletter}, {"X-Campaign", CategoryNewsletter},
+	{"X-Newsletter", CategoryNewsletter}, {"X-Listmonk-", CategoryNewsletter},
+	{"X-Mandrill-", CategoryTransactional}, {"X-Pm-Message-Id", CategoryTransactional}, {"X-Postmark-", CategoryTransactional},
+	{"X-Sg-Eid", ""}, {"X-Sendgrid-", ""}, {"X-Mailgun-", ""}, {"X-Ses-Outgoing", ""}, {"X-Sparkpost-", ""},
+	{"X-Msys-Api", ""}, {"X-Brevo-", ""}, {"X-Sib-Id", ""}, {"Feedback-Id", ""},
+	{"X-Github-Reason", CategoryNotification}, {"X-Gitlab-", CategoryNotification}, {"X-Jira-Fingerprint", CategoryNotification},
+	{"X-Jenkins-", CategoryNotification}, {"X-Zabbix-", CategoryNotification}, {"X-Pagerduty-", CategoryNotification},
+}
+
+// 发件地址本地部分的典型模式
+var (
+	newsletterSenderRe     = regexp.MustCompile(`(?i)^(newsletters?|news|marketing|promo(tions?)?|digest|deals|offers|updates|hello|info|edm)([._+-]|$)`)
+	notificationSenderRe   = regexp.MustCompile(`(?i)^(no-?reply|do-?not-?reply|donotreply|notifications?|notify|alerts?|alerting|monitor(ing)?|system|daemon|mailer-daemon|postmaster|builds?|ci|jira|github|gitlab)([._+-]|$)`)
+	transactionalSenderRe  = regexp.MustCompile(`(?i)^(billing|invoices?|receipts?|orders?|payments?|accounts?|security|verify|verification|auth|support|service|shipping)([._+-]|$)`)
+	transactionalSubjectRe = regexp.MustCompile(`(?i)(\border\b|receipt|invoice|payment|verification code|verify your|confirm your|password reset|reset your password|one-time (pass)?code|\botp\b|shipped|shipping|delivery|订单|发票|收据|验证码|校验码|支付|付款|密码重置|重置密码|发货|物流|账单)`)
+	notificationSubjectRe  = regexp.MustCompile(`(?i)(\[(alert|firing|resolved|warning|critical)|\balert\b|告警|报警|build (failed|succeeded|passed|fixed)|pipeline|\bci\b|\bjob\b.*(failed|succeeded)|pull request|merge request|\bissue\b|工单|通知)`)
+)
+
+// classify 按头部、发件人、主题与 HTML/文本比例启发式分类；没有程序化特征的邮件归为 personal
+func classify(hdr mailpkg.Header, msg *Message, rawHTML, body string) string {
+	score := map[string]int{}
+	automated := false // 是否存在程序发信的特征
+
+	if msg.ListID != "" {
+		score[CategoryNewsletter] += 2
+		automated = true
+	}
+	if msg.Unsubscribe != nil {
+		score[CategoryNewsletter] += 2
+		automated = true
+	}
+	switch strings.ToLower(strings.TrimSpace(hdr.Get("Precedence"))) {
+	case "bulk", "list", "junk":
+		score[CategoryNewsletter] += 2
+		automated = true
+	}
+	if a := msg.AutoMail; a != nil && (a.Kind == AutoGenerated || a.Kind == AutoReply) {
+		score[CategoryNotification] += 2
+		automated = true
+	}
+	for key := range hdr {
+		for _, e := range espHeaders {
+			if strings.HasPrefix(key, e.prefix) {
+				automated = true
+				if e.category != "" {
+					score[e.category] += 3
+				}
+			}
+		}
+	}
+
+	local := ""
+	if msg.FromAddress != nil {
+		if i := strings.LastIndexByte(msg.FromAddress.Address, '@'); i > 0 {
+			local = msg.FromAddress.Address[:i]
+		}
+	}
+	switch {
+	case notificationSenderRe.MatchString(local):
+		score[CategoryNotification] += 2
+		automated = true
+	case newsletterSenderRe.MatchString(local):
+		score[CategoryNewsletter]++
+	case transactionalSenderRe.MatchString(local):
+		score[CategoryTransactional]++
+	}
+	if transactionalSubjectRe.MatchString(msg.Subject) {
+		score[CategoryTransactional] += 2
+	}
+	if notificationSubjectRe.MatchString(msg.Subject) {
+		score[CategoryNotification]++
+	}
+
+	// 营销邮件 HTML 模板庞大、链接多，而可见文字很少
+	if rawHTML != "" {
+		text := len(strings.TrimSpace(body))
+		if text == 0 || len(rawHTML)/max(text, 1) >= 10 {
+			score[CategoryNewsletter]++
+		}
+		if strings.Count(strings.ToLower(rawHTML), "href=") >= 15 {
+			score[CategoryNewsletter]++
+		}
+	}
+
+	if !automated && score[CategoryNewsletter] < 2 {
+		return CategoryPersonal
+	}
+	best, bestScore := CategoryPersonal, 0
+	for _, c := range []string{CategoryTransactional, CategoryNotification, CategoryNewsletter} { // 同分时优先前者
+		if score[c] > bestScore {
+			best, bestScore = c, score[c]
+		}
+	}
+	if bestScore == 0 { // 仅有 ESP 特征：一对一系统邮件
+		return CategoryTransactional
+	}
+	return best
+}
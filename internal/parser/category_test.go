@@ -0,0 +1,38 @@
+package parser
+
+import (
+	"strings"
+	"testing"
+
+	"monitor-imap-webhook/internal/config"
+)
+
+func TestClassify(t *testing.T) {
+	html := "<html><head><style>" + strings.Repeat(".c{color:red}", 40) + "</style></head><body>" +
+		strings.Repeat(`<a href="https://shop.example.com/p">x</a>`, 16) + "<p>Big sale</p></body></html>"
+	cases := []struct {
+		name, headers, body string
+		want                string
+	}{
+		{"newsletter", "From: Shop <news@shop.example.com>\r\nSubject: 本周精选\r\nList-Unsubscribe: <https://shop.example.com/u>\r\nX-Mailchimp-Campaign: 1\r\n" +
+			"Content-Type: text/html; charset=utf-8\r\n", html, CategoryNewsletter},
+		{"mailing list", "From: Bob <bob@example.org>\r\nSubject: Re: [dev] release plan\r\nList-Id: <dev.lists.example.org>\r\nPrecedence: list\r\n", "I agree.", CategoryNewsletter},
+		{"receipt", "From: Example Store <orders@store.example.com>\r\nSubject: Your order #1234 receipt\r\nX-SES-Outgoing: 2024.01.01\r\n", "Thanks for your order.", CategoryTransactional},
+		{"otp", "From: no-reply@bank.example.com\r\nSubject: 您的验证码是 123456\r\n", "验证码 123456，5 分钟内有效。", CategoryTransactional},
+		{"github", "From: GitHub <notifications@github.com>\r\nSubject: [org/repo] Fix crash (PR #12)\r\nX-GitHub-Reason: review_requested\r\n" +
+			"List-Unsubscribe: <mailto:unsub@github.com>\r\n", "@alice requested your review.", CategoryNotification},
+		{"alert", "From: alertmanager@ops.example.com\r\nSubject: [FIRING:1] HighCPU\r\nAuto-Submitted: auto-generated\r\n", "cpu > 90%", CategoryNotification},
+		{"personal", "From: 张三 <zhang@example.com>\r\nSubject: 周末一起吃饭？\r\nIn-Reply-To: <a@example.com>\r\n", "好啊，周六中午？", CategoryPersonal},
+		{"personal order talk", "From: Alice <alice@example.com>\r\nSubject: about the order\r\n", "Can you check the invoice?", CategoryPersonal},
+	}
+	for _, c := range cases {
+		raw := c.headers + "To: me@example.com\r\n\r\n" + c.body + "\r\n"
+		msg, err := parseRaw([]byte(raw), nil, &config.Config{HTMLToTextMode: "simple"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if msg.Category != c.want {
+			t.Errorf("%s: got %s want %s", c.name, msg.Category, c.want)
+		}
+	}
+}
@@ -0,0 +1,215 @@
+package parser
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/emersion/go-message/charset"
+)
+
+// textCharset 记录正文 part 的字符集转换结果
+type textCharset struct {
+	Name     string // 实际用于解码的字符集（小写）
+	Detected bool   // 是否为启发式探测结果（声明缺失或错误时）
+}
+
+// detectCandidates 在声明缺失/错误时依次尝试的多字节字符集；
+// 顺序即同分时的优先级（中文邮件优先）。
+var detectCandidates = []string{"gb18030", "big5", "shift_jis", "euc-jp", "euc-kr"}
+
+// 常用汉字（简体/繁体各取高频字），用于区分 GBK 与 Big5 这类彼此"都能解码"的字符集
+const (
+	commonHans = "的一是不了人我在有他这中大来上国个到说们为子和你地出道也时年得就那要下以生会自着去之过家学对可她里后小么心多天而能好都然没日于起还发成事只作当想看文无开手十用主行方又如前所本见经头面公同三已老从动两长知民样现分将外但身些与高意进把法此实回二理美点月明其种声全工己话儿者向情部正名定女问力机给等几很业最间新什打便位因重被走电四第门相次东政海口使教西再平真听世气信北少关并内加化由却代军产入先山五太水万市眼体别处总才场师书比住员九笑性通目华报立马命张活难神数件安表原车白应路期叫死常提感金何更反合放做系计或司利受光王果亲界及今京务制解各任至清物台象记边共风战干接它许八特觉望直服毛林题建南度统色字请交爱让认算论百吗视费单价件附收邮发送"
+	commonHant = "的一是不了人我在有他這中大來上國個到說們為子和你地出道也時年得就那要下以生會自著去之過家學對可她裡後小麼心多天而能好都然沒日於起還發成事只作當想看文無開手十用主行方又如前所本見經頭面公同三已老從動兩長知民樣現分將外但身些與高意進把法此實回二理美點月明其種聲全工己話兒者向情部正名定女問力機給等幾很業最間新什打便位因重被走電四第門相次東政海口使教西再平真聽世氣信北少關並內加化由卻代軍產入先山五太水萬市眼體別處總才場師書比住員九笑性通目華報立馬命張活難神數件安表原車白應路期叫死常提感金何更反合放做系計或司利受光王果親界及今京務制解各任至清物臺象記邊共風戰幹接它許八特覺望直服毛林題建南度統色字請交愛讓認算論百嗎視費單價件附收郵發送"
+)
+
+var (
+	commonHansSet = runeSet(commonHans)
+	commonHantSet = runeSet(commonHant)
+)
+
+func runeSet(s string) map[rune]struct{} {
+	m := make(map[rune]struct{}, len(s)/3)
+	for _, r := range s {
+		m[r] = struct{}{}
+	}
+	return m
+}
+
+// normalizeCharset 统一字符集名称（去引号/空白，小写）
+func normalizeCharset(name string) string {
+	name = strings.Trim(strings.TrimSpace(name), `"'`)
+	return strings.ToLower(name)
+}
+
+// decodeCharset 将文本 part 的原始字节转换为 UTF-8。
+// 优先使用声明的 charset；若声明缺失、无法识别或解码出现大量替换字符，
+// 则回退到启发式探测。返回转换后的文本与实际使用的字符集。
+func decodeCharset(b []byte, declared string) (string, textCharset) {
+	declared = normalizeCharset(declared)
+	switch declared {
+	case "", "utf-8", "utf8", "us-ascii", "ascii":
+		if utf8.Valid(b) && !(declared == "" && isISO2022JP(b)) {
+			name := declared
+			if name == "" || name == "utf8" {
+				name = "utf-8"
+			}
+			if name == "ascii" {
+				name = "us-ascii"
+			}
+			return string(b), textCharset{Name: name}
+		}
+	default:
+		if s, ok := decodeWith(declared, b); ok && !hasReplacement(s, b) {
+			// 声明可解码时仍与候选比较：GBK/Big5 互相"解得开"，只能靠可读性区分
+			alt, altScore := bestCandidate(b)
+			if alt != "" && alt != charsetFamily(declared) && altScore >= minSwitchScore &&
+				altScore >= plausibility(charsetFamily(declared), s)+0.5 {
+				out, _ := decodeWith(alt, b)
+				return out, textCharset{Name: alt, Detected: true}
+			}
+			return s, textCharset{Name: declared}
+		}
+	}
+	name := detectCharset(b)
+	s, _ := decodeWith(name, b)
+	return s, textCharset{Name: name, Detected: true}
+}
+
+// detectCharset 基于 BOM、转义序列与候选解码评分猜测字符集；总能返回一个可用名称。
+func detectCharset(b []byte) string {
+	switch {
+	case bytes.HasPrefix(b, []byte{0xEF, 0xBB, 0xBF}):
+		return "utf-8"
+	case bytes.HasPrefix(b, []byte{0xFF, 0xFE}):
+		return "utf-16le"
+	case bytes.HasPrefix(b, []byte{0xFE, 0xFF}):
+		return "utf-16be"
+	}
+	if isISO2022JP(b) {
+		return "iso-2022-jp"
+	}
+	if utf8.Valid(b) {
+		return "utf-8"
+	}
+	if best, _ := bestCandidate(b); best != "" {
+		return best
+	}
+	// 单字节兜底：windows-1252 可解码任意字节
+	return "windows-1252"
+}
+
+// isISO2022JP ISO-2022-JP 为 7bit 编码（同时也是合法 UTF-8），只能依靠 ESC 序列识别
+func isISO2022JP(b []byte) bool {
+	for _, esc := range [][]byte{{0x1B, '$', 'B'}, {0x1B, '$', '@'}, {0x1B, '(', 'J'}} {
+		if bytes.Contains(b, esc) {
+			return true
+		}
+	}
+	return false
+}
+
+// minSwitchScore 覆盖"可解码但疑似错误"的声明字符集所需的最低候选得分
+const minSwitchScore = 1.5
+
+// bestCandidate 返回无替换字符且得分最高的多字节候选字符集
+func bestCandidate(b []byte) (string, float64) {
+	best, bestScore := "", 0.0
+	for _, name := range detectCandidates {
+		s, ok := decodeWith(name, b)
+		if !ok || hasReplacement(s, b) {
+			continue
+		}
+		if score := plausibility(name, s); score > bestScore {
+			best, bestScore = name, score
+		}
+	}
+	return best, bestScore
+}
+
+// charsetFamily 将常见别名归并到候选字符集名称，便于与探测结果比较
+func charsetFamily(name string) string {
+	switch name {
+	case "gb2312", "gbk", "x-gbk", "cp936", "gb18030", "euc-cn":
+		return "gb18030"
+	case "big5", "big5-hkscs", "cp950", "x-x-big5":
+		return "big5"
+	case "shift_jis", "shift-jis", "sjis", "x-sjis", "windows-31j", "cp932":
+		return "shift_jis"
+	case "euc-kr", "ks_c_5601-1987", "cp949":
+		return "euc-kr"
+	}
+	return name
+}
+
+func decodeWith(name string, b []byte) (string, bool) {
+	if name == "utf-8" {
+		return string(b), utf8.Valid(b)
+	}
+	r, err := charset.Reader(name, bytes.NewReader(b))
+	if err != nil {
+		return "", false
+	}
+	out, err := io.ReadAll(r)
+	if err != nil {
+		return "", false
+	}
+	return string(out), true
+}
+
+// hasReplacement 判断解码结果是否引入了原文中不存在的 U+FFFD
+func hasReplacement(s string, orig []byte) bool {
+	return strings.ContainsRune(s, utf8.RuneError) && !bytes.Contains(orig, []byte("\uFFFD"))
+}
+
+// plausibility 对候选解码结果打分：可读字符占比 + 常用字命中加权。
+func plausibility(name string, s string) float64 {
+	var total, readable, common int
+	for _, r := range s {
+		if r < 0x80 {
+			continue // ASCII 对所有候选一致，不参与区分
+		}
+		total++
+		switch name {
+		case "gb18030":
+			if _, ok := commonHansSet[r]; ok {
+				common++
+			}
+		case "big5":
+			if _, ok := commonHantSet[r]; ok {
+				common++
+			}
+		case "shift_jis", "euc-jp":
+			if unicode.Is(unicode.Hiragana, r) {
+				common++ // 平假名在日文中极高频，相当于"常用字"
+			}
+		case "euc-kr":
+			if unicode.Is(unicode.Hangul, r) {
+				common++
+			}
+		}
+		switch {
+		case r >= 0xFF61 && r <= 0xFF9F:
+			// 半角片假名：多为误解码产物，不计入可读
+		case unicode.Is(unicode.Han, r):
+			readable++
+		case unicode.Is(unicode.Hiragana, r), unicode.Is(unicode.Katakana, r):
+			if name == "shift_jis" || name == "euc-jp" {
+				readable++
+			}
+		case unicode.Is(unicode.Hangul, r):
+			if name == "euc-kr" {
+				readable++
+			}
+		case r >= 0x3000 && r <= 0x303F, r >= 0xFF00 && r <= 0xFFEF:
+			readable++ // CJK 标点 / 全角字符
+		}
+	}
+	if total == 0 {
+		return 0
+	}
+	return (float64(readable) + 2*float64(common)) / float64(total)
+}
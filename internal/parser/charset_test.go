@@ -0,0 +1,104 @@
+package parser
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"golang.org/x/text/encoding/traditionalchinese"
+
+	"monitor-imap-webhook/internal/config"
+)
+
+func mustEncode(t *testing.T, enc encoding.Encoding, s string) []byte {
+	t.Helper()
+	b, err := enc.NewEncoder().Bytes([]byte(s))
+	if err != nil {
+		t.Fatalf("encode %q: %v", s, err)
+	}
+	return b
+}
+
+// buildTextRaw 构造单 part 文本邮件；charset 为空时不声明
+func buildTextRaw(contentType, charsetName string, body []byte) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("Subject: charset\r\n")
+	buf.WriteString("From: T <t@example.com>\r\n")
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: " + contentType)
+	if charsetName != "" {
+		buf.WriteString("; charset=" + charsetName)
+	}
+	buf.WriteString("\r\n\r\n")
+	buf.Write(body)
+	buf.WriteString("\r\n")
+	return buf.Bytes()
+}
+
+func TestBodyCharsetConversion(t *testing.T) {
+	const zhHans = "请查收本月的发票，谢谢。"
+	const zhHant = "請查收本月的發票，這是我們的通知。"
+	cases := []struct {
+		name         string
+		contentType  string
+		declared     string
+		body         []byte
+		want         string
+		wantCharset  string
+		wantDetected bool
+	}{
+		{"gbk declared", "text/plain", "gbk", mustEncode(t, simplifiedchinese.GBK, zhHans), zhHans, "gbk", false},
+		{"gb2312 declared", "text/plain", "gb2312", mustEncode(t, simplifiedchinese.GBK, zhHans), zhHans, "gb2312", false},
+		{"big5 declared", "text/plain", "big5", mustEncode(t, traditionalchinese.Big5, zhHant), zhHant, "big5", false},
+		{"iso-2022-jp declared", "text/plain", "iso-2022-jp", mustEncode(t, japanese.ISO2022JP, "こんにちは、世界"), "こんにちは、世界", "iso-2022-jp", false},
+		{"windows-1252 declared", "text/plain", "windows-1252", mustEncode(t, charmap.Windows1252, "Café “quoted” €5"), "Café “quoted” €5", "windows-1252", false},
+		{"missing charset gbk", "text/plain", "", mustEncode(t, simplifiedchinese.GBK, zhHans), zhHans, "gb18030", true},
+		{"missing charset big5", "text/plain", "", mustEncode(t, traditionalchinese.Big5, zhHant), zhHant, "big5", true},
+		{"utf-8 label but gbk bytes", "text/plain", "utf-8", mustEncode(t, simplifiedchinese.GBK, zhHans), zhHans, "gb18030", true},
+		{"gb2312 label but big5 bytes", "text/plain", "gb2312", mustEncode(t, traditionalchinese.Big5, zhHant), zhHant, "big5", true},
+		{"missing charset iso-2022-jp", "text/plain", "", mustEncode(t, japanese.ISO2022JP, "こんにちは"), "こんにちは", "iso-2022-jp", true},
+		{"html gbk", "text/html", "gbk", mustEncode(t, simplifiedchinese.GBK, "<p>"+zhHans+"</p>"), zhHans, "gbk", false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := &config.Config{HTMLToTextMode: "simple"}
+			msg, err := parseRaw(buildTextRaw(tc.contentType, tc.declared, tc.body), nil, cfg)
+			if err != nil {
+				t.Fatalf("parseRaw: %v", err)
+			}
+			if got := strings.TrimSpace(msg.Body); got != tc.want {
+				t.Errorf("body = %q, want %q", got, tc.want)
+			}
+			if msg.BodyCharset != tc.wantCharset || msg.CharsetDetected != tc.wantDetected {
+				t.Errorf("charset = %s detected=%v, want %s detected=%v", msg.BodyCharset, msg.CharsetDetected, tc.wantCharset, tc.wantDetected)
+			}
+		})
+	}
+}
+
+func TestMultipartPartCharsets(t *testing.T) {
+	var buf bytes.Buffer
+	buf.WriteString("Subject: multi\r\nFrom: a@example.com\r\nMIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: multipart/alternative; boundary=\"B\"\r\n\r\n")
+	buf.WriteString("--B\r\nContent-Type: text/html; charset=big5\r\n\r\n")
+	buf.Write(mustEncode(t, traditionalchinese.Big5, "<p>會議通知</p>"))
+	buf.WriteString("\r\n--B--\r\n")
+	cfg := &config.Config{HTMLToTextMode: "simple", IncludeRawHTML: true}
+	msg, err := parseRaw(buf.Bytes(), nil, cfg)
+	if err != nil {
+		t.Fatalf("parseRaw: %v", err)
+	}
+	if strings.TrimSpace(msg.Body) != "會議通知" {
+		t.Errorf("body = %q", msg.Body)
+	}
+	if strings.TrimSpace(msg.RawHTML) != "<p>會議通知</p>" {
+		t.Errorf("raw html should be original markup in UTF-8, got %q", msg.RawHTML)
+	}
+	if msg.BodyCharset != "big5" {
+		t.Errorf("charset = %q", msg.BodyCharset)
+	}
+}
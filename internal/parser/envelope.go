@@ -0,0 +1,177 @@
+package parser
+
+import (
+	"mime"
+	mailpkg "net/mail"
+	"net/textproto"
+	"regexp"
+	"strings"
+
+	"github.com/emersion/go-message/charset"
+)
+
+// addrParser 解析地址时支持非 UTF-8 编码字（GBK、Big5 等）
+var addrParser = &mailpkg.AddressParser{WordDecoder: &mime.WordDecoder{CharsetReader: charset.Reader}}
+
+// Address 解码后的邮件地址（显示名 + 地址）
+type Address struct {
+	Name    string `json:"name,omitempty"`
+	Address string `json:"address"`
+}
+
+// String 以 "Name <addr>" 形式输出；显示名为空或与地址相同时只输出地址
+func (a Address) String() string {
+	if a.Name == "" || strings.EqualFold(a.Name, a.Address) {
+		return a.Address
+	}
+	return a.Name + " <" + a.Address + ">"
+}
+
+// parseAddressList 解析地址列表头部。标准解析失败时逐个拆分容错，
+// 仍无法识别的片段以原文作为 Address 保留，避免丢失收件人。
+func parseAddressList(v string) []Address {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return nil
+	}
+	if list, err := addrParser.ParseList(v); err == nil {
+		out := make([]Address, 0, len(list))
+		for _, a := range list {
+			out = append(out, toAddress(a))
+		}
+		return out
+	}
+	var out []Address
+	for _, f := range splitAddressFields(v) {
+		f = strings.TrimSpace(f)
+		if f == "" {
+			continue
+		}
+		if a, err := addrParser.Parse(f); err == nil {
+			out = append(out, toAddress(a))
+			continue
+		}
+		out = append(out, Address{Address: strings.Trim(decodeHeader(f), "<> ")})
+	}
+	return out
+}
+
+// parseAddress 解析单个地址头部（From / Sender），为空时返回 nil
+func parseAddress(v string) *Address {
+	list := parseAddressList(v)
+	if len(list) == 0 {
+		return nil
+	}
+	return &list[0]
+}
+
+func toAddress(a *mailpkg.Address) Address {
+	// 显示名中引号包裹的编码字 net/mail 不会解码，这里补一次
+	return Address{Name: strings.TrimSpace(decodeHeader(a.Name)), Address: a.Address}
+}
+
+// splitAddressFields 按逗号切分地址列表，忽略引号与尖括号内的逗号
+func splitAddressFields(v string) []string {
+	var fields []string
+	var cur strings.Builder
+	inQuote, inAngle, escaped := false, false, false
+	for i := 0; i < len(v); i++ {
+		c := v[i]
+		switch {
+		case escaped:
+			escaped = false
+		case c == '\\' && inQuote:
+			escaped = true
+		case c == '"':
+			inQuote = !inQuote
+		case c == '<' && !inQuote:
+			inAngle = true
+		case c == '>' && !inQuote:
+			inAngle = false
+		case c == ',' && !inQuote && !inAngle:
+			fields = append(fields, cur.String())
+			cur.Reset()
+			continue
+		}
+		cur.WriteByte(c)
+	}
+	return append(fields, cur.String())
+}
+
+var msgIDRe = regexp.MustCompile(`<([^<>\s]+)>`)
+
+// parseMsgIDs 提取 Message-ID 列表（去掉尖括号）；不带尖括号的非规范写法按空白切分
+func parseMsgIDs(v string) []string {
+	if strings.TrimSpace(v) == "" {
+		return nil
+	}
+	var ids []string
+	if m := msgIDRe.FindAllStringSubmatch(v, -1); len(m) > 0 {
+		for _, s := range m {
+			ids = append(ids, s[1])
+		}
+		return ids
+	}
+	for _, f := range strings.FieldsFunc(v, func(r rune) bool { return r == ' ' || r == '\t' || r == ',' || r == '\r' || r == '\n' }) {
+		ids = append(ids, f)
+	}
+	return ids
+}
+
+// firstMsgID 返回头部中的第一个 Message-ID
+func firstMsgID(v string) string {
+	if ids := parseMsgIDs(v); len(ids) > 0 {
+		return ids[0]
+	}
+	return ""
+}
+
+// parseListID 提取 List-Id 中尖括号内的列表标识；没有尖括号时返回去空白的原值
+func parseListID(v string) string {
+	if m := msgIDRe.FindStringSubmatch(v); m != nil {
+		return strings.ToLower(m[1])
+	}
+	return strings.TrimSpace(v)
+}
+
+// parseReturnPath 去掉 Return-Path 的尖括号；空退信地址 "<>" 返回空串
+func parseReturnPath(v string) string {
+	v = strings.TrimSpace(v)
+	return strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(v, "<"), ">"))
+}
+
+// selectHeaders 按白名单原样收集头部（保留多值，键为规范化形式）。
+// 白名单项 "*" 表示全部头部。
+func selectHeaders(hdr mailpkg.Header, allow []string) map[string][]string {
+	if len(allow) == 0 || len(hdr) == 0 {
+		return nil
+	}
+	out := make(map[string][]string)
+	for _, name := range allow {
+		if name == "*" {
+			for k, v := range hdr {
+				out[k] = append([]string(nil), v...)
+			}
+			return out
+		}
+		key := textproto.CanonicalMIMEHeaderKey(name)
+		if v, ok := hdr[key]; ok {
+			out[key] = append([]string(nil), v...)
+		}
+	}
+	if len(out) == 0 {
+		return nil
+	}
+	return out
+}
+
+// splitHeaderList 拆分逗号分隔的头部名白名单
+func splitHeaderList(raw string) []string {
+	var out []string
+	for _, v := range strings.Split(raw, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
@@ -0,0 +1,81 @@
+package parser
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	imap "github.com/emersion/go-imap"
+
+	"monitor-imap-webhook/internal/config"
+)
+
+const envelopeRaw = "From: \"=?UTF-8?B?5byg5LiJ?=\" <zhang@example.com>\r\n" +
+	"To: Alice <alice@example.com>, =?GBK?B?wO7LxA==?= <lisi@example.com>\r\n" +
+	"Cc: bob@example.com\r\n" +
+	"Reply-To: \"Support, Team\" <support@example.com>\r\n" +
+	"Sender: bounce@lists.example.com\r\n" +
+	"Message-ID: <abc123@example.com>\r\n" +
+	"In-Reply-To: <parent@example.com>\r\n" +
+	"References: <root@example.com>\r\n <parent@example.com>\r\n" +
+	"List-Id: Dev List <DEV.lists.example.com>\r\n" +
+	"Return-Path: <bounce@lists.example.com>\r\n" +
+	"X-Priority: 1\r\n" +
+	"Received: from a\r\n" +
+	"Received: from b\r\n" +
+	"Subject: hi\r\n" +
+	"Content-Type: text/plain; charset=utf-8\r\n" +
+	"\r\n" +
+	"body\r\n"
+
+func TestEnvelopeFields(t *testing.T) {
+	cfg := &config.Config{HTMLToTextMode: "simple", IncludeHeaders: "x-priority, Received, X-Missing"}
+	when := time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC)
+	msg, err := parseRaw([]byte(envelopeRaw), &imap.Message{InternalDate: when, Size: 1234}, cfg)
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	if msg.FromAddress == nil || msg.FromAddress.Name != "张三" || msg.FromAddress.Address != "zhang@example.com" {
+		t.Fatalf("from_address=%+v", msg.FromAddress)
+	}
+	if msg.From != "张三 <zhang@example.com>" {
+		t.Fatalf("from=%q", msg.From)
+	}
+	wantTo := []Address{{Name: "Alice", Address: "alice@example.com"}, {Name: "李四", Address: "lisi@example.com"}}
+	if !reflect.DeepEqual(msg.To, wantTo) {
+		t.Fatalf("to=%+v", msg.To)
+	}
+	if len(msg.Cc) != 1 || msg.Cc[0].Address != "bob@example.com" {
+		t.Fatalf("cc=%+v", msg.Cc)
+	}
+	if len(msg.ReplyTo) != 1 || msg.ReplyTo[0].Name != "Support, Team" {
+		t.Fatalf("reply_to=%+v", msg.ReplyTo)
+	}
+	if msg.Sender == nil || msg.Sender.Address != "bounce@lists.example.com" {
+		t.Fatalf("sender=%+v", msg.Sender)
+	}
+	if msg.MessageID != "abc123@example.com" || msg.InReplyTo != "parent@example.com" {
+		t.Fatalf("ids=%q %q", msg.MessageID, msg.InReplyTo)
+	}
+	if !reflect.DeepEqual(msg.References, []string{"root@example.com", "parent@example.com"}) {
+		t.Fatalf("references=%v", msg.References)
+	}
+	if msg.ListID != "dev.lists.example.com" || msg.ReturnPath != "bounce@lists.example.com" {
+		t.Fatalf("list_id=%q return_path=%q", msg.ListID, msg.ReturnPath)
+	}
+	if !msg.InternalDate.Equal(when) || msg.Size != 1234 {
+		t.Fatalf("internal_date=%v size=%d", msg.InternalDate, msg.Size)
+	}
+	wantHdr := map[string][]string{"X-Priority": {"1"}, "Received": {"from a", "from b"}}
+	if !reflect.DeepEqual(msg.Headers, wantHdr) {
+		t.Fatalf("headers=%v", msg.Headers)
+	}
+}
+
+func TestParseAddressListLenient(t *testing.T) {
+	// 第二个片段不是合法地址，标准解析整体失败，其余地址仍应保留
+	got := parseAddressList(`A <a@example.com>, undisclosed recipients, "C, D" <cd@example.com>`)
+	if len(got) != 3 || got[0].Address != "a@example.com" || got[2].Name != "C, D" {
+		t.Fatalf("got %+v", got)
+	}
+}
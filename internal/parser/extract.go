@@ -0,0 +1,371 @@
+package parser
+
+import (
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/andybalholm/cascadia"
+	"golang.org/x/net/html"
+
+	"monitor-imap-webhook/internal/config"
+)
+
+// 提取规则的正则与选择器按模式串缓存，避免每封邮件重复编译（配置加载时已校验合法性）
+var (
+	ruleMu        sync.Mutex
+	regexCache    = make(map[string]*regexp.Regexp)
+	selectorCache = make(map[string]cascadia.SelectorGroup)
+)
+
+func cachedRegexp(pattern string) *regexp.Regexp {
+	ruleMu.Lock()
+	defer ruleMu.Unlock()
+	re, ok := regexCache[pattern]
+	if !ok {
+		re, _ = regexp.Compile(pattern)
+		regexCache[pattern] = re
+	}
+	return re
+}
+
+func cachedSelector(sel string) cascadia.SelectorGroup {
+	ruleMu.Lock()
+	defer ruleMu.Unlock()
+	g, ok := selectorCache[sel]
+	if !ok {
+		g, _ = cascadia.ParseGroup(sel)
+		selectorCache[sel] = g
+	}
+	return g
+}
+
+// extractContext 一封邮件的提取输入；HTML DOM 与 JSON-LD 按需解析一次
+type extractContext struct {
+	from, subject, body, rawHTML string
+
+	doc    *html.Node
+	parsed bool
+	ld     []map[string]any
+}
+
+func (x *extractContext) dom() *html.Node {
+	if !x.parsed {
+		x.parsed = true
+		if x.rawHTML != "" {
+			x.doc, _ = html.Parse(strings.NewReader(x.rawHTML))
+		}
+	}
+	return x.doc
+}
+
+// buildExtracted 依次执行配置的提取规则，结果以规则名为键；未命中或类型转换失败的规则不出现在结果中
+func buildExtracted(rules []config.Extractor, msg *Message, rawHTML string) map[string]any {
+	if len(rules) == 0 {
+		return nil
+	}
+	x := &extractContext{from: msg.From, subject: msg.Subject, body: msg.Body, rawHTML: rawHTML}
+	if msg.FromAddress != nil {
+		x.from = msg.FromAddress.Address
+	}
+	out := make(map[string]any)
+	for _, r := range rules {
+		if r.From != "" && !cachedRegexp(r.From).MatchString(x.from) {
+			continue
+		}
+		if r.Subject != "" && !cachedRegexp(r.Subject).MatchString(x.subject) {
+			continue
+		}
+		var values []any
+		for _, raw := range x.run(r) {
+			if v, ok := coerceValue(raw, r.Type); ok {
+				values = append(values, v)
+				if !r.All {
+					break
+				}
+			}
+		}
+		switch {
+		case len(values) == 0:
+		case r.All:
+			out[r.Name] = values
+		default:
+			out[r.Name] = values[0]
+		}
+	}
+	if len(out) == 0 {
+		return nil
+	}
+	return out
+}
+
+// run 返回规则的全部原始匹配值（按文档顺序）
+func (x *extractContext) run(r config.Extractor) []any {
+	var values []any
+	switch {
+	case r.Regex != "":
+		re := cachedRegexp(r.Regex)
+		text := x.body
+		if r.Source == "subject" {
+			text = x.subject
+		}
+		group := re.SubexpIndex("value")
+		if group < 0 && re.NumSubexp() > 0 {
+			group = 1
+		}
+		for _, m := range re.FindAllStringSubmatch(text, -1) {
+			if group > 0 {
+				values = append(values, m[group])
+			} else {
+				values = append(values, m[0])
+			}
+		}
+	case r.Selector != "":
+		doc := x.dom()
+		if doc == nil {
+			return nil
+		}
+		for _, n := range cascadia.QueryAll(doc, cachedSelector(r.Selector)) {
+			if r.Attr != "" {
+				if v := attr(n, r.Attr); v != "" {
+					values = append(values, v)
+				}
+				continue
+			}
+			values = append(values, strings.Join(strings.Fields(nodeText(n)), " "))
+		}
+	case r.JSONPath != "":
+		if x.ld == nil {
+			if doc := x.dom(); doc != nil {
+				x.ld = parseJSONLD(doc)
+			}
+		}
+		for _, obj := range x.ld {
+			if r.LDType != "" && !hasLDType(obj, r.LDType) {
+				continue
+			}
+			values = append(values, evalPath(obj, r.JSONPath)...)
+		}
+	}
+	return values
+}
+
+// evalPath 按点分路径取值：name、name[0]、name[*]，可选 "$." 前缀；途经数组时对每个元素取值，
+// 结果中的数组展开，{"@value": x} 取 x。
+func evalPath(root any, path string) []any {
+	cur := []any{root}
+	for _, seg := range strings.Split(strings.TrimPrefix(strings.TrimPrefix(path, "$"), "."), ".") {
+		name, index, hasIndex := seg, "", false
+		if i := strings.IndexByte(seg, '['); i >= 0 && strings.HasSuffix(seg, "]") {
+			name, index, hasIndex = seg[:i], seg[i+1:len(seg)-1], true
+		}
+		var next []any
+		for _, v := range cur {
+			if name != "" {
+				v = getField(v, name)
+			}
+			if v == nil {
+				continue
+			}
+			if !hasIndex {
+				next = append(next, v)
+				continue
+			}
+			arr, ok := v.([]any)
+			if !ok {
+				arr = []any{v} // 单值按一元数组处理（JSON-LD 常省略数组）
+			}
+			if index == "*" {
+				next = append(next, arr...)
+			} else if i, err := strconv.Atoi(index); err == nil && i >= 0 && i < len(arr) {
+				next = append(next, arr[i])
+			}
+		}
+		cur = next
+	}
+	var out []any
+	for _, v := range cur {
+		if arr, ok := v.([]any); ok {
+			out = append(out, arr...)
+		} else {
+			out = append(out, v)
+		}
+	}
+	for i, v := range out {
+		if m, ok := v.(map[string]any); ok {
+			if val, ok := m["@value"]; ok {
+				out[i] = val
+			}
+		}
+	}
+	return out
+}
+
+func getField(v any, name string) any {
+	switch t := v.(type) {
+	case map[string]any:
+		return t[name]
+	case []any:
+		var out []any
+		for _, e := range t {
+			if f := getField(e, name); f != nil {
+				out = append(out, f)
+			}
+		}
+		if len(out) == 0 {
+			return nil
+		}
+		return out
+	}
+	return nil
+}
+
+// coerceValue 按 type 转换提取结果：number → float64，date → YYYY-MM-DD / RFC 3339，
+// currency → {"amount", "currency"}；string 合并空白。转换失败返回 false。
+func coerceValue(v any, typ string) (any, bool) {
+	s, isString := v.(string)
+	if isString {
+		s = strings.Join(strings.Fields(s), " ")
+	}
+	switch typ {
+	case "number":
+		if f, ok := v.(float64); ok {
+			return f, true
+		}
+		if isString {
+			return parseNumber(s)
+		}
+	case "date":
+		if isString {
+			return parseDate(s)
+		}
+	case "currency":
+		if f, ok := v.(float64); ok {
+			return map[string]any{"amount": f}, true
+		}
+		if isString {
+			amount, ok := parseNumber(s)
+			if !ok {
+				return nil, false
+			}
+			c := map[string]any{"amount": amount}
+			if code := currencyCode(s); code != "" {
+				c["currency"] = code
+			}
+			return c, true
+		}
+	default:
+		if isString {
+			return s, s != ""
+		}
+		return v, v != nil
+	}
+	return nil, false
+}
+
+var numberRe = regexp.MustCompile(`-?\d[\d.,' \x{00A0}]*`)
+
+// parseNumber 识别千分位与小数点："1,234.56"、"1.234,56"、"1 234,5"、"12,50" 均可
+func parseNumber(s string) (float64, bool) {
+	m := numberRe.FindString(s)
+	if m == "" {
+		return 0, false
+	}
+	m = strings.TrimRight(m, ".,' \u00a0")
+	m = strings.NewReplacer(" ", "", "\u00a0", "", "'", "").Replace(m)
+	lastDot, lastComma := strings.LastIndexByte(m, '.'), strings.LastIndexByte(m, ',')
+	switch {
+	case lastDot >= 0 && lastComma >= 0: // 两种分隔符都有：靠后的是小数点
+		if lastComma > lastDot {
+			m = strings.ReplaceAll(m, ".", "")
+			m = strings.Replace(m, ",", ".", 1)
+		} else {
+			m = strings.ReplaceAll(m, ",", "")
+		}
+	case lastComma >= 0: // 仅逗号：唯一且其后不是 3 位数字时视为小数点
+		if strings.Count(m, ",") == 1 && len(m)-lastComma-1 != 3 {
+			m = strings.Replace(m, ",", ".", 1)
+		} else {
+			m = strings.ReplaceAll(m, ",", "")
+		}
+	case strings.Count(m, ".") > 1: // "1.234.567"
+		m = strings.ReplaceAll(m, ".", "")
+	}
+	f, err := strconv.ParseFloat(m, 64)
+	if err != nil || math.IsInf(f, 0) {
+		return 0, false
+	}
+	return f, true
+}
+
+// dateLayouts 日期格式，clock 表示含时刻（输出 RFC 3339），否则输出 YYYY-MM-DD
+var dateLayouts = []struct {
+	layout string
+	clock  bool
+}{
+	{time.RFC3339, true},
+	{"2006-01-02T15:04:05", true},
+	{"2006-01-02 15:04:05", true},
+	{"2006-01-02 15:04", true},
+	{"2006/01/02 15:04", true},
+	{"2006年1月2日 15:04", true},
+	{time.RFC1123Z, true},
+	{time.RFC1123, true},
+	{"Mon, 2 Jan 2006 15:04:05 -0700", true},
+	{"2006-01-02", false},
+	{"2006/01/02", false},
+	{"2006/1/2", false},
+	{"2006.01.02", false},
+	{"02.01.2006", false},
+	{"2006年1月2日", false},
+	{"Jan 2, 2006", false},
+	{"January 2, 2006", false},
+	{"2 Jan 2006", false},
+	{"2 January 2006", false},
+	{"Mon, Jan 2, 2006", false},
+	{"Monday, January 2, 2006", false},
+}
+
+// parseDate 识别常见日期格式（不含 01/02/2006 这类月日顺序有歧义的写法）
+func parseDate(s string) (string, bool) {
+	s = strings.TrimSpace(s)
+	for _, l := range dateLayouts {
+		t, err := time.Parse(l.layout, s)
+		if err != nil {
+			continue
+		}
+		if l.clock {
+			return t.Format(time.RFC3339), true
+		}
+		return t.Format("2006-01-02"), true
+	}
+	return "", false
+}
+
+var isoCurrencyRe = regexp.MustCompile(`\b(USD|EUR|GBP|CNY|RMB|JPY|HKD|TWD|AUD|CAD|CHF|SGD|KRW|INR|RUB|BRL|NZD|SEK|NOK|DKK|MXN)\b`)
+
+// currencySymbols 货币符号，前缀更长的写法在前（"US$" 先于 "$"）
+var currencySymbols = []struct{ symbol, code string }{
+	{"US$", "USD"}, {"HK$", "HKD"}, {"NT$", "TWD"}, {"A$", "AUD"}, {"C$", "CAD"}, {"S$", "SGD"}, {"NZ$", "NZD"}, {"R$", "BRL"},
+	{"$", "USD"}, {"€", "EUR"}, {"£", "GBP"}, {"¥", "CNY"}, {"￥", "CNY"}, {"人民币", "CNY"}, {"元", "CNY"},
+	{"円", "JPY"}, {"₩", "KRW"}, {"₹", "INR"}, {"₽", "RUB"},
+}
+
+// currencyCode 优先 ISO 4217 代码，其次货币符号；¥ 按人民币处理
+func currencyCode(s string) string {
+	if m := isoCurrencyRe.FindString(s); m != "" {
+		if m == "RMB" {
+			return "CNY"
+		}
+		return m
+	}
+	for _, c := range currencySymbols {
+		if strings.Contains(s, c.symbol) {
+			return c.code
+		}
+	}
+	return ""
+}
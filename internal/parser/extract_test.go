@@ -0,0 +1,73 @@
+package parser
+
+import (
+	"reflect"
+	"testing"
+
+	"monitor-imap-webhook/internal/config"
+)
+
+func TestBuildExtracted(t *testing.T) {
+	raw := "From: Shop <orders@shop.example.com>\r\nSubject: 订单 #A-1029 已发货\r\nMIME-Version: 1.0\r\n" +
+		"Content-Type: multipart/alternative; boundary=b\r\n\r\n" +
+		"--b\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n您的验证码是 482913，10 分钟内有效。\r\n合计：¥1,299.00\r\n下单日期：2024年3月5日\r\n" +
+		"--b\r\nContent-Type: text/html; charset=utf-8\r\n\r\n" +
+		`<html><head><script type="application/ld+json">{"@context":"https://schema.org","@graph":[` +
+		`{"@type":"Order","orderNumber":"A-1029","acceptedOffer":[{"price":"19.90","itemOffered":{"name":"Pen"}},{"price":5,"itemOffered":{"name":"Ink"}}]},` +
+		`{"@type":"ParcelDelivery","trackingNumber":"SF123"}]}</script></head>` +
+		`<body><table><tr><td class="label">Total</td><td class="amount">€ 1.299,50</td></tr></table><a class="track" href="https://t.example.com/SF123">Track</a></body></html>` + "\r\n" +
+		"--b--\r\n"
+	cfg := &config.Config{HTMLToTextMode: "simple", Extractors: []config.Extractor{
+		{Name: "otp", Regex: `验证码是\s*(\d{4,8})`},
+		{Name: "order", Regex: `#(?P<value>[A-Z]-\d+)`, Source: "subject"},
+		{Name: "total", Regex: `合计：(\S+)`, Type: "currency"},
+		{Name: "date", Regex: `下单日期：(\S+)`, Type: "date"},
+		{Name: "html_total", Selector: "td.amount", Type: "currency"},
+		{Name: "track_url", Selector: "a.track", Attr: "href"},
+		{Name: "order_ld", JSONPath: "$.orderNumber", LDType: "Order"},
+		{Name: "prices", JSONPath: "acceptedOffer[*].price", Type: "number", All: true},
+		{Name: "first_item", JSONPath: "acceptedOffer[0].itemOffered.name"},
+		{Name: "scoped_out", Regex: `(\d+)`, From: `@bank\.example\.com$`},
+		{Name: "no_match", Regex: `不存在的(\d+)`},
+	}}
+	msg, err := parseRaw([]byte(raw), nil, cfg)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	want := map[string]any{
+		"otp":        "482913",
+		"order":      "A-1029",
+		"total":      map[string]any{"amount": 1299.0, "currency": "CNY"},
+		"date":       "2024-03-05",
+		"html_total": map[string]any{"amount": 1299.5, "currency": "EUR"},
+		"track_url":  "https://t.example.com/SF123",
+		"order_ld":   "A-1029",
+		"prices":     []any{19.9, 5.0},
+		"first_item": "Pen",
+	}
+	if !reflect.DeepEqual(msg.Extracted, want) {
+		t.Fatalf("extracted=%#v", msg.Extracted)
+	}
+}
+
+func TestParseNumberAndDate(t *testing.T) {
+	numbers := map[string]float64{"1,234.56": 1234.56, "1.234,56": 1234.56, "1 234,5": 1234.5, "12,50": 12.5, "1,234": 1234, "-3.5": -3.5, "1.234.567": 1234567, "USD 99.": 99}
+	for in, want := range numbers {
+		if got, ok := parseNumber(in); !ok || got != want {
+			t.Errorf("parseNumber(%q)=%v,%v want %v", in, got, ok, want)
+		}
+	}
+	if _, ok := parseNumber("abc"); ok {
+		t.Error("parseNumber(abc) should fail")
+	}
+	dates := map[string]string{"2024-01-05": "2024-01-05", "Jan 5, 2024": "2024-01-05", "05.01.2024": "2024-01-05",
+		"2024-01-05 09:30": "2024-01-05T09:30:00Z", "Fri, 5 Jan 2024 09:30:00 +0800": "2024-01-05T09:30:00+08:00"}
+	for in, want := range dates {
+		if got, ok := parseDate(in); !ok || got != want {
+			t.Errorf("parseDate(%q)=%q want %q", in, got, want)
+		}
+	}
+	if _, ok := parseDate("01/05/2024"); ok {
+		t.Error("ambiguous date should not parse")
+	}
+}
@@ -0,0 +1,217 @@
+package parser
+
+import (
+	"encoding/base64"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// attachmentFilename 从 Content-Disposition / Content-Type 参数中还原附件文件名。
+// 依次尝试 disposition 的 filename、content-type 的 name（以及反向的兼容写法），
+// 每个参数都支持 RFC 2231 扩展（filename*=charset”..、filename*0*= 续行）与 RFC 2047 编码字。
+func attachmentFilename(params, dispParams map[string]string) string {
+	candidates := []struct {
+		m   map[string]string
+		key string
+	}{
+		{dispParams, "filename"},
+		{params, "name"},
+		{params, "filename"},
+		{dispParams, "name"},
+	}
+	for _, c := range candidates {
+		if v := strings.TrimSpace(decodeParam(c.m, c.key)); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// decodeParam 还原单个 MIME 参数值：
+//   - key*=charset'lang'%XX..     (RFC 2231 扩展值)
+//   - key*0=.. key*1*=%XX..       (RFC 2231 续行，可混合扩展/非扩展段)
+//   - key=..                      (普通值，可能包含 RFC 2047 编码字或 8bit 原始字节)
+//
+// 最终结果会再做一次 RFC 2047 解码，以兼容把编码字拆进续行的客户端。
+func decodeParam(params map[string]string, key string) string {
+	if len(params) == 0 {
+		return ""
+	}
+	lower := make(map[string]string, len(params))
+	for k, v := range params {
+		lower[strings.ToLower(strings.TrimSpace(k))] = v
+	}
+	key = strings.ToLower(key)
+
+	if v, ok := lower[key+"*"]; ok {
+		cs, raw := splitExtendedValue(v)
+		return decodeEncodedWords(bytesToUTF8(percentDecode(raw), cs))
+	}
+
+	type segment struct {
+		n        int
+		val      string
+		extended bool
+	}
+	var segs []segment
+	for k, v := range lower {
+		if !strings.HasPrefix(k, key+"*") {
+			continue
+		}
+		rest := strings.TrimPrefix(k, key+"*")
+		ext := strings.HasSuffix(rest, "*")
+		n, err := strconv.Atoi(strings.TrimSuffix(rest, "*"))
+		if err != nil || n < 0 {
+			continue
+		}
+		segs = append(segs, segment{n: n, val: v, extended: ext})
+	}
+	if len(segs) > 0 {
+		sort.Slice(segs, func(i, j int) bool { return segs[i].n < segs[j].n })
+		var buf []byte
+		cs := ""
+		for i, s := range segs {
+			if s.n != i { // 续行编号必须连续，缺失后的段落丢弃
+				break
+			}
+			val := s.val
+			if s.extended {
+				if i == 0 {
+					cs, val = splitExtendedValue(val)
+				}
+				buf = append(buf, percentDecode(val)...)
+			} else {
+				buf = append(buf, val...)
+			}
+		}
+		return decodeEncodedWords(bytesToUTF8(buf, cs))
+	}
+
+	if v, ok := lower[key]; ok {
+		return decodeEncodedWords(bytesToUTF8([]byte(v), ""))
+	}
+	return ""
+}
+
+// splitExtendedValue 拆分 RFC 2231 扩展值 charset'language'value
+func splitExtendedValue(v string) (charsetName, value string) {
+	parts := strings.SplitN(v, "'", 3)
+	if len(parts) != 3 {
+		return "", v
+	}
+	return parts[0], parts[2]
+}
+
+// percentDecode 宽松的 %XX 解码；非法序列原样保留
+func percentDecode(s string) []byte {
+	out := make([]byte, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		if s[i] == '%' && i+2 < len(s) {
+			if b, err := strconv.ParseUint(s[i+1:i+3], 16, 8); err == nil {
+				out = append(out, byte(b))
+				i += 2
+				continue
+			}
+		}
+		out = append(out, s[i])
+	}
+	return out
+}
+
+// bytesToUTF8 按字符集转换参数字节；未声明字符集时交给 decodeCharset 探测（兼容 8bit 原始文件名）
+func bytesToUTF8(b []byte, charsetName string) string {
+	s, _ := decodeCharset(b, charsetName)
+	return s
+}
+
+var encodedWordRe = regexp.MustCompile(`=\?([^?\s]+)\?([bBqQ])\?([^?\s]*)(\?=|$)`)
+
+// decodeEncodedWords 解码 RFC 2047 编码字。与 mime.WordDecoder 不同：
+//   - 相邻且字符集/编码相同的编码字先拼接原始字节再转码，避免多字节字符被拆到两个编码字时出现乱码；
+//   - 容忍末尾缺少 "?=" 的截断编码字与缺少 padding 的 base64；
+//   - 解码失败时保留原文。
+func decodeEncodedWords(s string) string {
+	if !strings.Contains(s, "=?") {
+		return s
+	}
+	matches := encodedWordRe.FindAllStringSubmatchIndex(s, -1)
+	if len(matches) == 0 {
+		return s
+	}
+	var out strings.Builder
+	var pending []byte
+	pendingCS, pendingEnc := "", ""
+	flush := func() {
+		if pendingCS != "" {
+			out.WriteString(bytesToUTF8(pending, pendingCS))
+		}
+		pending, pendingCS, pendingEnc = nil, "", ""
+	}
+	last := 0
+	for _, m := range matches {
+		between := s[last:m[0]]
+		cs := strings.ToLower(s[m[2]:m[3]])
+		if i := strings.IndexByte(cs, '*'); i >= 0 { // RFC 2231 语言后缀 charset*lang
+			cs = cs[:i]
+		}
+		enc := strings.ToLower(s[m[4]:m[5]])
+		data, ok := decodeWordPayload(enc, s[m[6]:m[7]])
+		if !ok {
+			flush()
+			out.WriteString(s[last:m[1]])
+			last = m[1]
+			continue
+		}
+		// 编码字之间仅有空白时按 RFC 2047 忽略空白；同字符集同编码的相邻编码字合并字节
+		adjacent := pendingCS != "" && strings.TrimSpace(between) == ""
+		if !adjacent || cs != pendingCS || enc != pendingEnc {
+			flush()
+		}
+		if !adjacent {
+			out.WriteString(between)
+		}
+		pending = append(pending, data...)
+		pendingCS, pendingEnc = cs, enc
+		last = m[1]
+	}
+	flush()
+	out.WriteString(s[last:])
+	return out.String()
+}
+
+func decodeWordPayload(enc, text string) ([]byte, bool) {
+	switch enc {
+	case "b":
+		text = strings.TrimRight(text, "=")
+		if len(text)%4 == 1 { // 截断的编码字：丢弃无法成组的尾字符
+			text = text[:len(text)-1]
+		}
+		b, err := base64.RawStdEncoding.DecodeString(text)
+		if err != nil {
+			return nil, false
+		}
+		return b, true
+	case "q":
+		var out []byte
+		for i := 0; i < len(text); i++ {
+			c := text[i]
+			switch {
+			case c == '_':
+				out = append(out, ' ')
+			case c == '=' && i+2 < len(text):
+				b, err := strconv.ParseUint(text[i+1:i+3], 16, 8)
+				if err != nil {
+					return nil, false
+				}
+				out = append(out, byte(b))
+				i += 2
+			default:
+				out = append(out, c)
+			}
+		}
+		return out, true
+	}
+	return nil, false
+}
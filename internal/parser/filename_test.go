@@ -0,0 +1,62 @@
+package parser
+
+import (
+	"encoding/base64"
+	"net/url"
+	"testing"
+
+	"golang.org/x/text/encoding/simplifiedchinese"
+)
+
+func TestAttachmentFilenameDecoding(t *testing.T) {
+	gbkName := mustEncode(t, simplifiedchinese.GBK, "会议纪要.docx")
+	gbkB64 := base64.StdEncoding.EncodeToString(gbkName)
+	// 把 GBK 字节从中间（双字节字符内部）切开，模拟客户端把一个文件名拆成多个编码字
+	split1 := base64.StdEncoding.EncodeToString(gbkName[:3])
+	split2 := base64.StdEncoding.EncodeToString(gbkName[3:])
+
+	cases := []struct {
+		name       string
+		params     map[string]string
+		dispParams map[string]string
+		want       string
+	}{
+		{"plain", map[string]string{"name": "report.pdf"}, nil, "report.pdf"},
+		{"rfc2047 content-type name", map[string]string{"name": "=?gbk?B?" + gbkB64 + "?="}, nil, "会议纪要.docx"},
+		{"rfc2231 utf-8", nil, map[string]string{"filename*": "UTF-8''%E5%8F%91%E7%A5%A8.pdf"}, "发票.pdf"},
+		{"rfc2231 gbk", nil, map[string]string{"filename*": "gbk'zh-cn'" + url.PathEscape(string(gbkName))}, "会议纪要.docx"},
+		{"rfc2231 continuations", nil, map[string]string{
+			"filename*0*": "utf-8''%E5%B9%B4%E5%BA%A6",
+			"filename*1":  "_report",
+			"filename*2*": "%E6%8A%A5%E5%91%8A.xlsx",
+		}, "年度_report报告.xlsx"},
+		{"rfc2047 split across continuations", map[string]string{
+			"name*0": "=?gbk?B?" + gbkB64[:8],
+			"name*1": gbkB64[8:] + "?=",
+		}, nil, "会议纪要.docx"},
+		{"adjacent encoded words splitting a character", nil, map[string]string{
+			"filename": "=?gbk?B?" + split1 + "?= =?gbk?B?" + split2 + "?=",
+		}, "会议纪要.docx"},
+		{"raw 8bit gbk", nil, map[string]string{"filename": string(gbkName)}, "会议纪要.docx"},
+		{"disposition wins over content-type", map[string]string{"name": "a.txt"}, map[string]string{"filename": "b.txt"}, "b.txt"},
+		{"mixed case keys", map[string]string{"NAME*": "utf-8''%E9%99%84%E4%BB%B6"}, nil, "附件"},
+		{"missing", map[string]string{"charset": "utf-8"}, nil, ""},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := attachmentFilename(tc.params, tc.dispParams); got != tc.want {
+				t.Errorf("got %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestDecodeEncodedWordsKeepsSurroundingText(t *testing.T) {
+	got := decodeEncodedWords("Re: =?utf-8?Q?caf=C3=A9?= =?utf-8?B?5Lya6K6u?= notes")
+	if got != "Re: café会议 notes" {
+		t.Errorf("got %q", got)
+	}
+	if got := decodeEncodedWords("=?bogus?X?abc?="); got != "=?bogus?X?abc?=" {
+		t.Errorf("invalid word should stay untouched, got %q", got)
+	}
+}
@@ -0,0 +1,210 @@
+package parser
+
+import (
+	"bytes"
+	mailpkg "net/mail"
+	"regexp"
+	"strings"
+
+	"monitor-imap-webhook/internal/config"
+)
+
+// Forwarded 被转发的原始邮件：message/rfc822 附件或正文中内联转发的头部块
+type Forwarded struct {
+	Source          string       `json:"source"`                       // attachment | inline
+	Part            string       `json:"part,omitempty"`               // message/rfc822 的 IMAP part 编号（source=attachment）
+	Subject         string       `json:"subject,omitempty"`            // 原始主题
+	From            string       `json:"from,omitempty"`               // 原始发件人（原文）
+	FromAddress     *Address     `json:"from_address,omitempty"`       // 结构化原始发件人
+	To              []Address    `json:"to,omitempty"`                 // 原始收件人
+	Cc              []Address    `json:"cc,omitempty"`                 // 原始抄送
+	Date            string       `json:"date,omitempty"`               // 原始日期（原文）
+	MessageID       string       `json:"message_id,omitempty"`         // 原始 Message-ID（source=attachment）
+	Body            string       `json:"body,omitempty"`               // 原始正文（纯文本）
+	AttachmentNames []string     `json:"attachments,omitempty"`        // 原始邮件的附件文件名（去重）
+	Attachments     []Attachment `json:"attachments_detail,omitempty"` // 原始邮件的附件元数据，part 编号相对于外层邮件
+	Forwarded       []Forwarded  `json:"forwarded,omitempty"`          // 原始邮件中再次嵌套的转发
+}
+
+// maxForwardDepth message/rfc822 嵌套解析的最大层数
+const maxForwardDepth = 3
+
+// buildForwarded 收集 message/rfc822 附件（递归解析）与正文中的内联转发块。
+// 内联转发只识别明确的转发分隔行；主题带 Fwd: 等前缀时也接受 "Original Message" 与 Outlook 头部块。
+func buildForwarded(parts []mimePart, body, rawHTML string, fromHTML, isForward bool, cfg *config.Config) []Forwarded {
+	out := embeddedMessages(parts, cfg, 0)
+	text := body
+	if fromHTML && rawHTML != "" { // simple 模式的正文已合并换行，重新按行转换
+		text = htmlToText(removeStyleTags(rawHTML), "preserve-line")
+	}
+	if f := parseInlineForward(text, isForward); f != nil {
+		out = append(out, *f)
+	}
+	return out
+}
+
+// embeddedMessages 解析叶子 part 中的 message/rfc822（及 RFC 6532 的 message/global）
+func embeddedMessages(parts []mimePart, cfg *config.Config, depth int) []Forwarded {
+	var out []Forwarded
+	for i := range parts {
+		p := &parts[i]
+		if p.MediaType != "message/rfc822" && p.MediaType != "message/global" {
+			continue
+		}
+		email, err := mailpkg.ReadMessage(bytes.NewReader(p.Body))
+		if err != nil {
+			continue
+		}
+		hdr := email.Header
+		inner := walkParts(p.Body)
+		for j := range inner { // IMAP 编号：2 为 message/rfc822 时其内容为 2.1、2.2 ...
+			inner[j].Path = p.Path + "." + inner[j].Path
+		}
+		body, _, _, _ := extractBody(inner, cfg)
+		f := Forwarded{
+			Source:      "attachment",
+			Part:        p.Path,
+			Subject:     decodeHeader(hdr.Get("Subject")),
+			From:        decodeHeader(hdr.Get("From")),
+			FromAddress: parseAddress(hdr.Get("From")),
+			To:          parseAddressList(hdr.Get("To")),
+			Cc:          parseAddressList(hdr.Get("Cc")),
+			Date:        hdr.Get("Date"),
+			MessageID:   firstMsgID(hdr.Get("Message-Id")),
+			Body:        body,
+		}
+		if f.FromAddress != nil {
+			f.From = f.FromAddress.String()
+		}
+		f.Attachments = buildAttachments(inner, cfg.SkipInlineImages, cfg.AttachmentSHA256)
+		inspectArchives(f.Attachments, cfg)
+		seen := make(map[string]struct{})
+		for _, a := range f.Attachments {
+			if _, ok := seen[a.Filename]; !ok {
+				seen[a.Filename] = struct{}{}
+				f.AttachmentNames = append(f.AttachmentNames, a.Filename)
+			}
+		}
+		if depth+1 < maxForwardDepth {
+			f.Forwarded = embeddedMessages(inner, cfg, depth+1)
+		}
+		out = append(out, f)
+	}
+	return out
+}
+
+var (
+	// forwardMarkerRe 明确的转发分隔行（Gmail / Apple Mail / Thunderbird / 国内客户端）
+	forwardMarkerRe = regexp.MustCompile(`(?i)^[-_=*\s]*(forwarded message|begin forwarded message|original message follows|weitergeleitete nachricht|message transféré|mensaje reenviado|转发的邮件|转发邮件|轉寄的郵件|转发邮件信息)[-_=*\s]*[:：]?[-_=*\s]*$`)
+	// originalMarkerRe 回复与转发共用的分隔行，仅在主题为转发时采用
+	originalMarkerRe = regexp.MustCompile(`(?i)^[-_=*\s]*(original message|原始邮件|原始郵件|ursprüngliche nachricht|message d'origine)[-_=*\s]*[:：]?[-_=*\s]*$`)
+	// forwardFieldRe 转发头部块中的一行，如 "From: ..."、"*发件人:* ..."
+	forwardFieldRe  = regexp.MustCompile(`^\*{0,2}([^:：*]{1,20}?)\*{0,2}\s*[:：]\*{0,2}\s*(.*)$`)
+	mailtoBracketRe = regexp.MustCompile(`(?i)\[mailto:([^\]]+)\]`)
+)
+
+// forwardFields 头部块字段名（小写）到字段的映射
+var forwardFields = map[string]string{
+	"from": "from", "发件人": "from", "寄件者": "from", "寄件人": "from", "von": "from", "de": "from",
+	"date": "date", "sent": "date", "发送时间": "date", "日期": "date", "时间": "date", "寄件日期": "date", "gesendet": "date", "envoyé": "date", "datum": "date", "enviado": "date",
+	"subject": "subject", "主题": "subject", "主旨": "subject", "betreff": "subject", "objet": "subject", "asunto": "subject",
+	"to": "to", "收件人": "to", "an": "to", "à": "to", "para": "to",
+	"cc": "cc", "抄送": "cc", "副本": "cc",
+}
+
+// parseInlineForward 识别正文中的内联转发：分隔行之后的 From / Date / Subject / To 头部块及其后的原文。
+// 头部块中没有发件人时不视为转发。
+func parseInlineForward(text string, isForward bool) *Forwarded {
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	for i := range lines {
+		lines[i] = unquoteLine(lines[i])
+	}
+	for i, line := range lines {
+		start := -1
+		switch {
+		case forwardMarkerRe.MatchString(line):
+			start = i + 1
+		case isForward && originalMarkerRe.MatchString(line):
+			start = i + 1
+		case isForward && outlookFromRe.MatchString(line) && isQuoteHeader(lines, i):
+			start = i
+		}
+		if start < 0 {
+			continue
+		}
+		if f := parseForwardBlock(lines[start:]); f != nil {
+			return f
+		}
+	}
+	return nil
+}
+
+// parseForwardBlock 解析头部块（允许前导空行），空行或非头部行结束；其后为原文正文。lines 已去掉引用前缀。
+func parseForwardBlock(lines []string) *Forwarded {
+	f := &Forwarded{Source: "inline"}
+	i := 0
+	for i < len(lines) && lines[i] == "" {
+		i++
+	}
+	fields := 0
+	for ; i < len(lines); i++ {
+		m := forwardFieldRe.FindStringSubmatch(lines[i])
+		if m == nil {
+			break
+		}
+		key, ok := forwardFields[strings.ToLower(strings.TrimSpace(m[1]))]
+		if !ok {
+			break
+		}
+		fields++
+		value := strings.TrimSpace(m[2])
+		switch key {
+		case "from":
+			f.From = strings.TrimRight(value, ";；")
+			f.FromAddress = parseForwardAddress(f.From)
+		case "date":
+			f.Date = value
+		case "subject":
+			f.Subject = value
+		case "to":
+			f.To = parseForwardAddressList(value)
+		case "cc":
+			f.Cc = parseForwardAddressList(value)
+		}
+	}
+	if f.From == "" || fields < 2 {
+		return nil
+	}
+	f.Body = limitText(strings.TrimSpace(strings.Join(lines[i:], "\n")))
+	return f
+}
+
+// parseForwardAddress 兼容 Outlook 的 "Name [mailto:a@b]" 与 Foxmail 的 "\"Name\"<a@b>;" 写法
+func parseForwardAddress(v string) *Address {
+	list := parseForwardAddressList(v)
+	if len(list) == 0 {
+		return nil
+	}
+	return &list[0]
+}
+
+func parseForwardAddressList(v string) []Address {
+	v = mailtoBracketRe.ReplaceAllString(v, "<$1>")
+	v = strings.NewReplacer(";", ",", "；", ",").Replace(v)
+	var out []Address
+	for _, a := range parseAddressList(v) {
+		if strings.Contains(a.Address, "@") { // 无法识别的片段（如仅有姓名）不输出
+			out = append(out, a)
+		}
+	}
+	return out
+}
+
+// unquoteLine 去掉 "> " 引用前缀（Apple Mail 等把转发内容放在 blockquote 中）与首尾空白
+func unquoteLine(s string) string {
+	s = strings.TrimSpace(s)
+	for strings.HasPrefix(s, ">") {
+		s = strings.TrimSpace(s[1:])
+	}
+	return s
+}
@@ -0,0 +1,75 @@
+package parser
+
+import (
+	"strings"
+	"testing"
+
+	"monitor-imap-webhook/internal/config"
+)
+
+func TestForwardedAttachment(t *testing.T) {
+	inner := "From: =?UTF-8?B?5byg5LiJ?= <zhang@example.com>\r\n" +
+		"To: bob@example.com\r\n" +
+		"Subject: =?UTF-8?B?5Y6f5aeL6YKu5Lu2?=\r\n" +
+		"Date: Mon, 1 Apr 2024 09:00:00 +0800\r\n" +
+		"Message-ID: <orig-1@example.com>\r\n" +
+		"Content-Type: multipart/mixed; boundary=in\r\n\r\n" +
+		"--in\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n原始正文\r\n" +
+		"--in\r\nContent-Type: application/pdf; name=report.pdf\r\nContent-Disposition: attachment; filename=report.pdf\r\n\r\n%PDF\r\n" +
+		"--in--\r\n"
+	raw := "From: alice@example.com\r\nSubject: Fwd: 原始邮件\r\n" +
+		"Content-Type: multipart/mixed; boundary=out\r\n\r\n" +
+		"--out\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n请看附件\r\n" +
+		"--out\r\nContent-Type: message/rfc822\r\nContent-Disposition: attachment; filename=orig.eml\r\n\r\n" + inner +
+		"\r\n--out--\r\n"
+
+	msg, err := parseRaw([]byte(raw), nil, &config.Config{HTMLToTextMode: "simple"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Body != "请看附件" || len(msg.AttachmentNames) != 1 || msg.AttachmentNames[0] != "orig.eml" {
+		t.Fatalf("outer body=%q attachments=%v", msg.Body, msg.AttachmentNames)
+	}
+	if len(msg.Forwarded) != 1 {
+		t.Fatalf("forwarded=%+v", msg.Forwarded)
+	}
+	f := msg.Forwarded[0]
+	if f.Source != "attachment" || f.Part != "2" || f.Subject != "原始邮件" || f.From != "张三 <zhang@example.com>" ||
+		f.MessageID != "orig-1@example.com" || f.Body != "原始正文" || len(f.To) != 1 {
+		t.Fatalf("forwarded=%+v", f)
+	}
+	if len(f.Attachments) != 1 || f.Attachments[0].Filename != "report.pdf" || f.Attachments[0].PartPath != "2.2" {
+		t.Fatalf("attachments=%+v", f.Attachments)
+	}
+}
+
+func TestInlineForward(t *testing.T) {
+	gmail := "FYI\n\n---------- Forwarded message ---------\nFrom: Bob Smith <bob@example.com>\nDate: Mon, Apr 1, 2024 at 9:00 AM\nSubject: Quarterly report\nTo: <alice@example.com>\n\n\nHi Alice,\nsee attached.\n"
+	f := parseInlineForward(gmail, false)
+	if f == nil || f.Source != "inline" || f.FromAddress == nil || f.FromAddress.Address != "bob@example.com" ||
+		f.Subject != "Quarterly report" || f.Date != "Mon, Apr 1, 2024 at 9:00 AM" || len(f.To) != 1 || f.Body != "Hi Alice,\nsee attached." {
+		t.Fatalf("gmail=%+v", f)
+	}
+
+	apple := "Begin forwarded message:\n\n> From: Carol <carol@example.com>\n> Subject: Hello\n> Date: 1 April 2024\n> \n> Body line\n"
+	if f := parseInlineForward(apple, false); f == nil || f.FromAddress.Address != "carol@example.com" || f.Body != "Body line" {
+		t.Fatalf("apple=%+v", f)
+	}
+
+	outlook := "转给你\n________________________________\n发件人: 李四 [mailto:lisi@example.cn]\n发送时间: 2024年4月1日 9:00\n收件人: 王五 <wangwu@example.cn>; zhao@example.cn\n主题: 合同\n\n合同见附件"
+	if parseInlineForward(outlook, false) != nil {
+		t.Fatal("outlook header block without Fwd subject should not be a forward")
+	}
+	f = parseInlineForward(outlook, true)
+	if f == nil || f.FromAddress.Name != "李四" || f.FromAddress.Address != "lisi@example.cn" || len(f.To) != 2 || f.Subject != "合同" {
+		t.Fatalf("outlook=%+v", f)
+	}
+
+	reply := "Thanks\n\n-----Original Message-----\nFrom: x@example.com\nSent: today\n\nquoted"
+	if parseInlineForward(reply, false) != nil {
+		t.Fatal("original message in a reply should not be a forward")
+	}
+	if parseInlineForward(strings.Replace(gmail, "From:", "Note:", 1), false) != nil {
+		t.Fatal("block without sender should be ignored")
+	}
+}
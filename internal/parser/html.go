@@ -0,0 +1,456 @@
+package parser
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// htmlToText 基于 DOM 将 HTML 转为纯文本：
+//   - simple：折叠全部空白为单个空格；
+//   - preserve-line：保留段落/换行/列表/表格行结构，引用加 "> " 前缀；
+//   - markdown：输出 CommonMark（见 markdown.go）；
+//   - none：原样返回 HTML。
+//
+// 实体（命名与数字）由 html 解析器统一解码；链接在文本后附加 URL（与文本相同时省略）。
+func htmlToText(s, mode string) string {
+	if mode == "none" {
+		return s
+	}
+	doc, err := html.Parse(strings.NewReader(s))
+	if err != nil {
+		return strings.Join(strings.Fields(s), " ")
+	}
+	return nodeToText(doc, mode)
+}
+
+// nodeToText 将已解析的 DOM 按模式转为文本（mode 不为 none）
+func nodeToText(doc *html.Node, mode string) string {
+	md := mode == "markdown"
+	tb := &textBuilder{quotes: mode == "preserve-line" || md, md: md, lineStart: true}
+	tb.walk(doc)
+	text := tb.buf.String()
+	if mode != "preserve-line" && !md {
+		return strings.Join(strings.Fields(text), " ")
+	}
+	return tidyLines(text)
+}
+
+// tidyLines 去掉行尾空白，连续空行合并为一个
+func tidyLines(s string) string {
+	lines := strings.Split(s, "\n")
+	out := make([]string, 0, len(lines))
+	blank := 0
+	for _, l := range lines {
+		l = strings.TrimRightFunc(l, unicode.IsSpace)
+		if l == "" {
+			blank++
+			if blank > 1 {
+				continue
+			}
+		} else {
+			blank = 0
+		}
+		out = append(out, l)
+	}
+	return strings.TrimSpace(strings.Join(out, "\n"))
+}
+
+// skippedElements 不输出内容的元素
+var skippedElements = map[atom.Atom]bool{
+	atom.Head: true, atom.Script: true, atom.Style: true, atom.Title: true,
+	atom.Noscript: true, atom.Template: true, atom.Iframe: true, atom.Object: true,
+	atom.Svg: true, atom.Math: true, atom.Select: true, atom.Button: true,
+}
+
+// blockElements 块级元素：前后换行；paragraphElements 额外空一行
+var blockElements = map[atom.Atom]bool{
+	atom.Div: true, atom.Section: true, atom.Article: true, atom.Header: true,
+	atom.Footer: true, atom.Nav: true, atom.Aside: true, atom.Main: true,
+	atom.Address: true, atom.Center: true, atom.Form: true, atom.Fieldset: true,
+	atom.Figure: true, atom.Figcaption: true, atom.Dl: true, atom.Dt: true,
+	atom.Dd: true, atom.Caption: true, atom.Details: true, atom.Summary: true,
+}
+
+var paragraphElements = map[atom.Atom]bool{
+	atom.P: true, atom.H1: true, atom.H2: true, atom.H3: true, atom.H4: true,
+	atom.H5: true, atom.H6: true, atom.Pre: true, atom.Blockquote: true,
+	atom.Table: true, atom.Hr: true,
+}
+
+// textBuilder 按块/行内语义拼接文本。换行与空格延迟输出，避免多余空白。
+type textBuilder struct {
+	buf       strings.Builder
+	newlines  int      // 待输出的换行数
+	space     bool     // 待输出的空格
+	lineStart bool     // 当前位于行首（需输出前缀）
+	trailing  int      // 行首状态下已输出的连续换行数
+	prefix    []string // 行前缀栈（引用 "> "、列表续行缩进）
+	quotes    bool     // 是否输出引用前缀
+	pre       int      // <pre> 嵌套层数
+	cell      int      // 数据表格单元格嵌套层数（单元格内换行折叠为空格）
+	lists     []listState
+
+	md      bool   // markdown 输出
+	code    int    // 行内 <code> 嵌套层数（markdown 下不转义）
+	openTag string // 待输出的行内起始标记（**、[ 等），在下一段文本前输出
+
+	tableHeader bool // markdown 表格已输出表头分隔行
+}
+
+type listState struct {
+	ordered bool
+	n       int
+}
+
+func (t *textBuilder) prefixString() string {
+	return strings.Join(t.prefix, "")
+}
+
+// breakLine 请求至少 n 个换行（文首不输出）
+func (t *textBuilder) breakLine(n int) {
+	if t.buf.Len() == 0 {
+		return
+	}
+	if t.cell > 0 {
+		t.space = !strings.HasSuffix(t.buf.String(), " ")
+		return
+	}
+	if t.lineStart { // 已输出的换行计入
+		n -= t.trailing
+	}
+	if n > t.newlines {
+		t.newlines = n
+	}
+	t.space = false
+}
+
+// writeBreaks 输出待定换行（使用当前前缀补齐空行），不输出下一行前缀
+func (t *textBuilder) writeBreaks() {
+	if t.newlines > 0 {
+		p := t.prefixString()
+		for i := 0; i < t.newlines; i++ {
+			t.buf.WriteByte('\n')
+			if i < t.newlines-1 {
+				t.buf.WriteString(strings.TrimRight(p, " "))
+			}
+		}
+		if !t.lineStart {
+			t.trailing = 0
+		}
+		t.trailing += t.newlines
+		t.newlines, t.lineStart = 0, true
+	}
+}
+
+func (t *textBuilder) flush() {
+	t.writeBreaks()
+	if t.lineStart {
+		t.buf.WriteString(t.prefixString())
+		t.lineStart, t.space = false, false
+	} else if t.space {
+		t.buf.WriteByte(' ')
+		t.space = false
+	}
+	if t.openTag != "" {
+		t.buf.WriteString(t.openTag)
+		t.openTag = ""
+	}
+}
+
+// writeRaw 原样输出（列表标记、表格分隔等）
+func (t *textBuilder) writeRaw(s string) {
+	t.flush()
+	t.buf.WriteString(s)
+}
+
+func (t *textBuilder) writeText(s string) {
+	if t.pre > 0 {
+		for i, line := range strings.Split(s, "\n") {
+			if i > 0 {
+				t.newlines++
+			}
+			if line != "" {
+				t.writeRaw(line)
+			}
+		}
+		return
+	}
+	words := strings.Fields(s)
+	if len(words) == 0 {
+		if s != "" {
+			t.space = true
+		}
+		return
+	}
+	if r, _ := utf8.DecodeRuneInString(s); unicode.IsSpace(r) {
+		t.space = true
+	}
+	for i, w := range words {
+		if i > 0 {
+			t.space = true
+		}
+		if t.md && t.code == 0 {
+			w = escapeMarkdown(w, t.lineStart || t.newlines > 0)
+		}
+		t.writeRaw(w)
+	}
+	if r, _ := utf8.DecodeLastRuneInString(s); unicode.IsSpace(r) {
+		t.space = true
+	}
+}
+
+func (t *textBuilder) walk(n *html.Node) {
+	switch n.Type {
+	case html.TextNode:
+		t.writeText(n.Data)
+		return
+	case html.DocumentNode:
+		t.walkChildren(n)
+		return
+	case html.ElementNode:
+	default:
+		return
+	}
+	if skippedElements[n.DataAtom] {
+		return
+	}
+	if t.md && t.walkMarkdown(n) {
+		return
+	}
+	switch n.DataAtom {
+	case atom.Br:
+		t.newlines++
+		t.space = false
+		return
+	case atom.Img:
+		if alt := strings.TrimSpace(attr(n, "alt")); alt != "" {
+			t.writeText(" " + alt + " ")
+		}
+		return
+	case atom.Ul, atom.Ol:
+		t.breakLine(1)
+		if len(t.lists) == 0 {
+			t.breakLine(2)
+		}
+		start := 0
+		if v, err := strconv.Atoi(attr(n, "start")); err == nil {
+			start = v - 1
+		}
+		t.lists = append(t.lists, listState{ordered: n.DataAtom == atom.Ol, n: start})
+		t.walkChildren(n)
+		t.lists = t.lists[:len(t.lists)-1]
+		t.breakLine(1)
+		if len(t.lists) == 0 {
+			t.breakLine(2)
+		}
+		return
+	case atom.Li:
+		t.breakLine(1)
+		marker := "- "
+		if len(t.lists) > 0 {
+			l := &t.lists[len(t.lists)-1]
+			if l.ordered {
+				l.n++
+				marker = strconv.Itoa(l.n) + ". "
+			}
+		}
+		t.writeRaw(marker)
+		t.prefix = append(t.prefix, strings.Repeat(" ", len(marker)))
+		t.walkChildren(n)
+		t.prefix = t.prefix[:len(t.prefix)-1]
+		t.breakLine(1)
+		return
+	case atom.Table:
+		t.breakLine(2)
+		header := t.tableHeader
+		t.tableHeader = false
+		t.walkTable(n, isDataTable(n))
+		t.tableHeader = header
+		t.breakLine(2)
+		return
+	case atom.A:
+		t.walkLink(n)
+		return
+	case atom.Blockquote:
+		t.breakLine(2)
+		if t.quotes {
+			t.writeBreaks() // 引用前的空行不带 ">" 前缀
+			t.prefix = append(t.prefix, "> ")
+			t.walkChildren(n)
+			t.prefix = t.prefix[:len(t.prefix)-1]
+		} else {
+			t.walkChildren(n)
+		}
+		t.breakLine(2)
+		return
+	case atom.Pre:
+		t.breakLine(2)
+		t.pre++
+		t.walkChildren(n)
+		t.pre--
+		t.breakLine(2)
+		return
+	}
+	switch {
+	case paragraphElements[n.DataAtom]:
+		t.breakLine(2)
+		t.walkChildren(n)
+		t.breakLine(2)
+	case blockElements[n.DataAtom]:
+		t.breakLine(1)
+		t.walkChildren(n)
+		t.breakLine(1)
+	default:
+		t.walkChildren(n)
+	}
+}
+
+func (t *textBuilder) walkChildren(n *html.Node) {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		t.walk(c)
+	}
+}
+
+// walkLink 输出链接文本，并在其后附加 URL（文本即 URL 或为锚点/脚本链接时省略）
+func (t *textBuilder) walkLink(n *html.Node) {
+	start := t.buf.Len()
+	t.walkChildren(n)
+	href := strings.TrimSpace(attr(n, "href"))
+	text := strings.TrimSpace(t.buf.String()[start:])
+	target := linkTarget(href)
+	if target == "" || sameLinkText(text, target) {
+		return
+	}
+	if text == "" {
+		t.writeText(" " + target + " ")
+		return
+	}
+	t.space = true
+	t.writeRaw("(" + target + ")")
+}
+
+// linkTarget 返回需要展示的链接地址；mailto: 仅展示邮箱
+func linkTarget(href string) string {
+	lower := strings.ToLower(href)
+	switch {
+	case strings.HasPrefix(lower, "http://"), strings.HasPrefix(lower, "https://"), strings.HasPrefix(lower, "ftp://"):
+		return href
+	case strings.HasPrefix(lower, "mailto:"):
+		addr, _, _ := strings.Cut(href[len("mailto:"):], "?")
+		return addr
+	}
+	return ""
+}
+
+func sameLinkText(text, target string) bool {
+	norm := func(s string) string {
+		s = strings.ToLower(strings.TrimSpace(s))
+		for _, p := range []string{"https://", "http://", "mailto:"} {
+			s = strings.TrimPrefix(s, p)
+		}
+		return strings.TrimSuffix(s, "/")
+	}
+	return norm(text) == norm(target) || strings.Contains(text, target)
+}
+
+// isDataTable 区分数据表格与排版表格：嵌套表格、role=presentation 或存在单列行的视为排版表格，
+// 排版表格的单元格按块输出，数据表格每行一条、单元格以 " | " 分隔。
+func isDataTable(table *html.Node) bool {
+	if r := strings.ToLower(attr(table, "role")); r == "presentation" || r == "none" {
+		return false
+	}
+	data := true
+	rows := 0
+	var visit func(n *html.Node)
+	visit = func(n *html.Node) {
+		for c := n.FirstChild; c != nil && data; c = c.NextSibling {
+			if c.Type != html.ElementNode {
+				continue
+			}
+			switch c.DataAtom {
+			case atom.Table:
+				data = false
+			case atom.Tr:
+				rows++
+				cells := 0
+				for td := c.FirstChild; td != nil; td = td.NextSibling {
+					if td.Type == html.ElementNode && (td.DataAtom == atom.Td || td.DataAtom == atom.Th) {
+						cells++
+						visit(td)
+					}
+				}
+				if cells < 2 {
+					data = false
+				}
+			default:
+				visit(c)
+			}
+		}
+	}
+	visit(table)
+	return data && rows > 0
+}
+
+func (t *textBuilder) walkTable(n *html.Node, data bool) {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type != html.ElementNode {
+			t.walk(c)
+			continue
+		}
+		switch c.DataAtom {
+		case atom.Tr:
+			t.breakLine(1)
+			cell := 0
+			for td := c.FirstChild; td != nil; td = td.NextSibling {
+				if td.Type != html.ElementNode || (td.DataAtom != atom.Td && td.DataAtom != atom.Th) {
+					continue
+				}
+				if data {
+					if cell > 0 {
+						t.space = false
+						t.writeRaw(" | ")
+					} else if t.md {
+						t.writeRaw("| ")
+					}
+					t.cell++
+					t.walkChildren(td)
+					t.cell--
+				} else {
+					t.breakLine(1)
+					t.walkChildren(td)
+					t.breakLine(1)
+				}
+				cell++
+			}
+			if t.md && data && cell > 0 {
+				t.space = false
+				t.writeRaw(" |")
+				if !t.tableHeader {
+					t.tableHeader = true
+					t.breakLine(1)
+					t.writeRaw("|" + strings.Repeat(" --- |", cell))
+				}
+			}
+			t.breakLine(1)
+		case atom.Thead, atom.Tbody, atom.Tfoot:
+			t.walkTable(c, data)
+		default:
+			t.walk(c)
+		}
+	}
+}
+
+// attr 返回元素属性值（属性名不区分大小写，解析器已统一小写）
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
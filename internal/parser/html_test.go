@@ -0,0 +1,64 @@
+package parser
+
+import (
+	"strings"
+	"testing"
+)
+
+const richHTML = `<html><head><title>T</title><style>p{color:red}</style></head><body>
+<h1>Hello &amp; welcome</h1>
+<p>Price: &#165;100 &euro;5 &#x4F60;&#x597D;<br >next<BR/>line</p>
+<ul><li>One</li><li>Two<ol start="3"><li>sub a</li><li>sub b</li></ol></li></ul>
+<table><tr><th>Name</th><th>Qty</th></tr><tr><td>Apple</td><td>3</td></tr></table>
+<table role="presentation"><tr><td><p>Layout cell</p></td></tr></table>
+<p>See <a href="https://example.com/x?a=1&amp;b=2">our site</a>, or <a href="https://example.com">https://example.com</a>.</p>
+<blockquote><p>quoted <b>text</b></p></blockquote>
+<div title="a>b">attr</div><script>alert(1)</script>
+</body></html>`
+
+func TestHTMLToTextPreserveLine(t *testing.T) {
+	got := htmlToText(richHTML, "preserve-line")
+	want := strings.Join([]string{
+		"Hello & welcome",
+		"",
+		"Price: ¥100 €5 你好",
+		"next",
+		"line",
+		"",
+		"- One",
+		"- Two",
+		"  3. sub a",
+		"  4. sub b",
+		"",
+		"Name | Qty",
+		"Apple | 3",
+		"",
+		"Layout cell",
+		"",
+		"See our site (https://example.com/x?a=1&b=2), or https://example.com.",
+		"",
+		"> quoted text",
+		"",
+		"attr",
+	}, "\n")
+	if got != want {
+		t.Fatalf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestHTMLToTextSimple(t *testing.T) {
+	got := htmlToText(`<p>a&nbsp;&nbsp;b</p><p>c <a href="mailto:x@y.com?subject=hi">mail</a></p>`, "simple")
+	if got != "a b c mail (x@y.com)" {
+		t.Fatalf("got %q", got)
+	}
+	if got := htmlToText("<p>x</p>", "none"); got != "<p>x</p>" {
+		t.Fatalf("none mode changed input: %q", got)
+	}
+}
+
+func TestHTMLToTextPre(t *testing.T) {
+	got := htmlToText("<p>code:</p><pre>  a := 1\n  b := 2</pre>", "preserve-line")
+	if got != "code:\n\n  a := 1\n  b := 2" {
+		t.Fatalf("got %q", got)
+	}
+}
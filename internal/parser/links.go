@@ -0,0 +1,207 @@
+package parser
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// Link 正文中的超链接
+type Link struct {
+	URL      string `json:"url"`
+	Text     string `json:"text,omitempty"`     // 锚文本（HTML）或图片 alt
+	Source   string `json:"source"`             // html | text
+	Original string `json:"original,omitempty"` // 解包跟踪跳转前的原始链接
+}
+
+// Unsubscribe List-Unsubscribe / List-Unsubscribe-Post（RFC 2369 / RFC 8058）
+type Unsubscribe struct {
+	URLs     []string `json:"urls,omitempty"`   // http(s) 退订地址
+	Mailto   []string `json:"mailto,omitempty"` // mailto: 退订地址（含 subject 等参数）
+	OneClick bool     `json:"one_click"`        // 支持一键退订：向 URL POST "List-Unsubscribe=One-Click"
+}
+
+// maxUnwrapDepth 嵌套跳转（如 safelinks 包 google）最多解包层数
+const maxUnwrapDepth = 3
+
+// textURLRe 纯文本中的 URL；结尾标点另行去除
+var textURLRe = regexp.MustCompile(`(?i)\bhttps?://[^\s<>"'` + "`" + `]+`)
+
+// extractLinks 按出现顺序提取 HTML 与纯文本正文中的 http(s) 链接并去重；
+// unwrap 时把已知跟踪跳转还原为目标地址。
+func extractLinks(rawHTML, text string, unwrap bool) []Link {
+	var links []Link
+	index := make(map[string]int)
+	add := func(u, anchor, source string) {
+		u = strings.TrimSpace(u)
+		lower := strings.ToLower(u)
+		if !strings.HasPrefix(lower, "http://") && !strings.HasPrefix(lower, "https://") {
+			return
+		}
+		l := Link{URL: u, Text: anchor, Source: source}
+		if unwrap {
+			if target := unwrapURL(u); target != u {
+				l.URL, l.Original = target, u
+			}
+		}
+		if i, ok := index[l.URL]; ok {
+			if links[i].Text == "" {
+				links[i].Text = anchor
+			}
+			return
+		}
+		index[l.URL] = len(links)
+		links = append(links, l)
+	}
+	if rawHTML != "" {
+		if doc, err := html.Parse(strings.NewReader(removeStyleTags(rawHTML))); err == nil {
+			var visit func(*html.Node)
+			visit = func(n *html.Node) {
+				if n.Type == html.ElementNode && (n.DataAtom == atom.A || n.DataAtom == atom.Area) {
+					add(attr(n, "href"), anchorText(n), "html")
+				}
+				for c := n.FirstChild; c != nil; c = c.NextSibling {
+					visit(c)
+				}
+			}
+			visit(doc)
+		}
+	}
+	for _, m := range textURLRe.FindAllString(text, -1) {
+		add(trimURLPunct(m), "", "text")
+	}
+	return links
+}
+
+// anchorText 链接文字（合并空白）；纯图片链接取 alt
+func anchorText(a *html.Node) string {
+	if t := strings.Join(strings.Fields(nodeText(a)), " "); t != "" {
+		return t
+	}
+	if a.DataAtom == atom.Area {
+		return strings.TrimSpace(attr(a, "alt"))
+	}
+	var alt string
+	var visit func(*html.Node)
+	visit = func(n *html.Node) {
+		if alt == "" && n.Type == html.ElementNode && n.DataAtom == atom.Img {
+			alt = strings.TrimSpace(attr(n, "alt"))
+		}
+		for c := n.FirstChild; c != nil && alt == ""; c = c.NextSibling {
+			visit(c)
+		}
+	}
+	visit(a)
+	return alt
+}
+
+// trimURLPunct 去掉纯文本 URL 结尾的句读；右括号仅在不配对时去掉（保留 wiki 风格的 (...) 链接）
+func trimURLPunct(u string) string {
+	for len(u) > 0 {
+		last := u[len(u)-1]
+		switch {
+		case strings.IndexByte(".,;:!?'\"", last) >= 0:
+			u = u[:len(u)-1]
+		case last == ')' && strings.Count(u, "(") < strings.Count(u, ")"),
+			last == ']' && strings.Count(u, "[") < strings.Count(u, "]"),
+			last == '}' && strings.Count(u, "{") < strings.Count(u, "}"):
+			u = u[:len(u)-1]
+		default:
+			return u
+		}
+	}
+	return u
+}
+
+// redirectParams 已知跟踪跳转服务及其携带目标地址的查询参数
+var redirectParams = []struct {
+	host  string // 主机名后缀
+	path  string // 路径前缀，空表示任意
+	param string
+}{
+	{"safelinks.protection.outlook.com", "", "url"}, // Microsoft Defender Safe Links
+	{"google.com", "/url", "q"},
+	{"google.com", "/url", "url"},
+	{"l.facebook.com", "/l.php", "u"},
+	{"lm.facebook.com", "/l.php", "u"},
+	{"slack-redir.net", "/link", "url"},
+	{"urldefense.proofpoint.com", "/v2/url", "u"}, // Proofpoint v2："-" 代替 "%"，"_" 代替 "/"
+	{"youtube.com", "/redirect", "q"},
+	{"mandrillapp.com", "/track/click", "url"},
+}
+
+// proofpointV3Re Proofpoint v3：https://urldefense.com/v3/__<url>__;<校验段>
+var proofpointV3Re = regexp.MustCompile(`^https://urldefense\.com/v3/__(.+?)__;`)
+
+// unwrapURL 还原已知跟踪跳转的目标地址；无法识别时原样返回
+func unwrapURL(raw string) string {
+	cur := raw
+	for i := 0; i < maxUnwrapDepth; i++ {
+		next := unwrapOnce(cur)
+		if next == "" || next == cur {
+			break
+		}
+		cur = next
+	}
+	return cur
+}
+
+func unwrapOnce(raw string) string {
+	if m := proofpointV3Re.FindStringSubmatch(raw); m != nil {
+		return m[1]
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return ""
+	}
+	host := strings.ToLower(u.Hostname())
+	for _, r := range redirectParams {
+		if host != r.host && !strings.HasSuffix(host, "."+r.host) {
+			continue
+		}
+		if r.path != "" && !strings.HasPrefix(u.Path, r.path) {
+			continue
+		}
+		target := u.Query().Get(r.param)
+		if r.host == "urldefense.proofpoint.com" {
+			target = strings.NewReplacer("-", "%", "_", "/").Replace(target)
+			if t, err := url.QueryUnescape(target); err == nil {
+				target = t
+			}
+		}
+		lower := strings.ToLower(target)
+		if strings.HasPrefix(lower, "http://") || strings.HasPrefix(lower, "https://") {
+			return target
+		}
+	}
+	return ""
+}
+
+var angleListRe = regexp.MustCompile(`<([^>]*)>`)
+
+// parseUnsubscribe 解析 List-Unsubscribe（尖括号内的 URI 列表）与 List-Unsubscribe-Post
+func parseUnsubscribe(listUnsub, listUnsubPost string) *Unsubscribe {
+	if strings.TrimSpace(listUnsub) == "" {
+		return nil
+	}
+	u := &Unsubscribe{}
+	for _, m := range angleListRe.FindAllStringSubmatch(listUnsub, -1) {
+		v := strings.Join(strings.Fields(m[1]), "") // 折行可能在 URI 中间插入空白
+		lower := strings.ToLower(v)
+		switch {
+		case strings.HasPrefix(lower, "http://"), strings.HasPrefix(lower, "https://"):
+			u.URLs = append(u.URLs, v)
+		case strings.HasPrefix(lower, "mailto:"):
+			u.Mailto = append(u.Mailto, v)
+		}
+	}
+	if len(u.URLs) == 0 && len(u.Mailto) == 0 {
+		return nil
+	}
+	// RFC 8058：必须同时提供 https URL
+	u.OneClick = len(u.URLs) > 0 && strings.EqualFold(strings.Join(strings.Fields(listUnsubPost), ""), "List-Unsubscribe=One-Click")
+	return u
+}
@@ -0,0 +1,74 @@
+package parser
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+
+	"monitor-imap-webhook/internal/config"
+)
+
+func TestExtractLinks(t *testing.T) {
+	safe := "https://nam12.safelinks.protection.outlook.com/?url=" + url.QueryEscape("https://www.google.com/url?q="+url.QueryEscape("https://example.com/report.pdf")) + "&data=x"
+	rawHTML := `<p>请 <a href="https://example.com/confirm?token=a&amp;b=1"> 点击 <b>确认</b> </a></p>
+<a href="` + safe + `">下载报告</a>
+<a href="https://example.com/confirm?token=a&b=1">again</a>
+<a href="mailto:x@example.com">mail</a><a href="#top">top</a>
+<a href="https://example.com/logo"><img src="cid:logo" alt="Logo"></a>`
+	text := "See https://example.com/docs/(v2)/index.html, and (https://example.org/path).\nAlso https://example.com/confirm?token=a&b=1"
+
+	links := extractLinks(rawHTML, text, false)
+	want := []Link{
+		{URL: "https://example.com/confirm?token=a&b=1", Text: "点击 确认", Source: "html"},
+		{URL: safe, Text: "下载报告", Source: "html"},
+		{URL: "https://example.com/logo", Text: "Logo", Source: "html"},
+		{URL: "https://example.com/docs/(v2)/index.html", Source: "text"},
+		{URL: "https://example.org/path", Source: "text"},
+	}
+	if !reflect.DeepEqual(links, want) {
+		t.Fatalf("links=%+v", links)
+	}
+
+	links = extractLinks(rawHTML, "", true)
+	if links[1].URL != "https://example.com/report.pdf" || links[1].Original != safe {
+		t.Fatalf("unwrap=%+v", links[1])
+	}
+}
+
+func TestUnwrapURL(t *testing.T) {
+	cases := map[string]string{
+		"https://urldefense.proofpoint.com/v2/url?u=https-3A__example.com_a-3Fb-3D1&d=DwMF": "https://example.com/a?b=1",
+		"https://urldefense.com/v3/__https://example.com/x__;!!abc$":                        "https://example.com/x",
+		"https://l.facebook.com/l.php?u=https%3A%2F%2Fexample.com%2F&h=AT0":                 "https://example.com/",
+		"https://example.com/login?redirect=https%3A%2F%2Fexample.com%2Fhome":               "https://example.com/login?redirect=https%3A%2F%2Fexample.com%2Fhome",
+		"https://www.google.com/search?q=https%3A%2F%2Fexample.com":                         "https://www.google.com/search?q=https%3A%2F%2Fexample.com",
+	}
+	for in, want := range cases {
+		if got := unwrapURL(in); got != want {
+			t.Errorf("unwrapURL(%q)=%q want %q", in, got, want)
+		}
+	}
+}
+
+func TestParseUnsubscribe(t *testing.T) {
+	raw := "From: news@example.com\r\nSubject: weekly\r\n" +
+		"List-Unsubscribe: <mailto:unsub@example.com?subject=unsubscribe>,\r\n <https://example.com/unsub?id=\r\n 42>\r\n" +
+		"List-Unsubscribe-Post: List-Unsubscribe=One-Click\r\n\r\nhello https://example.com/a\r\n"
+	msg, err := parseRaw([]byte(raw), nil, &config.Config{HTMLToTextMode: "simple", ExtractLinks: true})
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	u := msg.Unsubscribe
+	if u == nil || !u.OneClick || !reflect.DeepEqual(u.URLs, []string{"https://example.com/unsub?id=42"}) || !reflect.DeepEqual(u.Mailto, []string{"mailto:unsub@example.com?subject=unsubscribe"}) {
+		t.Fatalf("unsubscribe=%+v", u)
+	}
+	if len(msg.Links) != 1 || msg.Links[0].URL != "https://example.com/a" {
+		t.Fatalf("links=%+v", msg.Links)
+	}
+	if parseUnsubscribe("<mailto:a@example.com>", "List-Unsubscribe=One-Click").OneClick {
+		t.Fatal("one-click requires an http(s) URL")
+	}
+	if parseUnsubscribe("", "") != nil {
+		t.Fatal("expected nil")
+	}
+}
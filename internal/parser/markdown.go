@@ -0,0 +1,169 @@
+package parser
+
+import (
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// walkMarkdown 处理 markdown 模式下有专门语法的元素，返回 false 时交给 walk 的通用逻辑
+// （段落、列表、引用、表格结构与纯文本模式共用）。
+func (t *textBuilder) walkMarkdown(n *html.Node) bool {
+	switch n.DataAtom {
+	case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+		t.breakLine(2)
+		level := int(n.Data[1] - '0')
+		t.wrapInline(n, strings.Repeat("#", level)+" ", "")
+		t.breakLine(2)
+	case atom.B, atom.Strong:
+		t.wrapInline(n, "**", "**")
+	case atom.I, atom.Em:
+		t.wrapInline(n, "*", "*")
+	case atom.Code, atom.Kbd, atom.Samp, atom.Tt:
+		if t.pre > 0 {
+			t.walkChildren(n)
+			return true
+		}
+		t.code++
+		t.wrapInline(n, "`", "`")
+		t.code--
+	case atom.Pre:
+		t.breakLine(2)
+		fence := "```"
+		if strings.Contains(nodeText(n), "```") {
+			fence = "~~~"
+		}
+		t.writeRaw(fence + codeLanguage(n))
+		t.newlines++
+		t.pre++
+		t.code++
+		t.walkChildren(n)
+		t.pre--
+		t.code--
+		t.breakLine(1)
+		t.writeRaw(fence)
+		t.breakLine(2)
+	case atom.A:
+		href := strings.TrimSpace(attr(n, "href"))
+		if linkTarget(href) == "" {
+			t.walkChildren(n)
+			return true
+		}
+		if !t.wrapInline(n, "[", "]("+markdownURL(href)+")") {
+			t.writeRaw("<" + href + ">")
+		}
+	case atom.Img:
+		src := strings.TrimSpace(attr(n, "src"))
+		alt := strings.TrimSpace(attr(n, "alt"))
+		if src == "" {
+			if alt != "" {
+				t.writeText(" " + alt + " ")
+			}
+			return true
+		}
+		t.writeRaw("![" + escapeMarkdown(alt, false) + "](" + markdownURL(src) + ")")
+	case atom.Hr:
+		t.breakLine(2)
+		t.writeRaw("---")
+		t.breakLine(2)
+	case atom.Br:
+		if t.cell > 0 {
+			t.space = true
+			return true
+		}
+		if !t.lineStart && t.newlines == 0 {
+			t.buf.WriteString("\\") // CommonMark 硬换行
+		}
+		t.newlines++
+		t.space = false
+	default:
+		return false
+	}
+	return true
+}
+
+// wrapInline 以 open/close 包裹子节点内容；内容为空时不输出标记并返回 false
+func (t *textBuilder) wrapInline(n *html.Node, open, close string) bool {
+	before := t.openTag
+	t.openTag += open
+	t.walkChildren(n)
+	if t.openTag == before+open { // 起始标记仍未输出：没有内容
+		t.openTag = before
+		return false
+	}
+	t.buf.WriteString(close)
+	return true
+}
+
+// markdownURL 含空白或括号的 URL 使用尖括号形式
+func markdownURL(u string) string {
+	if strings.ContainsAny(u, " ()<>") {
+		return "<" + strings.NewReplacer("<", "%3C", ">", "%3E").Replace(u) + ">"
+	}
+	return u
+}
+
+// codeLanguage 从 <pre><code class="language-go"> 中取语言标识
+func codeLanguage(pre *html.Node) string {
+	for c := pre.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.ElementNode && c.DataAtom == atom.Code {
+			for _, cls := range strings.Fields(attr(c, "class")) {
+				if lang, ok := strings.CutPrefix(cls, "language-"); ok {
+					return lang
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// nodeText 返回节点下全部文本
+func nodeText(n *html.Node) string {
+	var b strings.Builder
+	var visit func(*html.Node)
+	visit = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			b.WriteString(n.Data)
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			visit(c)
+		}
+	}
+	visit(n)
+	return b.String()
+}
+
+var markdownEscaper = strings.NewReplacer(`\`, `\\`, "*", `\*`, "`", "\\`", "[", `\[`, "]", `\]`, "|", `\|`)
+
+// escapeMarkdown 转义单个词中的 markdown 语法字符；lineStart 时额外处理行首的
+// 标题 / 引用 / 列表标记。下划线仅在词首尾转义（词内下划线不会触发强调）。
+func escapeMarkdown(w string, lineStart bool) string {
+	w = markdownEscaper.Replace(w)
+	if strings.HasPrefix(w, "_") {
+		w = `\` + w
+	}
+	if len(w) > 1 && strings.HasSuffix(w, "_") && !strings.HasSuffix(w, `\_`) {
+		w = w[:len(w)-1] + `\_`
+	}
+	if !lineStart || w == "" {
+		return w
+	}
+	switch w[0] {
+	case '#', '>', '+':
+		return `\` + w
+	case '-', '=':
+		if strings.Trim(w, string(w[0])) == "" {
+			return `\` + w
+		}
+	}
+	// "1." / "2)" 会被识别为有序列表
+	i := 0
+	for i < len(w) && w[i] >= '0' && w[i] <= '9' {
+		i++
+	}
+	if i > 0 && i == len(w)-1 && (w[i] == '.' || w[i] == ')') {
+		return w[:i] + `\` + w[i:]
+	}
+	return w
+}
@@ -0,0 +1,67 @@
+package parser
+
+import (
+	"strings"
+	"testing"
+
+	"monitor-imap-webhook/internal/config"
+)
+
+func TestHTMLToMarkdown(t *testing.T) {
+	h := `<h2>Order <em>#42</em></h2><p>Hi <b>Bob</b>, total is <strong></strong>*5* [x] <code>a_b</code>.<br>Thanks</p>
+<ul><li>One <a href="https://ex.com/a b">link</a></li><li>Two<ol><li>sub</li></ol></li></ul>
+<table><tr><th>Name</th><th>Qty</th></tr><tr><td>A|B</td><td><p>3</p></td></tr></table>
+<blockquote><p>quoted</p></blockquote><pre><code class="language-go">x := 1
+y := 2</code></pre><hr><p><img src="cid:logo@x" alt="Logo"> <a href="https://ex.com"></a></p>`
+	want := strings.Join([]string{
+		"## Order *#42*",
+		"",
+		"Hi **Bob**, total is \\*5\\* \\[x\\] `a_b`.\\",
+		"Thanks",
+		"",
+		"- One [link](<https://ex.com/a b>)",
+		"- Two",
+		"  1. sub",
+		"",
+		"| Name | Qty |",
+		"| --- | --- |",
+		"| A\\|B | 3 |",
+		"",
+		"> quoted",
+		"",
+		"```go",
+		"x := 1",
+		"y := 2",
+		"```",
+		"",
+		"---",
+		"",
+		"![Logo](cid:logo@x) <https://ex.com>",
+	}, "\n")
+	if got := htmlToText(h, "markdown"); got != want {
+		t.Fatalf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestEscapeMarkdownLineStart(t *testing.T) {
+	cases := map[string]string{"#tag": `\#tag`, "1.": `1\.`, "-": `\-`, "_x_": `\_x\_`, "snake_case": "snake_case"}
+	for in, want := range cases {
+		if got := escapeMarkdown(in, true); got != want {
+			t.Errorf("%q => %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestParseMarkdownMode(t *testing.T) {
+	raw := "Subject: md\r\nContent-Type: text/html; charset=utf-8\r\n\r\n<p>Hello <b>World</b></p><p>Bye</p>\r\n"
+	msg, err := parseRaw([]byte(raw), nil, &config.Config{HTMLToTextMode: "markdown"})
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if msg.Body != "Hello World\n\nBye" {
+		t.Fatalf("body=%q", msg.Body)
+	}
+	if msg.BodyMarkdown != "Hello **World**\n\nBye" {
+		t.Fatalf("markdown=%q", msg.BodyMarkdown)
+	}
+}
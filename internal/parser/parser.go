@@ -7,17 +7,16 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"log"
 	"mime"
 	"mime/quotedprintable"
 	mailpkg "net/mail"
 	"regexp"
 	"strings"
+	"time"
 
 	imap "github.com/emersion/go-imap"
 	"github.com/emersion/go-imap/client"
 	"github.com/emersion/go-message/charset"
-	"github.com/emersion/go-message/textproto"
 
 	"monitor-imap-webhook/internal/config"
 )
@@ -33,24 +32,70 @@ type Message struct {
 	From            string
 	Date            string
 	Body            string
+	BodyNew         string           // 剥离引用历史与签名后的新内容（strip_quotes 启用时）
 	RawHTML         string           // 原始 HTML (若存在且启用)
+	BodyMarkdown    string           // HTML 正文转换的 CommonMark（html2text=markdown 时）
 	Blocks          []map[string]any // 结构化 blocks (若启用)
 	HasAttachments  bool             // 是否存在附件
 	AttachmentNames []string         // 附件文件名列表
+	Attachments     []Attachment     // 附件详细元数据（含解码内容）
+	BodyCharset     string           // 正文实际使用的字符集（已转换为 UTF-8）
+	CharsetDetected bool             // 字符集是否来自启发式探测（声明缺失或错误）
+
+	FromAddress    *Address            // 结构化发件人
+	To             []Address           // 收件人
+	Cc             []Address           // 抄送
+	ReplyTo        []Address           // 回复地址
+	Sender         *Address            // Sender 头部（代发）
+	MessageID      string              // Message-ID（不含尖括号）
+	InReplyTo      string              // In-Reply-To 首个 ID
+	References     []string            // References ID 列表（按出现顺序）
+	ListID         string              // List-Id 列表标识
+	ReturnPath     string              // Return-Path 退信地址
+	InternalDate   time.Time           // IMAP INTERNALDATE
+	Size           uint32              // IMAP RFC822.SIZE（字节）
+	Headers        map[string][]string // include_headers 白名单内的原始头部
+	ThreadID       string              // 会话 ID（同一会话内稳定）
+	ThreadSource   string              // 会话 ID 来源，见 ThreadSource* 常量
+	IsReply        bool                // 回复邮件（Re: 等前缀或带 In-Reply-To）
+	IsForward      bool                // 转发邮件（Fwd: / 转发: 等前缀）
+	Calendar       *Calendar           // text/calendar 会议邀请（无则为 nil）
+	Bounce         *Bounce             // 退信 / DSN 解析结果（非退信为 nil）
+	AutoMail       *AutoMail           // 自动回复 / 自动生成 / 群发 / 回环邮件（普通邮件为 nil）
+	Category       string              // 启发式分类：transactional | newsletter | notification | personal
+	Auth           *Auth               // SPF / DKIM / DMARC / ARC 认证结论（无认证信息为 nil）
+	Security       *Security           // S/MIME / PGP 签名与加密信息（非签名 / 加密邮件为 nil）
+	Links          []Link              // 正文超链接（extract_links 或 risk_analysis 启用时）
+	Unsubscribe    *Unsubscribe        // List-Unsubscribe 退订信息
+	Extracted      map[string]any      // extractors 规则的提取结果
+	StructuredData []StructuredItem    // HTML 中的 schema.org JSON-LD / microdata 对象
+	Forwarded      []Forwarded         // 转发的原始邮件（message/rfc822 附件与内联转发）
 }
 
 // FetchAndParse retrieves a message by UID and parses it.
 // FetchAndParse retrieves a message by UID and parses it.
 func FetchAndParse(exec func(ctx context.Context, op string, fn func(c *client.Client) error) error, cfg *config.Config, uid uint32) (*Message, error) {
-	// We'll store parsed message in outer scope
-	var parsed *Message
+	// 连接上只做 fetch 与会话查询；解析（解密、DKIM、附件扫描等）在释放连接后进行，
+	// 避免慢解析阻塞 IDLE 与其他邮件的 fetch
+	var (
+		fetched          *imap.Message
+		raw              []byte
+		threadID, source string
+	)
 	// use background context for now (could pass a caller ctx)
 	ctx := context.Background()
 	err := exec(ctx, "fetch", func(c *client.Client) error {
 		seqset := new(imap.SeqSet)
 		seqset.AddNum(uid)
 		section := &imap.BodySectionName{}
-		items := []imap.FetchItem{imap.FetchEnvelope, imap.FetchUid, imap.FetchBodyStructure, imap.FetchFlags, section.FetchItem()}
+		items := []imap.FetchItem{imap.FetchEnvelope, imap.FetchUid, imap.FetchFlags, imap.FetchInternalDate, imap.FetchRFC822Size, section.FetchItem()}
+		gmail := false
+		if cfg.ThreadMode == "server" {
+			gmail, _ = c.Support("X-GM-EXT-1")
+			if gmail {
+				items = append(items, gmThreadItem)
+			}
+		}
 		ch := make(chan *imap.Message, 1)
 		if err := c.UidFetch(seqset, items, ch); err != nil {
 			return fmt.Errorf("uid fetch: %w", err)
@@ -59,106 +104,113 @@ func FetchAndParse(exec func(ctx context.Context, op string, fn func(c *client.C
 		if msg == nil {
 			return errors.New("message not found")
 		}
-		var raw []byte
 		if lit := msg.GetBody(section); lit != nil {
 			buf := new(bytes.Buffer)
 			io.Copy(buf, lit)
 			raw = buf.Bytes()
 		}
-		p, perr := parseRaw(raw, msg, cfg)
-		if perr != nil {
-			return perr
+		fetched = msg
+		if cfg.ThreadMode == "server" {
+			if id := gmailThreadID(msg); gmail && id != "" {
+				threadID, source = id, ThreadSourceGmail
+			} else if ok, _ := c.Support("THREAD=REFERENCES"); ok {
+				// THREAD 失败不影响投递，保留头部计算结果
+				if id, terr := serverThreadID(c, msg.Uid); terr == nil && id != "" {
+					threadID, source = id, ThreadSourceServer
+				}
+			}
 		}
-		p.UID = msg.Uid
-		parsed = p
 		return nil
 	})
 	if err != nil {
 		return nil, err
 	}
+	parsed, err := parseRaw(raw, fetched, cfg)
+	if err != nil {
+		return nil, err
+	}
+	parsed.UID = fetched.Uid
+	if threadID != "" {
+		parsed.ThreadID, parsed.ThreadSource = threadID, source
+	}
 	return parsed, nil
 }
 
 func parseRaw(raw []byte, im *imap.Message, cfg *config.Config) (*Message, error) {
-	email, err := mailpkg.ReadMessage(bytes.NewReader(raw))
+	// 解密 / 不透明签名时 content 为外层头部 + 内层实体；DKIM 等仍基于原始字节
+	content, sec := unwrapSecurity(raw, cfg)
+	email, err := mailpkg.ReadMessage(bytes.NewReader(content))
 	if err != nil {
 		return nil, fmt.Errorf("read message: %w", err)
 	}
 	hdr := email.Header
 
 	subj := decodeHeader(hdr.Get("Subject"))
-	fromRaw := hdr.Get("From")
-	from := fromRaw
-	if addr, err2 := mailpkg.ParseAddress(fromRaw); err2 == nil {
-		name := addr.Name
-		if name != "" {
-			name = decodeHeader(name)
-		}
-		if name != "" {
-			// 如果显示名与地址相同（大小写忽略），避免冗余格式
-			if strings.EqualFold(name, addr.Address) {
-				from = addr.Address
-			} else {
-				from = fmt.Sprintf("%s <%s>", name, addr.Address)
-			}
-		} else {
-			from = addr.Address
-		}
+	fromAddr := parseAddress(hdr.Get("From"))
+	from := hdr.Get("From")
+	if fromAddr != nil {
+		from = fromAddr.String()
 	}
 	date := hdr.Get("Date")
+	if sec != nil {
+		sec.matchFrom(fromAddr)
+	}
 
-	body, rawHTML, err := extractBody(email, cfg)
-	if err != nil {
-		log.Printf("extract body error: %v", err)
+	parts := walkParts(content)
+	body, rawHTML, fromHTML, cs := extractBody(parts, cfg)
+	msg := &Message{Subject: subj, From: from, Date: date, Body: body, BodyCharset: cs.Name, CharsetDetected: cs.Detected}
+	msg.FromAddress = fromAddr
+	msg.To = parseAddressList(hdr.Get("To"))
+	msg.Cc = parseAddressList(hdr.Get("Cc"))
+	msg.ReplyTo = parseAddressList(hdr.Get("Reply-To"))
+	msg.Sender = parseAddress(hdr.Get("Sender"))
+	msg.MessageID = firstMsgID(hdr.Get("Message-Id"))
+	msg.InReplyTo = firstMsgID(hdr.Get("In-Reply-To"))
+	msg.References = parseMsgIDs(hdr.Get("References"))
+	msg.ListID = parseListID(hdr.Get("List-Id"))
+	msg.ReturnPath = parseReturnPath(hdr.Get("Return-Path"))
+	msg.Headers = selectHeaders(hdr, splitHeaderList(cfg.IncludeHeaders))
+	applyThread(msg)
+	if im != nil {
+		msg.InternalDate = im.InternalDate
+		msg.Size = im.Size
+	}
+	msg.Calendar = buildCalendar(parts)
+	msg.Bounce = buildBounce(parts, hdr, body)
+	msg.AutoMail = detectAutoMail(hdr, subj, cfg.LoopHeader)
+	msg.Auth = buildAuth(raw, hdr, splitHeaderList(cfg.AuthServID), cfg.VerifyDKIM)
+	msg.Security = sec
+	msg.Unsubscribe = parseUnsubscribe(hdr.Get("List-Unsubscribe"), hdr.Get("List-Unsubscribe-Post"))
+	msg.Category = classify(hdr, msg, rawHTML, body)
+	if cfg.ExtractLinks || cfg.RiskAnalysis { // risk 分析需要锚文本，payload 中的 links 仍由 extract_links 控制
+		msg.Links = extractLinks(rawHTML, body, cfg.UnwrapLinks)
 	}
-	msg := &Message{Subject: subj, From: from, Date: date, Body: body}
-	// 附件检测（基于 imap.Message BodyStructure）
-	if im != nil && im.BodyStructure != nil {
-		var ordered []string
+	msg.Extracted = buildExtracted(cfg.Extractors, msg, rawHTML)
+	msg.StructuredData = buildStructuredData(rawHTML)
+	msg.Forwarded = buildForwarded(parts, body, rawHTML, fromHTML, msg.IsForward, cfg)
+	// 附件检测（基于原始 MIME 树，part 编号与 IMAP BODY[<part>] 一致）
+	msg.Attachments = buildAttachments(parts, cfg.SkipInlineImages, cfg.AttachmentSHA256)
+	inspectArchives(msg.Attachments, cfg)
+	if len(msg.Attachments) > 0 {
 		seen := make(map[string]struct{})
-		var walk func(bs *imap.BodyStructure)
-		walk = func(bs *imap.BodyStructure) {
-			if bs == nil {
-				return
+		for _, a := range msg.Attachments {
+			if _, ok := seen[a.Filename]; ok {
+				continue
 			}
-			if len(bs.Parts) > 0 { // multipart 递归
-				for _, p := range bs.Parts {
-					walk(p)
-				}
-				return
-			}
-			// 叶子 part，判断是否附件
-			disp := strings.ToLower(bs.Disposition)
-			if disp == "attachment" || disp == "inline" {
-				// 跳过内联图片（若配置启用）
-				if cfg.SkipInlineImages && disp == "inline" && strings.EqualFold(bs.MIMEType, "image") {
-					return
-				}
-				filename := firstNonEmpty(bs.Params["name"], bs.Params["filename"], bs.DispositionParams["filename"], bs.DispositionParams["name"])
-				if filename == "" {
-					return
-				}
-				decodedName := decodeHeader(filename)
-				candidate := strings.TrimSpace(decodedName)
-				if candidate == "" {
-					candidate = filename
-				}
-				if _, ok := seen[candidate]; ok {
-					return
-				}
-				seen[candidate] = struct{}{}
-				ordered = append(ordered, candidate)
-			}
-		}
-		walk(im.BodyStructure)
-		if len(ordered) > 0 {
-			msg.HasAttachments = true
-			msg.AttachmentNames = ordered
+			seen[a.Filename] = struct{}{}
+			msg.AttachmentNames = append(msg.AttachmentNames, a.Filename)
 		}
+		msg.HasAttachments = true
 	}
 	if cfg.IncludeRawHTML {
 		msg.RawHTML = rawHTML
 	}
+	if cfg.StripQuotes {
+		msg.BodyNew = limitText(extractNewContent(body, rawHTML, fromHTML, bodyTextMode(cfg.HTMLToTextMode)))
+	}
+	if cfg.HTMLToTextMode == "markdown" && rawHTML != "" {
+		msg.BodyMarkdown = limitText(htmlToText(removeStyleTags(rawHTML), "markdown"))
+	}
 	if cfg.EnableBlocks && rawHTML != "" {
 		msg.Blocks = buildBlocksFromHTML(rawHTML, body)
 	}
@@ -179,110 +231,49 @@ func decodeHeader(v string) string {
 	return res
 }
 
-// extractBody 返回 (纯文本, 原始HTML)
-func extractBody(m *mailpkg.Message, cfg *config.Config) (string, string, error) {
-	mediaType, params, err := mime.ParseMediaType(m.Header.Get("Content-Type"))
-	if err != nil {
-		// fallback treat as plain
-		b, _ := io.ReadAll(m.Body)
-		decoded := decodeTransferIfNeeded(b, m.Header.Get("Content-Transfer-Encoding"))
-		return limitText(string(decoded)), "", nil
-	}
-	if strings.HasPrefix(mediaType, "multipart/") {
-		mr := textproto.NewMultipartReader(m.Body, params["boundary"])
-		var plain, html string
-		for {
-			p, err := mr.NextPart()
-			if err == io.EOF {
-				break
-			}
-			if err != nil {
-				return "", "", err
-			}
-			ct := p.Header.Get("Content-Type")
-			cte := p.Header.Get("Content-Transfer-Encoding")
-			if strings.HasPrefix(ct, "text/plain") && plain == "" {
-				b, _ := io.ReadAll(p)
-				b = decodeTransferIfNeeded(b, cte)
-				plain = string(b)
-			}
-			if strings.HasPrefix(ct, "text/html") && html == "" {
-				b, _ := io.ReadAll(p)
-				b = decodeTransferIfNeeded(b, cte)
-				original := string(b)
-				cleaned := removeStyleTags(original)
-				html = htmlToText(cleaned, cfg.HTMLToTextMode)
-				// 保留原始 HTML 以便后续 blocks 构建
-				if cfg.IncludeRawHTML || cfg.EnableBlocks {
-					// original HTML 留给上层 parseRaw 设置 RawHTML (通过返回第二个值)
-				}
-			}
-			if plain != "" && html != "" {
-				break
-			}
-		}
-		if plain != "" {
-			return limitText(plain), html, nil
-		}
-		if html != "" {
-			return limitText(html), html, nil
-		}
-		return "", html, nil
-	}
-	b, _ := io.ReadAll(m.Body)
-	cte := m.Header.Get("Content-Transfer-Encoding")
-	b = decodeTransferIfNeeded(b, cte)
-	if strings.HasPrefix(mediaType, "text/html") {
-		h := string(b)
-		clean := removeStyleTags(h)
-		return limitText(htmlToText(clean, cfg.HTMLToTextMode)), h, nil
+// bodyTextMode markdown 模式下 body 仍为纯文本（保留换行），markdown 另存于 BodyMarkdown
+func bodyTextMode(mode string) string {
+	if mode == "markdown" {
+		return "preserve-line"
 	}
-	return limitText(string(b)), "", nil
+	return mode
 }
 
-func htmlToText(s, mode string) string {
-	if mode == "none" {
-		return s
-	}
-	// very naive stripping
-	replacer := strings.NewReplacer("<br>", "\n", "<br/>", "\n", "<p>", "\n", "</p>", "\n")
-	s = replacer.Replace(s)
-	// remove tags
-	var buf strings.Builder
-	inTag := false
-	for i := 0; i < len(s); i++ {
-		c := s[i]
-		if c == '<' {
-			inTag = true
+// extractBody 从叶子 part 中选取正文，返回 (纯文本, 原始HTML, 正文是否由 HTML 转换, 正文字符集)。
+// 优先 text/plain；仅有 HTML 时转换为文本。嵌套 multipart（mixed > alternative）同样适用。
+func extractBody(parts []mimePart, cfg *config.Config) (string, string, bool, textCharset) {
+	var plain, html, rawHTML string
+	var plainCS, htmlCS textCharset
+	for i := range parts {
+		p := &parts[i]
+		if p.isAttachment() {
 			continue
 		}
-		if c == '>' {
-			inTag = false
-			continue
+		switch {
+		case p.MediaType == "text/plain" && plain == "":
+			plain, plainCS = decodeCharset(p.Body, p.Params["charset"])
+		case p.MediaType == "text/html" && html == "":
+			rawHTML, htmlCS = decodeCharset(p.Body, p.Params["charset"])
+			html = htmlToText(removeStyleTags(rawHTML), bodyTextMode(cfg.HTMLToTextMode))
 		}
-		if !inTag {
-			buf.WriteByte(c)
+		if plain != "" && html != "" {
+			break
 		}
 	}
-	text := buf.String()
-	// decode common entities minimal
-	text = strings.ReplaceAll(text, "&nbsp;", " ")
-	text = strings.ReplaceAll(text, "&amp;", "&")
-	text = strings.ReplaceAll(text, "&lt;", "<")
-	text = strings.ReplaceAll(text, "&gt;", ">")
-	lines := strings.Split(text, "\n")
-	for i, l := range lines {
-		lines[i] = strings.TrimSpace(l)
+	if plain != "" {
+		return limitText(plain), rawHTML, false, plainCS
 	}
-	text = strings.Join(lines, func() string {
-		if mode == "preserve-line" {
-			return "\n"
+	if html != "" {
+		return limitText(html), rawHTML, true, htmlCS
+	}
+	// 单 part 且类型未知（如缺失/畸形 Content-Type）：按纯文本处理
+	if len(parts) == 1 && !parts[0].isAttachment() && !strings.HasPrefix(parts[0].MediaType, "multipart/") {
+		if strings.HasPrefix(parts[0].MediaType, "text/") || parts[0].MediaType == "application/octet-stream" {
+			text, cs := decodeCharset(parts[0].Body, parts[0].Params["charset"])
+			return limitText(text), "", false, cs
 		}
-		return " "
-	}())
-	// collapse spaces
-	text = regexp.MustCompile(`\s+`).ReplaceAllString(text, " ")
-	return strings.TrimSpace(text)
+	}
+	return "", rawHTML, rawHTML != "", htmlCS
 }
 
 func limitText(s string) string {
@@ -324,154 +315,3 @@ func removeStyleTags(html string) string {
 	res = msoCondRe.ReplaceAllString(res, "")
 	return res
 }
-
-// buildBlocksFromHTML 生成一个非常轻量级的 blocks AST；不依赖外部 HTML 解析库，
-// 仅通过正则/分割识别常见结构。为了控制复杂度，这里采用启发式：
-// - <h1..h6> -> {type: "heading", level: n, text}
-// - <p> 或被两次换行分隔的文本 -> {type: "paragraph", text}
-// - <ul><li> / <ol><li> -> {type: "list", ordered: bool, items: []}
-// - <blockquote> -> {type: "blockquote", text}
-// - <pre><code> 或 <code> 块 -> {type: "code", text}
-// 其余忽略。退化情况下 fallback 使用纯文本按空行分段。
-func buildBlocksFromHTML(html, plain string) []map[string]any {
-	if html == "" {
-		return buildParagraphBlocksFromPlain(plain)
-	}
-	// 预处理：统一小写标签（不处理内容大小写），简化匹配
-	l := strings.ToLower(html)
-	blocks := []map[string]any{}
-
-	// 提取并移除 code 块
-	codeRe := regexp.MustCompile(`(?s)<pre[^>]*><code[^>]*>(.*?)</code></pre>`)
-	for {
-		m := codeRe.FindStringSubmatch(l)
-		if m == nil {
-			break
-		}
-		text := htmlStripTags(m[1])
-		blocks = append(blocks, map[string]any{"type": "code", "text": strings.TrimSpace(text)})
-		l = strings.Replace(l, m[0], "\n", 1)
-	}
-
-	// 头部
-	headingRe := regexp.MustCompile(`(?s)<h([1-6])[^>]*>(.*?)</h[1-6]>`)
-	foundHeadings := headingRe.FindAllStringSubmatch(l, -1)
-	for _, h := range foundHeadings {
-		lvl := h[1]
-		text := htmlStripTags(h[2])
-		blocks = append(blocks, map[string]any{"type": "heading", "level": lvl, "text": strings.TrimSpace(text)})
-		l = strings.Replace(l, h[0], "\n", 1)
-	}
-
-	// 列表 (unordered)
-	ulRe := regexp.MustCompile(`(?s)<ul[^>]*>(.*?)</ul>`)
-	for {
-		m := ulRe.FindStringSubmatch(l)
-		if m == nil {
-			break
-		}
-		items := extractListItems(m[1])
-		if len(items) > 0 {
-			blocks = append(blocks, map[string]any{"type": "list", "ordered": false, "items": items})
-		}
-		l = strings.Replace(l, m[0], "\n", 1)
-	}
-	// 列表 (ordered)
-	olRe := regexp.MustCompile(`(?s)<ol[^>]*>(.*?)</ol>`)
-	for {
-		m := olRe.FindStringSubmatch(l)
-		if m == nil {
-			break
-		}
-		items := extractListItems(m[1])
-		if len(items) > 0 {
-			blocks = append(blocks, map[string]any{"type": "list", "ordered": true, "items": items})
-		}
-		l = strings.Replace(l, m[0], "\n", 1)
-	}
-
-	// 引用
-	quoteRe := regexp.MustCompile(`(?s)<blockquote[^>]*>(.*?)</blockquote>`)
-	foundQuotes := quoteRe.FindAllStringSubmatch(l, -1)
-	for _, q := range foundQuotes {
-		text := htmlStripTags(q[1])
-		blocks = append(blocks, map[string]any{"type": "blockquote", "text": strings.TrimSpace(text)})
-		l = strings.Replace(l, q[0], "\n", 1)
-	}
-
-	// 剩余分段（<p> 或者按空行）
-	pRe := regexp.MustCompile(`(?s)<p[^>]*>(.*?)</p>`)
-	foundP := pRe.FindAllStringSubmatch(l, -1)
-	if len(foundP) > 0 {
-		for _, p := range foundP {
-			text := strings.TrimSpace(htmlStripTags(p[1]))
-			if text != "" {
-				blocks = append(blocks, map[string]any{"type": "paragraph", "text": text})
-			}
-		}
-	} else {
-		// fallback: 用 plain 文本按空行段落拆分
-		blocks = append(blocks, buildParagraphBlocksFromPlain(plain)...)
-	}
-
-	return blocks
-}
-
-func extractListItems(section string) []string {
-	liRe := regexp.MustCompile(`(?s)<li[^>]*>(.*?)</li>`)
-	matches := liRe.FindAllStringSubmatch(section, -1)
-	var items []string
-	for _, m := range matches {
-		text := strings.TrimSpace(htmlStripTags(m[1]))
-		if text != "" {
-			items = append(items, text)
-		}
-	}
-	return items
-}
-
-func htmlStripTags(s string) string {
-	var b strings.Builder
-	inTag := false
-	for i := 0; i < len(s); i++ {
-		c := s[i]
-		if c == '<' {
-			inTag = true
-			continue
-		}
-		if c == '>' {
-			inTag = false
-			continue
-		}
-		if !inTag {
-			b.WriteByte(c)
-		}
-	}
-	return b.String()
-}
-
-func buildParagraphBlocksFromPlain(plain string) []map[string]any {
-	if plain == "" {
-		return nil
-	}
-	parts := regexp.MustCompile(`\n{2,}`).Split(plain, -1)
-	var blocks []map[string]any
-	for _, p := range parts {
-		pt := strings.TrimSpace(p)
-		if pt == "" {
-			continue
-		}
-		blocks = append(blocks, map[string]any{"type": "paragraph", "text": pt})
-	}
-	return blocks
-}
-
-// firstNonEmpty 返回首个非空字符串
-func firstNonEmpty(vals ...string) string {
-	for _, v := range vals {
-		if strings.TrimSpace(v) != "" {
-			return v
-		}
-	}
-	return ""
-}
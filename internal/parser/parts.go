@@ -0,0 +1,225 @@
+package parser
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/emersion/go-message/textproto"
+)
+
+// maxPartDepth 限制 multipart 嵌套深度，防御畸形邮件
+const maxPartDepth = 20
+
+// mimePart 原始 MIME 树中的叶子 part（multipart 容器本身不出现）
+type mimePart struct {
+	Path        string            // IMAP part 编号，如 "1"、"2.1"
+	MediaType   string            // 小写 type/subtype
+	Params      map[string]string // Content-Type 参数（键小写，保留 RFC 2231 的 * 键）
+	Disposition string            // 小写 attachment / inline / ""
+	DispParams  map[string]string // Content-Disposition 参数
+	ContentID   string            // 去掉尖括号的 Content-ID
+	Header      textproto.Header
+	Body        []byte // 已做 transfer 解码的内容
+	Container   string // 从容器中解出时为容器类型（tnef），Path 为容器 part 的编号
+}
+
+// Attachment 描述一个附件 part 的元数据；Data 不参与 JSON 序列化。
+type Attachment struct {
+	Filename    string       `json:"filename"`
+	ContentType string       `json:"content_type"`
+	Size        int          `json:"size"` // 解码后的字节数
+	Disposition string       `json:"disposition,omitempty"`
+	ContentID   string       `json:"content_id,omitempty"`
+	PartPath    string       `json:"part"` // IMAP part 编号，可直接用于 BODY[<part>] 抓取
+	Charset     string       `json:"charset,omitempty"`
+	SHA256      string       `json:"sha256,omitempty"`    // 解码内容的 SHA-256（需启用 attachment_sha256）
+	Container   string       `json:"container,omitempty"` // 从 winmail.dat 中解出时为 tnef，part 为 winmail.dat 的编号
+	Archive     *ArchiveInfo `json:"archive,omitempty"`   // 压缩包内容清单（需启用 inspect_archives）
+	Data        []byte       `json:"-"`
+}
+
+// walkParts 解析原始邮件并按文档顺序返回所有叶子 part（winmail.dat 展开为其中的正文与附件）。
+// 不依赖服务器 BodyStructure，part 编号规则与 IMAP 一致（单 part 邮件为 "1"）。
+func walkParts(raw []byte) []mimePart {
+	br := bufio.NewReader(bytes.NewReader(raw))
+	h, err := textproto.ReadHeader(br)
+	if err != nil {
+		return nil
+	}
+	var parts []mimePart
+	collectParts(h, br, "", 0, &parts)
+	return expandTNEF(parts)
+}
+
+func collectParts(h textproto.Header, body io.Reader, path string, depth int, out *[]mimePart) {
+	mediaType, params := parseHeaderParams(h.Get("Content-Type"))
+	if mediaType == "" {
+		mediaType = "text/plain"
+	}
+	if strings.HasPrefix(mediaType, "multipart/") && depth < maxPartDepth && params["boundary"] != "" {
+		mr := textproto.NewMultipartReader(body, params["boundary"])
+		for i := 1; ; i++ {
+			p, err := mr.NextPart()
+			if err != nil { // io.EOF 或畸形边界：保留已解析的部分
+				return
+			}
+			collectParts(p.Header, p, joinPartPath(path, i), depth+1, out)
+		}
+	}
+	if path == "" {
+		path = "1"
+	}
+	b, _ := io.ReadAll(body)
+	disp, dispParams := parseHeaderParams(h.Get("Content-Disposition"))
+	*out = append(*out, mimePart{
+		Path:        path,
+		MediaType:   mediaType,
+		Params:      params,
+		Disposition: disp,
+		DispParams:  dispParams,
+		ContentID:   strings.Trim(strings.TrimSpace(h.Get("Content-ID")), "<>"),
+		Header:      h,
+		Body:        decodeTransferIfNeeded(b, h.Get("Content-Transfer-Encoding")),
+	})
+}
+
+func joinPartPath(parent string, n int) string {
+	if parent == "" {
+		return strconv.Itoa(n)
+	}
+	return parent + "." + strconv.Itoa(n)
+}
+
+// Filename 返回 part 的解码后文件名（可能为空）
+func (p *mimePart) Filename() string {
+	return attachmentFilename(p.Params, p.DispParams)
+}
+
+// isAttachment 判定 part 是否作为附件呈现：
+//   - disposition=attachment；
+//   - disposition=inline 且带文件名（内联图片等）；
+//   - 未声明 disposition、带文件名且不是正文类型（部分客户端只写 name 参数）。
+func (p *mimePart) isAttachment() bool {
+	switch p.Disposition {
+	case "attachment":
+		return true
+	case "inline":
+		return p.Filename() != ""
+	case "":
+		if p.MediaType == "text/plain" || p.MediaType == "text/html" {
+			return false
+		}
+		return p.Filename() != ""
+	}
+	return false
+}
+
+// buildAttachments 从叶子 part 中筛选附件并生成元数据
+func buildAttachments(parts []mimePart, skipInlineImages, withHash bool) []Attachment {
+	var atts []Attachment
+	for i := range parts {
+		p := &parts[i]
+		if !p.isAttachment() {
+			continue
+		}
+		// 跳过内联图片（若配置启用）
+		if skipInlineImages && p.Disposition == "inline" && strings.HasPrefix(p.MediaType, "image/") {
+			continue
+		}
+		name := p.Filename()
+		if name == "" {
+			name = "part-" + p.Path
+		}
+		att := Attachment{
+			Filename:    name,
+			ContentType: p.MediaType,
+			Size:        len(p.Body),
+			Disposition: p.Disposition,
+			ContentID:   p.ContentID,
+			PartPath:    p.Path,
+			Charset:     normalizeCharset(p.Params["charset"]),
+			Container:   p.Container,
+			Data:        p.Body,
+		}
+		if withHash {
+			sum := sha256.Sum256(p.Body)
+			att.SHA256 = hex.EncodeToString(sum[:])
+		}
+		atts = append(atts, att)
+	}
+	return atts
+}
+
+// parseHeaderParams 宽松解析 "value; k=v; k2="v 2"" 形式的头部。
+// 与 mime.ParseMediaType 不同：不拒绝重复/畸形参数，不丢弃非 UTF-8 的 RFC 2231 值，
+// 键统一小写、值去引号，RFC 2231 的 key* / key*0* 原样保留交给 decodeParam 处理。
+func parseHeaderParams(v string) (string, map[string]string) {
+	params := make(map[string]string)
+	fields := splitParams(v, ';')
+	if len(fields) == 0 {
+		return "", params
+	}
+	value := strings.ToLower(strings.TrimSpace(fields[0]))
+	for _, f := range fields[1:] {
+		k, val, ok := strings.Cut(f, "=")
+		if !ok {
+			continue
+		}
+		k = strings.ToLower(strings.TrimSpace(k))
+		if k == "" {
+			continue
+		}
+		if _, dup := params[k]; dup { // 重复参数以首次出现为准
+			continue
+		}
+		params[k] = unquoteParam(strings.TrimSpace(val))
+	}
+	return value, params
+}
+
+// splitParams 按分隔符（MIME 参数为分号）切分，忽略引号内的分隔符
+func splitParams(v string, sep byte) []string {
+	var fields []string
+	var cur strings.Builder
+	inQuote, escaped := false, false
+	for i := 0; i < len(v); i++ {
+		c := v[i]
+		switch {
+		case escaped:
+			escaped = false
+		case c == '\\' && inQuote:
+			escaped = true
+		case c == '"':
+			inQuote = !inQuote
+		case c == sep && !inQuote:
+			fields = append(fields, cur.String())
+			cur.Reset()
+			continue
+		}
+		cur.WriteByte(c)
+	}
+	if strings.TrimSpace(cur.String()) != "" || len(fields) > 0 {
+		fields = append(fields, cur.String())
+	}
+	return fields
+}
+
+func unquoteParam(v string) string {
+	if len(v) < 2 || v[0] != '"' {
+		return v
+	}
+	v = strings.TrimSuffix(v[1:], `"`)
+	var b strings.Builder
+	for i := 0; i < len(v); i++ {
+		if v[i] == '\\' && i+1 < len(v) {
+			i++
+		}
+		b.WriteByte(v[i])
+	}
+	return b.String()
+}
@@ -0,0 +1,93 @@
+package parser
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"monitor-imap-webhook/internal/config"
+)
+
+const nestedRaw = "Subject: invoice\r\n" +
+	"From: Billing <billing@example.com>\r\n" +
+	"MIME-Version: 1.0\r\n" +
+	"Content-Type: multipart/mixed; boundary=\"OUTER\"\r\n\r\n" +
+	"--OUTER\r\n" +
+	"Content-Type: multipart/alternative; boundary=\"INNER\"\r\n\r\n" +
+	"--INNER\r\n" +
+	"Content-Type: text/plain; charset=utf-8\r\n\r\n" +
+	"See attached invoice.\r\n" +
+	"--INNER\r\n" +
+	"Content-Type: text/html; charset=utf-8\r\n\r\n" +
+	"<p>See <b>attached</b> invoice.</p>\r\n" +
+	"--INNER--\r\n" +
+	"--OUTER\r\n" +
+	"Content-Type: application/pdf\r\n" +
+	"Content-Disposition: attachment; filename*=utf-8''%E5%8F%91%E7%A5%A8.pdf\r\n" +
+	"Content-Transfer-Encoding: base64\r\n\r\n" +
+	"JVBERi0xLjQK\r\n" +
+	"--OUTER\r\n" +
+	"Content-Type: image/png; name=\"logo.png\"\r\n" +
+	"Content-Disposition: inline; filename=\"logo.png\"\r\n" +
+	"Content-ID: <logo@example.com>\r\n" +
+	"Content-Transfer-Encoding: base64\r\n\r\n" +
+	"iVBORw0KGgo=\r\n" +
+	"--OUTER\r\n" +
+	"Content-Type: text/csv; charset=gbk; name=\"data.csv\"\r\n\r\n" +
+	"a,b\r\n" +
+	"--OUTER--\r\n"
+
+func TestAttachmentsDetail(t *testing.T) {
+	cfg := &config.Config{HTMLToTextMode: "simple", AttachmentSHA256: true}
+	msg, err := parseRaw([]byte(nestedRaw), nil, cfg)
+	if err != nil {
+		t.Fatalf("parseRaw: %v", err)
+	}
+	if strings.TrimSpace(msg.Body) != "See attached invoice." {
+		t.Errorf("nested alternative body not extracted: %q", msg.Body)
+	}
+	if len(msg.Attachments) != 3 {
+		t.Fatalf("expected 3 attachments, got %d: %+v", len(msg.Attachments), msg.Attachments)
+	}
+	pdf := msg.Attachments[0]
+	sum := sha256.Sum256([]byte("%PDF-1.4\n"))
+	if pdf.Filename != "发票.pdf" || pdf.ContentType != "application/pdf" || pdf.Size != 9 ||
+		pdf.Disposition != "attachment" || pdf.PartPath != "2" || pdf.SHA256 != hex.EncodeToString(sum[:]) {
+		t.Errorf("unexpected pdf metadata: %+v", pdf)
+	}
+	logo := msg.Attachments[1]
+	if logo.ContentID != "logo@example.com" || logo.Disposition != "inline" || logo.PartPath != "3" {
+		t.Errorf("unexpected inline image metadata: %+v", logo)
+	}
+	csv := msg.Attachments[2]
+	if csv.Filename != "data.csv" || csv.Disposition != "" || csv.Charset != "gbk" || csv.PartPath != "4" {
+		t.Errorf("unexpected csv metadata: %+v", csv)
+	}
+	if got := strings.Join(msg.AttachmentNames, ","); got != "发票.pdf,logo.png,data.csv" {
+		t.Errorf("attachment names = %s", got)
+	}
+
+	cfg.SkipInlineImages = true
+	cfg.AttachmentSHA256 = false
+	msg, _ = parseRaw([]byte(nestedRaw), nil, cfg)
+	if len(msg.Attachments) != 2 || msg.Attachments[0].SHA256 != "" {
+		t.Errorf("inline image should be skipped and hash disabled: %+v", msg.Attachments)
+	}
+}
+
+func TestWalkPartsPaths(t *testing.T) {
+	parts := walkParts([]byte(nestedRaw))
+	var paths []string
+	for _, p := range parts {
+		paths = append(paths, p.Path+"="+p.MediaType)
+	}
+	want := "1.1=text/plain 1.2=text/html 2=application/pdf 3=image/png 4=text/csv"
+	if got := strings.Join(paths, " "); got != want {
+		t.Errorf("paths = %s, want %s", got, want)
+	}
+	single := walkParts([]byte("Subject: x\r\n\r\nhello\r\n"))
+	if len(single) != 1 || single[0].Path != "1" || single[0].MediaType != "text/plain" {
+		t.Errorf("single part = %+v", single)
+	}
+}
@@ -0,0 +1,170 @@
+package parser
+
+import (
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// 引用头：出现后其后的内容均视为引用历史
+var quoteHeaderRes = []*regexp.Regexp{
+	regexp.MustCompile(`(?i)^on\s.{1,300}\swrote\s*:$`),                                                   // On Mon, 1 Jan 2024, Bob <b@x> wrote:
+	regexp.MustCompile(`(?i)^am\s.{1,300}\sschrieb.{0,200}:$`),                                            // Am ... schrieb ...:
+	regexp.MustCompile(`(?i)^le\s.{1,300}\sa\s[ée]crit\s*:$`),                                             // Le ... a écrit :
+	regexp.MustCompile(`^.{1,300}(写道|寫道)\s*[:：]$`),                                                        // 在 2024年1月1日，张三 写道：
+	regexp.MustCompile(`(?i)^[-_=\s]{2,}(original message|原始邮件|原始郵件|forwarded message|转发邮件)[-_=\s]{2,}$`), // -----Original Message-----
+}
+
+// outlookFromRe / outlookFieldRe Outlook 风格的头部块（From: / Sent: / To: / Subject:）
+var (
+	outlookFromRe  = regexp.MustCompile(`(?i)^\*?(from|发件人|寄件者|von|de)\s*\*?\s*[:：]`)
+	outlookFieldRe = regexp.MustCompile(`(?i)^\*?(sent|date|to|subject|发送时间|日期|收件人|主题|gesendet|envoyé)\s*\*?\s*[:：]`)
+)
+
+// signatureRe 签名分隔符与移动端自动签名
+var signatureRe = regexp.MustCompile(`(?i)^(--|sent from my .{1,60}|发自我的.{1,30}|get outlook for .{1,30}|获取 outlook for .{1,30})$`)
+
+// stripQuotedText 去掉纯文本正文中的引用历史与签名，只保留新写的内容：
+//   - 引用头（On ... wrote: / 在 ... 写道： / -----Original Message----- / Outlook 头部块）及其后的全部内容；
+//   - ">" 开头的引用行（穿插回复时保留未引用的行）；
+//   - 签名分隔符 "-- " 及移动端签名之后的内容。
+func stripQuotedText(text string) string {
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	var out []string
+lines:
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case isQuoteHeader(lines, i):
+			break lines
+		case line == "-- " || signatureRe.MatchString(trimmed):
+			break lines
+		case strings.HasPrefix(trimmed, ">"):
+			continue
+		}
+		out = append(out, line)
+	}
+	// 去掉引用头前残留的分隔线（Outlook 的 "____" 等）与空行
+	for len(out) > 0 {
+		last := strings.TrimSpace(out[len(out)-1])
+		if last != "" && strings.Trim(last, "-_=*") != "" {
+			break
+		}
+		out = out[:len(out)-1]
+	}
+	return strings.TrimSpace(strings.Join(out, "\n"))
+}
+
+// isQuoteHeader 判断第 i 行是否为引用头；客户端折行的 "On ... \n wrote:" 合并两行判断
+func isQuoteHeader(lines []string, i int) bool {
+	line := strings.TrimSpace(lines[i])
+	if line == "" {
+		return false
+	}
+	candidates := []string{line}
+	if i+1 < len(lines) {
+		candidates = append(candidates, line+" "+strings.TrimSpace(lines[i+1]))
+	}
+	for _, c := range candidates {
+		for _, re := range quoteHeaderRes {
+			if re.MatchString(c) {
+				return true
+			}
+		}
+	}
+	if outlookFromRe.MatchString(line) {
+		fields := 0
+		for j := i + 1; j < len(lines) && j <= i+4; j++ {
+			if outlookFieldRe.MatchString(strings.TrimSpace(lines[j])) {
+				fields++
+			}
+		}
+		return fields >= 2
+	}
+	return false
+}
+
+// stripQuotedHTML 从 DOM 中删除常见邮件客户端的引用/签名容器：
+//   - Gmail: .gmail_quote / .gmail_signature；Apple Mail: blockquote[type=cite]；
+//   - Thunderbird: .moz-cite-prefix；Yahoo: .yahoo_quoted；
+//   - Outlook: #divRplyFwdMsg / #appendonsend 及其后的兄弟节点，#Signature。
+func stripQuotedHTML(doc *html.Node) {
+	var visit func(n *html.Node)
+	visit = func(n *html.Node) {
+		for c := n.FirstChild; c != nil; {
+			next := c.NextSibling
+			if c.Type == html.ElementNode {
+				switch quoteContainerKind(c) {
+				case quoteRemove:
+					n.RemoveChild(c)
+					c = next
+					continue
+				case quoteRemoveRest:
+					for r := c; r != nil; {
+						rn := r.NextSibling
+						n.RemoveChild(r)
+						r = rn
+					}
+					return
+				}
+				visit(c)
+			}
+			c = next
+		}
+	}
+	visit(doc)
+}
+
+const (
+	quoteKeep = iota
+	quoteRemove
+	quoteRemoveRest
+)
+
+func quoteContainerKind(n *html.Node) int {
+	id := attr(n, "id")
+	switch id {
+	case "divRplyFwdMsg", "appendonsend":
+		return quoteRemoveRest
+	case "Signature":
+		return quoteRemove
+	}
+	if n.DataAtom == atom.Blockquote && strings.EqualFold(attr(n, "type"), "cite") {
+		return quoteRemove
+	}
+	for _, cls := range strings.Fields(attr(n, "class")) {
+		switch cls {
+		case "gmail_quote", "gmail_signature", "moz-cite-prefix", "yahoo_quoted", "moz-signature":
+			return quoteRemove
+		}
+	}
+	return quoteKeep
+}
+
+// extractNewContent 计算 body_new：正文来自 HTML 时先删除引用容器再转文本，之后统一做纯文本剥离
+// （html2text=none 时输出删除引用容器后的 HTML）。
+func extractNewContent(body, rawHTML string, fromHTML bool, mode string) string {
+	if !fromHTML || rawHTML == "" {
+		return stripQuotedText(body)
+	}
+	doc, err := html.Parse(strings.NewReader(removeStyleTags(rawHTML)))
+	if err != nil {
+		return stripQuotedText(body)
+	}
+	stripQuotedHTML(doc)
+	if mode == "none" {
+		var b strings.Builder
+		if err := html.Render(&b, doc); err != nil {
+			return body
+		}
+		return b.String()
+	}
+	text := stripQuotedText(nodeToText(doc, "preserve-line"))
+	if mode == "simple" {
+		return strings.Join(strings.Fields(text), " ")
+	}
+	return text
+}
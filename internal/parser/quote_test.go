@@ -0,0 +1,45 @@
+package parser
+
+import (
+	"testing"
+
+	"monitor-imap-webhook/internal/config"
+)
+
+func TestStripQuotedText(t *testing.T) {
+	cases := []struct {
+		name, in, want string
+	}{
+		{"gmail", "Sounds good.\n\nOn Mon, Jan 1, 2024 at 10:00 AM Bob <bob@example.com>\nwrote:\n> Shall we meet?\n> Bob", "Sounds good."},
+		{"outlook", "See attached.\n\n________________________________\nFrom: Alice <a@example.com>\nSent: Monday, January 1, 2024 10:00\nTo: Bob\nSubject: Report\n\nOld text", "See attached."},
+		{"original", "好的\n\n-----Original Message-----\nFrom: x", "好的"},
+		{"qq", "收到\n\n------------------ 原始邮件 ------------------\n发件人: \"张三\"", "收到"},
+		{"chinese", "明天见\n\n在 2024年1月1日 10:00，张三 <z@example.com> 写道：\n> 明天开会吗", "明天见"},
+		{"interleaved", "> question one?\nanswer one\n> question two?\nanswer two", "answer one\nanswer two"},
+		{"signature", "Thanks!\n-- \nBob Smith\nACME Corp", "Thanks!"},
+		{"mobile", "OK\n\nSent from my iPhone", "OK"},
+		{"plain", "No quotes here.\nSecond line.", "No quotes here.\nSecond line."},
+	}
+	for _, c := range cases {
+		if got := stripQuotedText(c.in); got != c.want {
+			t.Errorf("%s: got %q want %q", c.name, got, c.want)
+		}
+	}
+}
+
+func TestStripQuotedHTML(t *testing.T) {
+	raw := "Subject: Re: hi\r\nContent-Type: text/html; charset=utf-8\r\n\r\n" +
+		`<div dir="ltr">New <b>reply</b><div class="gmail_signature">Bob | ACME</div></div>` +
+		`<div class="gmail_quote"><div class="gmail_attr">On Mon, Bob wrote:</div><blockquote class="gmail_quote">old text</blockquote></div>` + "\r\n"
+	cfg := &config.Config{HTMLToTextMode: "simple", StripQuotes: true}
+	msg, err := parseRaw([]byte(raw), nil, cfg)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if msg.BodyNew != "New reply" {
+		t.Fatalf("body_new=%q", msg.BodyNew)
+	}
+	if msg.Body == msg.BodyNew {
+		t.Fatalf("full body should keep quoted history: %q", msg.Body)
+	}
+}
@@ -0,0 +1,275 @@
+package parser
+
+import (
+	"encoding/binary"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// rtfPrebuf 压缩 RTF（MS-OXRTFCP）字典的初始内容
+const rtfPrebuf = `{\rtf1\ansi\mac\deff0\deftab720{\fonttbl;}{\f0\fnil \froman \fswiss \fmodern \fscript \fdecor MS Sans SerifSymbolArialTimes New RomanCourier{\colortbl\red0\green0\blue0` + "\r\n" + `\par \pard\plain\f0\fs20\b\i\u\tab\tx`
+
+const (
+	rtfCompressed   = 0x75465a4c // "LZFu"
+	rtfUncompressed = 0x414c454d // "MELA"
+)
+
+// decompressRTF 解压 PR_RTF_COMPRESSED（不校验 CRC；数据被截断时返回已解出的部分）
+func decompressRTF(data []byte) ([]byte, error) {
+	if len(data) < 16 {
+		return nil, errors.New("compressed rtf: short header")
+	}
+	rawSize := int(binary.LittleEndian.Uint32(data[4:8]))
+	compType := binary.LittleEndian.Uint32(data[8:12])
+	src := data[16:]
+	if compType == rtfUncompressed {
+		if rawSize < len(src) {
+			src = src[:rawSize]
+		}
+		return src, nil
+	}
+	if compType != rtfCompressed {
+		return nil, errors.New("compressed rtf: unknown type")
+	}
+	var dict [4096]byte
+	copy(dict[:], rtfPrebuf)
+	write := len(rtfPrebuf)
+	out := make([]byte, 0, min(rawSize, 16<<20))
+	for i := 0; i < len(src); {
+		control := src[i]
+		i++
+		for bit := 0; bit < 8 && i < len(src); bit++ {
+			if control&(1<<bit) == 0 {
+				out = append(out, src[i])
+				dict[write] = src[i]
+				write = (write + 1) % len(dict)
+				i++
+				continue
+			}
+			if i+1 >= len(src) {
+				return out, nil
+			}
+			ref := int(src[i])<<8 | int(src[i+1])
+			i += 2
+			offset, length := ref>>4, ref&0xf+2
+			if offset == write { // 结束标记
+				return out, nil
+			}
+			for k := 0; k < length; k++ {
+				c := dict[(offset+k)%len(dict)]
+				out = append(out, c)
+				dict[write] = c
+				write = (write + 1) % len(dict)
+			}
+		}
+	}
+	return out, nil
+}
+
+// rtfSkipDestinations 不含正文的 RTF 目标组
+var rtfSkipDestinations = map[string]bool{
+	"fonttbl": true, "colortbl": true, "stylesheet": true, "info": true, "pict": true, "object": true,
+	"header": true, "headerl": true, "headerr": true, "headerf": true, "footer": true, "footerl": true,
+	"footerr": true, "footerf": true, "listtable": true, "listoverridetable": true, "rsidtbl": true,
+	"themedata": true, "colorschememapping": true, "latentstyles": true, "datastore": true,
+	"xmlnstbl": true, "filetbl": true, "revtbl": true, "generator": true, "fldinst": true,
+}
+
+// rtfSymbols 输出固定字符的控制字
+var rtfSymbols = map[string]string{
+	"par": "\n", "line": "\n", "sect": "\n", "page": "\n", "row": "\n", "tab": "\t", "cell": " ",
+	"lquote": "‘", "rquote": "’", "ldblquote": "“", "rdblquote": "”",
+	"bullet": "•", "emdash": "—", "endash": "–", "emspace": " ", "enspace": " ",
+}
+
+type rtfGroup struct {
+	skip    bool // 忽略的目标组
+	htmlrtf bool // \htmlrtf 区段：仅供 RTF 显示，去封装 HTML 时丢弃
+	htmltag bool // {\*\htmltag} 组：封装的原始 HTML
+	uc      int  // \ucN：\u 之后的替代字符数
+}
+
+// decodeRTF 提取 RTF 正文。带 \fromhtml1 的（Outlook 由 HTML 转换而来）按 MS-OXRTFEX 还原 HTML，
+// 否则输出纯文本。\'hh 字节按 \ansicpg 代码页解码。
+func decodeRTF(rtf []byte) (text string, isHTML bool) {
+	isHTML = strings.Contains(string(rtf[:min(len(rtf), 1024)]), `\fromhtml`)
+	var (
+		out      strings.Builder
+		pending  []byte // 待按代码页解码的字节
+		codepage = 1252
+		st       = rtfGroup{uc: 1}
+		stack    []rtfGroup
+		starred  bool // 刚读到 \*
+		fresh    bool // 组内尚未出现内容（用于识别目标组）
+		skipN    int  // \u 之后待跳过的替代字符
+	)
+	flush := func() {
+		if len(pending) == 0 {
+			return
+		}
+		if s, ok := decodeWith(codepageCharset(codepage), pending); ok {
+			out.WriteString(s)
+		} else {
+			out.Write(pending)
+		}
+		pending = pending[:0]
+	}
+	visible := func() bool {
+		if st.skip {
+			return false
+		}
+		return !isHTML || st.htmltag || !st.htmlrtf
+	}
+	emitByte := func(c byte) {
+		if skipN > 0 {
+			skipN--
+			return
+		}
+		if visible() {
+			pending = append(pending, c)
+		}
+	}
+	emitString := func(s string) {
+		if visible() {
+			flush()
+			out.WriteString(s)
+		}
+	}
+	for i := 0; i < len(rtf); i++ {
+		c := rtf[i]
+		switch c {
+		case '{':
+			stack = append(stack, st)
+			fresh, starred = true, false
+			continue
+		case '}':
+			if n := len(stack); n > 0 {
+				st, stack = stack[n-1], stack[:n-1]
+			}
+			fresh, starred, skipN = false, false, 0
+			continue
+		case '\r', '\n':
+			continue
+		case '\\':
+		default:
+			fresh = false
+			emitByte(c)
+			continue
+		}
+		if i+1 >= len(rtf) {
+			break
+		}
+		next := rtf[i+1]
+		if !isASCIILetter(next) {
+			i++
+			switch next {
+			case '\'':
+				if i+2 < len(rtf) {
+					if v, err := strconv.ParseUint(string(rtf[i+1:i+3]), 16, 8); err == nil {
+						emitByte(byte(v))
+					}
+					i += 2
+				}
+			case '*':
+				starred = true
+				continue
+			case '~':
+				emitString(" ")
+			case '_':
+				emitString("-")
+			case '\r', '\n':
+				emitString("\n")
+			case '\\', '{', '}':
+				emitByte(next)
+			}
+			fresh = false
+			continue
+		}
+		// 控制字：\word[-]N 可选一个空格分隔
+		j := i + 1
+		for j < len(rtf) && isASCIILetter(rtf[j]) {
+			j++
+		}
+		word := string(rtf[i+1 : j])
+		k := j
+		if k < len(rtf) && rtf[k] == '-' {
+			k++
+		}
+		for k < len(rtf) && rtf[k] >= '0' && rtf[k] <= '9' {
+			k++
+		}
+		param, hasParam := 0, k > j
+		if hasParam {
+			param, _ = strconv.Atoi(string(rtf[j:k]))
+		}
+		if k < len(rtf) && rtf[k] == ' ' {
+			k++
+		}
+		i = k - 1
+		if fresh {
+			switch {
+			case starred && isHTML && word == "htmltag":
+				st.htmltag = true
+			case starred || rtfSkipDestinations[word]:
+				st.skip = true
+			}
+		}
+		fresh, starred = false, false
+		switch word {
+		case "ansicpg":
+			codepage = param
+		case "htmlrtf":
+			st.htmlrtf = !hasParam || param != 0
+		case "uc":
+			st.uc = param
+		case "u":
+			if param < 0 {
+				param += 65536
+			}
+			emitString(string(rune(param)))
+			skipN = st.uc
+		case "bin":
+			i += max(param, 0)
+		default:
+			if s, ok := rtfSymbols[word]; ok {
+				emitString(s)
+			}
+		}
+	}
+	flush()
+	if isHTML {
+		return strings.TrimSpace(out.String()), true
+	}
+	return tidyLines(strings.TrimSpace(out.String())), false
+}
+
+func isASCIILetter(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// codepageCharset Windows 代码页到字符集名称
+func codepageCharset(cp int) string {
+	switch cp {
+	case 936:
+		return "gbk"
+	case 54936:
+		return "gb18030"
+	case 950:
+		return "big5"
+	case 932:
+		return "shift_jis"
+	case 949:
+		return "euc-kr"
+	case 65001:
+		return "utf-8"
+	case 20127:
+		return "us-ascii"
+	case 28591:
+		return "iso-8859-1"
+	}
+	if cp >= 1250 && cp <= 1258 {
+		return "windows-" + strconv.Itoa(cp)
+	}
+	return "windows-1252"
+}
@@ -0,0 +1,52 @@
+package parser
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+func TestDecompressRTF(t *testing.T) {
+	if len(rtfPrebuf) != 207 {
+		t.Fatalf("prebuf len=%d", len(rtfPrebuf))
+	}
+	// MS-OXRTFCP 3.1.1 示例
+	data, _ := hex.DecodeString("2d0000002b0000004c5a4675f1c5c7a703000a00726370673132354232" +
+		"0af32068656c090020627705b06c647d0a800fa0")
+	out, err := decompressRTF(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "{\\rtf1\\ansi\\ansicpg1252\\pard hello world}\r\n"; string(out) != want {
+		t.Fatalf("out=%q", out)
+	}
+
+	raw := []byte(`{\rtf1 plain}`)
+	mela := make([]byte, 16)
+	binary.LittleEndian.PutUint32(mela[0:], uint32(len(raw)+12))
+	binary.LittleEndian.PutUint32(mela[4:], uint32(len(raw)))
+	binary.LittleEndian.PutUint32(mela[8:], rtfUncompressed)
+	if out, err := decompressRTF(append(mela, raw...)); err != nil || string(out) != string(raw) {
+		t.Fatalf("uncompressed=%q err=%v", out, err)
+	}
+}
+
+func TestDecodeRTF(t *testing.T) {
+	plain := `{\rtf1\ansi\ansicpg936\deff0{\fonttbl{\f0\fswiss Arial;}}{\colortbl;\red0\green0\blue0;}` +
+		`{\*\generator Msftedit;}\pard Hello \b world\b0 !\par ` +
+		`\'c4\'e3\'ba\'c3\par\uc1\u20320?\u22909?\tab end\par}`
+	text, isHTML := decodeRTF([]byte(plain))
+	if isHTML || text != "Hello world!\n你好\n你好\tend" {
+		t.Fatalf("plain=%q html=%v", text, isHTML)
+	}
+
+	enc := `{\rtf1\ansi\ansicpg1252\fromhtml1 \deff0{\fonttbl{\f0\fswiss Arial;}}` +
+		`{\*\htmltag19 <html>}{\*\htmltag50 <body>}\htmlrtf {\f0 \htmlrtf0 ` +
+		`{\*\htmltag64 <p>}\htmlrtf {\htmlrtf0 Caf\'e9 \{ok\}` +
+		`\htmlrtf\par}\htmlrtf0{\*\htmltag72 </p>}{\*\htmltag58 </body>}{\*\htmltag27 </html>}\htmlrtf }\htmlrtf0 }`
+	text, isHTML = decodeRTF([]byte(enc))
+	if !isHTML || !strings.Contains(text, "<p>Café {ok}</p>") || !strings.HasPrefix(text, "<html><body>") {
+		t.Fatalf("html=%q", text)
+	}
+}
@@ -0,0 +1,497 @@
+package parser
+
+import (
+	"bufio"
+	"bytes"
+	"crypto"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	mailpkg "net/mail"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/emersion/go-message/textproto"
+	"go.mozilla.org/pkcs7"
+
+	"monitor-imap-webhook/internal/config"
+)
+
+// Security S/MIME / OpenPGP 签名与加密信息
+type Security struct {
+	Type           string   `json:"type"` // smime | pgp
+	Signed         bool     `json:"signed"`
+	Encrypted      bool     `json:"encrypted"`
+	Decrypted      bool     `json:"decrypted"`       // 已用配置的私钥解密，正文 / 附件来自解密后的内容
+	SignatureValid bool     `json:"signature_valid"` // 签名完整（内容未被篡改）
+	Trusted        bool     `json:"trusted"`         // 签名有效、签名者受信任且与 From 一致（from_match）
+	FromMatch      bool     `json:"from_match"`      // 签名者证书 / 公钥中的邮件地址包含 From 地址
+	Signers        []Signer `json:"signers,omitempty"`
+	Error          string   `json:"error,omitempty"` // 校验 / 解密失败原因
+}
+
+// Signer 签名者身份
+type Signer struct {
+	Name        string `json:"name,omitempty"`
+	Email       string `json:"email,omitempty"`
+	Issuer      string `json:"issuer,omitempty"`      // S/MIME 证书颁发者
+	Serial      string `json:"serial,omitempty"`      // S/MIME 证书序列号（十六进制）
+	KeyID       string `json:"key_id,omitempty"`      // PGP 签名密钥 ID
+	Fingerprint string `json:"fingerprint,omitempty"` // S/MIME 证书 SHA-256 / PGP 主密钥指纹
+	NotBefore   string `json:"not_before,omitempty"`
+	NotAfter    string `json:"not_after,omitempty"`
+	Trusted     bool   `json:"trusted"` // S/MIME 证书链到 smime_ca_file；PGP 公钥在配置的 keyring 中
+
+	emails []string // 证书 SAN / 主题中的全部邮件地址；PGP 全部 UID 中的地址
+}
+
+// maxSecurityLayers 签名 / 加密嵌套层数上限（常见为先签名后加密两层）
+const maxSecurityLayers = 3
+
+// securityKeys 由配置加载的信任库与私钥
+type securityKeys struct {
+	roots *x509.CertPool
+	cert  *x509.Certificate
+	key   crypto.PrivateKey
+	pgp   openpgp.EntityList // 公钥与（已解锁的）私钥
+}
+
+var (
+	keysMu    sync.Mutex
+	keysCache = make(map[string]*securityKeys)
+)
+
+// LoadSecurityKeys 预加载 S/MIME / PGP 密钥，启动时调用以便尽早暴露配置错误
+func LoadSecurityKeys(cfg *config.Config) error {
+	_, err := securityKeysFor(cfg)
+	return err
+}
+
+func securityKeysFor(cfg *config.Config) (*securityKeys, error) {
+	cacheKey := strings.Join([]string{cfg.SMIMECAFile, cfg.SMIMECertFile, cfg.SMIMEKeyFile, cfg.PGPKeyringFile, cfg.PGPPrivateKeyFile, cfg.PGPPassphrase}, "\x00")
+	keysMu.Lock()
+	defer keysMu.Unlock()
+	if k, ok := keysCache[cacheKey]; ok {
+		return k, nil
+	}
+	k := &securityKeys{}
+	if cfg.SMIMECAFile != "" {
+		pemData, err := os.ReadFile(cfg.SMIMECAFile)
+		if err != nil {
+			return nil, fmt.Errorf("read smime ca: %w", err)
+		}
+		k.roots = x509.NewCertPool()
+		if !k.roots.AppendCertsFromPEM(pemData) {
+			return nil, fmt.Errorf("smime ca %s: no certificates found", cfg.SMIMECAFile)
+		}
+	}
+	if cfg.SMIMECertFile != "" && cfg.SMIMEKeyFile != "" {
+		pair, err := tls.LoadX509KeyPair(cfg.SMIMECertFile, cfg.SMIMEKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load smime key pair: %w", err)
+		}
+		if k.cert, err = x509.ParseCertificate(pair.Certificate[0]); err != nil {
+			return nil, fmt.Errorf("parse smime cert: %w", err)
+		}
+		k.key = pair.PrivateKey
+	}
+	for _, path := range []string{cfg.PGPKeyringFile, cfg.PGPPrivateKeyFile} {
+		if path == "" {
+			continue
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("open pgp keyring: %w", err)
+		}
+		el, err := openpgp.ReadArmoredKeyRing(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("read pgp keyring %s: %w", path, err)
+		}
+		for _, e := range el {
+			if e.PrivateKey != nil && e.PrivateKey.Encrypted {
+				if err := e.DecryptPrivateKeys([]byte(cfg.PGPPassphrase)); err != nil {
+					return nil, fmt.Errorf("unlock pgp private key: %w", err)
+				}
+			}
+		}
+		k.pgp = append(k.pgp, el...)
+	}
+	keysCache[cacheKey] = k
+	return k, nil
+}
+
+// unwrapSecurity 识别 multipart/signed、multipart/encrypted 与 application/pkcs7-mime：
+// 校验签名并在配置私钥时解密，返回用于后续解析的邮件（解密 / 不透明签名时为外层头部 + 内层实体）。
+// 非签名 / 加密邮件返回原始内容与 nil。
+func unwrapSecurity(raw []byte, cfg *config.Config) ([]byte, *Security) {
+	var sec *Security
+	ensure := func(typ string) *Security {
+		if sec == nil {
+			sec = &Security{Type: typ}
+		}
+		return sec
+	}
+	for layer := 0; layer < maxSecurityLayers; layer++ {
+		h, body, err := splitEntity(raw)
+		if err != nil {
+			return raw, sec
+		}
+		mediaType, params := parseHeaderParams(h.Get("Content-Type"))
+		protocol := strings.ToLower(params["protocol"])
+		switch {
+		case mediaType == "multipart/signed":
+			s := ensure(signatureType(protocol))
+			s.Signed = true
+			signed, ok := signedContent(body, params["boundary"])
+			if !ok {
+				s.setError(errors.New("malformed multipart/signed"))
+				return raw, sec
+			}
+			// 签名为 multipart/signed 的第二个子 part；被签内容中（如转发的签名邮件）的 .p7s / .asc 不参与
+			sig := findPart(walkParts(raw), func(p *mimePart) bool { return p.Path == "2" && isSignaturePart(p) })
+			if sig == nil {
+				s.setError(errors.New("signature part not found"))
+				return raw, sec
+			}
+			keys, err := securityKeysFor(cfg)
+			if err != nil {
+				s.setError(err)
+				return raw, sec
+			}
+			if signatureType(protocol) == "pgp" {
+				s.verifyPGP(keys, signed, sig.Body)
+			} else {
+				s.verifySMIME(keys, signed, sig.Body)
+			}
+			return raw, sec
+		case mediaType == "multipart/encrypted" && protocol == "application/pgp-encrypted":
+			s := ensure("pgp")
+			s.Encrypted = true
+			enc := findPart(walkParts(raw), func(p *mimePart) bool {
+				return p.Path == "2" && bytes.Contains(p.Body, []byte("-----BEGIN PGP MESSAGE-----"))
+			})
+			if enc == nil {
+				s.setError(errors.New("pgp message part not found"))
+				return raw, sec
+			}
+			keys, err := securityKeysFor(cfg)
+			if err != nil {
+				s.setError(err)
+				return raw, sec
+			}
+			inner, err := s.decryptPGP(keys, enc.Body)
+			if err != nil {
+				s.setError(err)
+				return raw, sec
+			}
+			s.Decrypted = true
+			raw = replaceContent(h, inner)
+		case isPKCS7Mime(mediaType, params, h):
+			s := ensure("smime")
+			keys, err := securityKeysFor(cfg)
+			if err != nil {
+				s.setError(err)
+				return raw, sec
+			}
+			inner, err := s.openPKCS7(keys, decodeTransferIfNeeded(body, h.Get("Content-Transfer-Encoding")), strings.ToLower(params["smime-type"]))
+			if err != nil {
+				s.setError(err)
+				return raw, sec
+			}
+			raw = replaceContent(h, inner)
+		default:
+			return raw, sec
+		}
+	}
+	return raw, sec
+}
+
+// matchFrom 签名者的邮件地址须包含 From 地址（不区分大小写），否则不视为受信任：
+// 受信任同事的密钥不能为冒充他人的邮件背书
+func (s *Security) matchFrom(from *Address) {
+	if s.SignatureValid && from != nil {
+		for _, sg := range s.Signers {
+			if containsFold(sg.emails, from.Address) {
+				s.FromMatch = true
+				break
+			}
+		}
+	}
+	if !s.FromMatch {
+		s.Trusted = false
+	}
+}
+
+func (s *Security) setError(err error) {
+	if s.Error == "" {
+		s.Error = err.Error()
+	}
+}
+
+// verifySMIME 校验 multipart/signed 的 PKCS#7 分离签名
+func (s *Security) verifySMIME(keys *securityKeys, signed, sigDER []byte) {
+	p7, err := pkcs7.Parse(sigDER)
+	if err != nil {
+		s.setError(fmt.Errorf("parse pkcs7 signature: %w", err))
+		return
+	}
+	p7.Content = canonicalCRLF(signed)
+	s.checkPKCS7(keys, p7)
+}
+
+// checkPKCS7 校验签名完整性，并在配置 trust store 时校验证书链
+func (s *Security) checkPKCS7(keys *securityKeys, p7 *pkcs7.PKCS7) {
+	s.Signed = true
+	if err := p7.Verify(); err != nil {
+		s.setError(err)
+	} else {
+		s.SignatureValid = true
+	}
+	trusted := false
+	if s.SignatureValid && keys.roots != nil {
+		if err := p7.VerifyWithChain(keys.roots); err != nil {
+			s.setError(err)
+		} else {
+			trusted = true
+		}
+	}
+	for _, si := range p7.Signers {
+		for _, c := range p7.Certificates {
+			if c.SerialNumber.Cmp(si.IssuerAndSerialNumber.SerialNumber) == 0 && bytes.Equal(c.RawIssuer, si.IssuerAndSerialNumber.IssuerName.FullBytes) {
+				s.Signers = append(s.Signers, certSigner(c, trusted))
+				break
+			}
+		}
+	}
+	s.Trusted = trusted && len(s.Signers) > 0
+}
+
+// openPKCS7 处理 application/pkcs7-mime：enveloped-data 解密，signed-data（不透明签名）校验后取出内容
+func (s *Security) openPKCS7(keys *securityKeys, der []byte, smimeType string) ([]byte, error) {
+	p7, err := pkcs7.Parse(der)
+	if err != nil {
+		return nil, fmt.Errorf("parse pkcs7: %w", err)
+	}
+	if smimeType == "signed-data" || (smimeType == "" && len(p7.Signers) > 0) {
+		s.checkPKCS7(keys, p7)
+		return p7.Content, nil
+	}
+	s.Encrypted = true
+	if keys.cert == nil {
+		return nil, errors.New("no smime private key configured")
+	}
+	inner, err := p7.Decrypt(keys.cert, keys.key)
+	if err != nil {
+		return nil, fmt.Errorf("decrypt pkcs7: %w", err)
+	}
+	s.Decrypted = true
+	return inner, nil
+}
+
+// verifyPGP 校验 PGP/MIME 分离签名（RFC 3156）
+func (s *Security) verifyPGP(keys *securityKeys, signed, sig []byte) {
+	if len(keys.pgp) == 0 {
+		s.setError(errors.New("no pgp keyring configured"))
+		return
+	}
+	signer, err := openpgp.CheckArmoredDetachedSignature(keys.pgp, bytes.NewReader(canonicalCRLF(signed)), bytes.NewReader(sig), nil)
+	if err != nil {
+		s.setError(err)
+		return
+	}
+	s.SignatureValid, s.Trusted = true, true
+	s.Signers = append(s.Signers, pgpSigner(signer, 0))
+}
+
+// decryptPGP 解密 PGP/MIME 加密内容；内嵌签名（先签名后加密）一并校验
+func (s *Security) decryptPGP(keys *securityKeys, armored []byte) ([]byte, error) {
+	block, err := armor.Decode(bytes.NewReader(armored))
+	if err != nil {
+		return nil, fmt.Errorf("decode pgp armor: %w", err)
+	}
+	md, err := openpgp.ReadMessage(block.Body, keys.pgp, nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("decrypt pgp: %w", err)
+	}
+	inner, err := io.ReadAll(md.UnverifiedBody)
+	if err != nil && md.SignatureError == nil {
+		return nil, fmt.Errorf("read pgp message: %w", err)
+	}
+	if md.IsSigned {
+		s.Signed = true
+		switch {
+		case md.SignedBy == nil:
+			s.setError(fmt.Errorf("unknown signer key %X", md.SignedByKeyId))
+		case md.SignatureError != nil:
+			s.setError(md.SignatureError)
+		default:
+			s.SignatureValid, s.Trusted = true, true
+			s.Signers = append(s.Signers, pgpSigner(md.SignedBy.Entity, md.SignedByKeyId))
+		}
+	}
+	return inner, nil
+}
+
+func certSigner(c *x509.Certificate, trusted bool) Signer {
+	sum := sha256.Sum256(c.Raw)
+	sg := Signer{
+		Name:        c.Subject.CommonName,
+		Issuer:      c.Issuer.CommonName,
+		Serial:      c.SerialNumber.Text(16),
+		Fingerprint: hex.EncodeToString(sum[:]),
+		NotBefore:   c.NotBefore.UTC().Format(time.RFC3339),
+		NotAfter:    c.NotAfter.UTC().Format(time.RFC3339),
+		Trusted:     trusted,
+	}
+	sg.emails = append(sg.emails, c.EmailAddresses...)
+	for _, n := range c.Subject.Names {
+		if n.Type.String() == "1.2.840.113549.1.9.1" { // emailAddress
+			if v, ok := n.Value.(string); ok && v != "" {
+				sg.emails = append(sg.emails, v)
+			}
+		}
+	}
+	if len(sg.emails) > 0 {
+		sg.Email = sg.emails[0]
+	}
+	return sg
+}
+
+func pgpSigner(e *openpgp.Entity, keyID uint64) Signer {
+	sg := Signer{Trusted: true}
+	if e == nil {
+		return sg
+	}
+	sg.Fingerprint = strings.ToUpper(hex.EncodeToString(e.PrimaryKey.Fingerprint))
+	if keyID == 0 {
+		keyID = e.PrimaryKey.KeyId
+	}
+	sg.KeyID = fmt.Sprintf("%016X", keyID)
+	if id := e.PrimaryIdentity(); id != nil {
+		if a, err := mailpkg.ParseAddress(id.Name); err == nil {
+			sg.Name, sg.Email = a.Name, a.Address
+		} else {
+			sg.Name = id.Name
+		}
+	}
+	for _, id := range e.Identities {
+		if id.UserId != nil && id.UserId.Email != "" {
+			sg.emails = append(sg.emails, id.UserId.Email)
+		}
+	}
+	return sg
+}
+
+func signatureType(protocol string) string {
+	if strings.Contains(protocol, "pgp") {
+		return "pgp"
+	}
+	return "smime"
+}
+
+func isSignaturePart(p *mimePart) bool {
+	switch p.MediaType {
+	case "application/pkcs7-signature", "application/x-pkcs7-signature", "application/pgp-signature":
+		return true
+	}
+	return false
+}
+
+// isPKCS7Mime application/pkcs7-mime；部分客户端使用 application/octet-stream + smime.p7m 文件名
+func isPKCS7Mime(mediaType string, params map[string]string, h textproto.Header) bool {
+	switch mediaType {
+	case "application/pkcs7-mime", "application/x-pkcs7-mime":
+		return true
+	case "application/octet-stream":
+		_, dispParams := parseHeaderParams(h.Get("Content-Disposition"))
+		return strings.HasSuffix(strings.ToLower(attachmentFilename(params, dispParams)), ".p7m")
+	}
+	return false
+}
+
+func findPart(parts []mimePart, match func(*mimePart) bool) *mimePart {
+	for i := range parts {
+		if match(&parts[i]) {
+			return &parts[i]
+		}
+	}
+	return nil
+}
+
+// splitEntity 拆分头部与正文
+func splitEntity(raw []byte) (textproto.Header, []byte, error) {
+	br := bufio.NewReader(bytes.NewReader(raw))
+	h, err := textproto.ReadHeader(br)
+	if err != nil {
+		return h, nil, err
+	}
+	body, err := io.ReadAll(br)
+	return h, body, err
+}
+
+// signedContent 按原始字节取出 multipart/signed 的第一个 part（含其头部），
+// 签名覆盖的正是这段字节，不能经过重新解析 / 编码。
+func signedContent(body []byte, boundary string) ([]byte, bool) {
+	if boundary == "" {
+		return nil, false
+	}
+	delim := []byte("--" + boundary)
+	i := bytes.Index(body, delim)
+	if i < 0 {
+		return nil, false
+	}
+	start := i + len(delim)
+	nl := bytes.IndexByte(body[start:], '\n')
+	if nl < 0 {
+		return nil, false
+	}
+	start += nl + 1
+	end := bytes.Index(body[start:], append([]byte("\n"), delim...))
+	if end < 0 {
+		return nil, false
+	}
+	end += start
+	if end > start && body[end-1] == '\r' {
+		end--
+	}
+	return body[start:end], true
+}
+
+// replaceContent 以内层实体替换外层的 Content-* 头部与正文，保留 Subject / From 等外层头部
+func replaceContent(outer textproto.Header, inner []byte) []byte {
+	h := outer.Copy()
+	for _, k := range []string{"Content-Type", "Content-Transfer-Encoding", "Content-Disposition", "Content-Description", "Content-Id"} {
+		h.Del(k)
+	}
+	var buf bytes.Buffer
+	_ = textproto.WriteHeader(&buf, h)
+	out := bytes.TrimSuffix(buf.Bytes(), []byte("\r\n")) // 去掉头部结束空行，紧接内层头部
+	inner = bytes.TrimLeft(inner, "\r\n")
+	if !startsWithHeader(inner) { // 内层没有 MIME 头部（纯文本）
+		out = append(out, "Content-Type: text/plain; charset=utf-8\r\n\r\n"...)
+	}
+	return append(out, canonicalCRLF(inner)...)
+}
+
+func startsWithHeader(b []byte) bool {
+	line, _, _ := bytes.Cut(b, []byte("\n"))
+	name, _, ok := bytes.Cut(line, []byte(":"))
+	return ok && len(name) > 0 && !bytes.ContainsAny(name, " \t")
+}
+
+// canonicalCRLF 将裸 LF 规范为 CRLF（签名按规范化的 CRLF 文本计算）
+func canonicalCRLF(b []byte) []byte {
+	if !bytes.Contains(b, []byte("\n")) {
+		return b
+	}
+	return bytes.ReplaceAll(bytes.ReplaceAll(b, []byte("\r\n"), []byte("\n")), []byte("\n"), []byte("\r\n"))
+}
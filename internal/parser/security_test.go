@@ -0,0 +1,232 @@
+package parser
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"go.mozilla.org/pkcs7"
+
+	"monitor-imap-webhook/internal/config"
+)
+
+const innerEntity = "Content-Type: text/plain; charset=utf-8\r\n\r\n机密内容 secret body\r\n"
+
+// testPKI 生成 CA 与由其签发的邮件证书（RSA，便于 pkcs7 加解密）
+func testPKI(t *testing.T) (dir string, ca, leaf *x509.Certificate, leafKey *rsa.PrivateKey) {
+	t.Helper()
+	dir = t.TempDir()
+	caKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	caTpl := &x509.Certificate{SerialNumber: big.NewInt(1), Subject: pkix.Name{CommonName: "Test CA"}, NotBefore: time.Now().Add(-time.Hour), NotAfter: time.Now().Add(time.Hour),
+		IsCA: true, BasicConstraintsValid: true, KeyUsage: x509.KeyUsageCertSign}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTpl, caTpl, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, _ = x509.ParseCertificate(caDER)
+	leafKey, _ = rsa.GenerateKey(rand.Reader, 2048)
+	leafTpl := &x509.Certificate{SerialNumber: big.NewInt(0x2a), Subject: pkix.Name{CommonName: "Alice"}, EmailAddresses: []string{"alice@example.com"},
+		NotBefore: time.Now().Add(-time.Hour), NotAfter: time.Now().Add(time.Hour), KeyUsage: x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageEmailProtection}}
+	leafDER, err := x509.CreateCertificate(rand.Reader, leafTpl, ca, &leafKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, _ = x509.ParseCertificate(leafDER)
+	write := func(name, typ string, der []byte) {
+		if err := os.WriteFile(filepath.Join(dir, name), pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der}), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("ca.pem", "CERTIFICATE", caDER)
+	write("cert.pem", "CERTIFICATE", leafDER)
+	write("key.pem", "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(leafKey))
+	return dir, ca, leaf, leafKey
+}
+
+func b64Lines(b []byte) string {
+	s := base64.StdEncoding.EncodeToString(b)
+	var out strings.Builder
+	for len(s) > 76 {
+		out.WriteString(s[:76] + "\r\n")
+		s = s[76:]
+	}
+	return out.String() + s + "\r\n"
+}
+
+func TestSMIMESignedAndEncrypted(t *testing.T) {
+	dir, _, leaf, leafKey := testPKI(t)
+	sd, err := pkcs7.NewSignedData([]byte(innerEntity))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sd.AddSigner(leaf, leafKey, pkcs7.SignerInfoConfig{}); err != nil {
+		t.Fatal(err)
+	}
+	sd.Detach()
+	sig, err := sd.Finish()
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed := "From: Alice <alice@example.com>\r\nSubject: signed\r\nMIME-Version: 1.0\r\n" +
+		"Content-Type: multipart/signed; protocol=\"application/pkcs7-signature\"; micalg=sha-256; boundary=s\r\n\r\n" +
+		"--s\r\n" + innerEntity + "\r\n--s\r\nContent-Type: application/pkcs7-signature; name=smime.p7s\r\nContent-Transfer-Encoding: base64\r\n" +
+		"Content-Disposition: attachment; filename=smime.p7s\r\n\r\n" + b64Lines(sig) + "--s--\r\n"
+
+	cfg := &config.Config{HTMLToTextMode: "simple", SMIMECAFile: filepath.Join(dir, "ca.pem")}
+	msg, err := parseRaw([]byte(signed), nil, cfg)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	s := msg.Security
+	if s == nil || s.Type != "smime" || !s.Signed || !s.SignatureValid || !s.Trusted || len(s.Signers) != 1 {
+		t.Fatalf("security=%+v", s)
+	}
+	if sg := s.Signers[0]; sg.Name != "Alice" || sg.Email != "alice@example.com" || sg.Issuer != "Test CA" || sg.Serial != "2a" || !sg.Trusted {
+		t.Fatalf("signer=%+v", sg)
+	}
+	if !strings.Contains(msg.Body, "secret body") {
+		t.Fatalf("body=%q", msg.Body)
+	}
+
+	// 未配置信任库：签名完整但不受信任
+	msg, _ = parseRaw([]byte(signed), nil, &config.Config{HTMLToTextMode: "simple"})
+	if !msg.Security.SignatureValid || msg.Security.Trusted {
+		t.Fatalf("no trust store: %+v", msg.Security)
+	}
+	// 受信任的证书为冒充他人的 From 签名：签名有效但 from_match=false，不受信任
+	msg, _ = parseRaw([]byte(strings.Replace(signed, "Alice <alice@example.com>", "Mallory <MALLORY@example.com>", 1)), nil, cfg)
+	if s := msg.Security; !s.SignatureValid || s.FromMatch || s.Trusted {
+		t.Fatalf("from mismatch: %+v", s)
+	}
+	msg, _ = parseRaw([]byte(strings.Replace(signed, "alice@example.com", "ALICE@Example.com", 1)), nil, cfg)
+	if s := msg.Security; !s.FromMatch || !s.Trusted {
+		t.Fatalf("from case-insensitive: %+v", s)
+	}
+	// 篡改正文
+	msg, _ = parseRaw([]byte(strings.Replace(signed, "secret body", "evil body", 1)), nil, cfg)
+	if msg.Security.SignatureValid || msg.Security.Error == "" {
+		t.Fatalf("tampered: %+v", msg.Security)
+	}
+
+	// 被签内容中带有另一个 .p7s（如转发的签名邮件）：仍校验 multipart/signed 自身的签名
+	nested := "Content-Type: multipart/mixed; boundary=m\r\n\r\n--m\r\nContent-Type: text/plain\r\n\r\nsee attached\r\n" +
+		"--m\r\nContent-Type: application/pkcs7-signature; name=smime.p7s\r\nContent-Transfer-Encoding: base64\r\n\r\nAAAA\r\n--m--\r\n"
+	sd, _ = pkcs7.NewSignedData([]byte(nested))
+	sd.AddSigner(leaf, leafKey, pkcs7.SignerInfoConfig{})
+	sd.Detach()
+	nestedSig, _ := sd.Finish()
+	msg, _ = parseRaw([]byte(strings.NewReplacer(innerEntity, nested, b64Lines(sig), b64Lines(nestedSig)).Replace(signed)), nil, cfg)
+	if s := msg.Security; !s.SignatureValid || !s.Trusted {
+		t.Fatalf("nested signature part: %+v", s)
+	}
+
+	pkcs7.ContentEncryptionAlgorithm = pkcs7.EncryptionAlgorithmAES128CBC
+	env, err := pkcs7.Encrypt([]byte(innerEntity), []*x509.Certificate{leaf})
+	if err != nil {
+		t.Fatal(err)
+	}
+	encrypted := "From: Alice <alice@example.com>\r\nSubject: encrypted\r\nMIME-Version: 1.0\r\n" +
+		"Content-Type: application/pkcs7-mime; smime-type=enveloped-data; name=smime.p7m\r\nContent-Transfer-Encoding: base64\r\n" +
+		"Content-Disposition: attachment; filename=smime.p7m\r\n\r\n" + b64Lines(env)
+	msg, _ = parseRaw([]byte(encrypted), nil, &config.Config{HTMLToTextMode: "simple"})
+	if s := msg.Security; s == nil || !s.Encrypted || s.Decrypted || s.Error == "" || !msg.HasAttachments {
+		t.Fatalf("no key: security=%+v", msg.Security)
+	}
+	cfg = &config.Config{HTMLToTextMode: "simple", SMIMECertFile: filepath.Join(dir, "cert.pem"), SMIMEKeyFile: filepath.Join(dir, "key.pem")}
+	msg, err = parseRaw([]byte(encrypted), nil, cfg)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if s := msg.Security; s == nil || !s.Encrypted || !s.Decrypted || s.Error != "" {
+		t.Fatalf("decrypt: security=%+v", msg.Security)
+	}
+	if msg.Subject != "encrypted" || !strings.Contains(msg.Body, "机密内容") || msg.HasAttachments {
+		t.Fatalf("decrypted message: subject=%q body=%q attachments=%v", msg.Subject, msg.Body, msg.AttachmentNames)
+	}
+}
+
+func TestPGPSignedAndEncrypted(t *testing.T) {
+	dir := t.TempDir()
+	alice, err := openpgp.NewEntity("Alice", "", "alice@example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bob, err := openpgp.NewEntity("Bob", "", "bob@example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var pub bytes.Buffer
+	w, _ := armor.Encode(&pub, openpgp.PublicKeyType, nil)
+	alice.Serialize(w)
+	w.Close()
+	var priv bytes.Buffer
+	w, _ = armor.Encode(&priv, openpgp.PrivateKeyType, nil)
+	bob.SerializePrivate(w, nil)
+	w.Close()
+	os.WriteFile(filepath.Join(dir, "pub.asc"), pub.Bytes(), 0o600)
+	os.WriteFile(filepath.Join(dir, "priv.asc"), priv.Bytes(), 0o600)
+	cfg := &config.Config{HTMLToTextMode: "simple", PGPKeyringFile: filepath.Join(dir, "pub.asc"), PGPPrivateKeyFile: filepath.Join(dir, "priv.asc")}
+
+	var sig bytes.Buffer
+	if err := openpgp.ArmoredDetachSign(&sig, alice, strings.NewReader(innerEntity), nil); err != nil {
+		t.Fatal(err)
+	}
+	signed := "From: alice@example.com\r\nSubject: pgp signed\r\n" +
+		"Content-Type: multipart/signed; micalg=pgp-sha256; protocol=\"application/pgp-signature\"; boundary=p\r\n\r\n" +
+		"--p\r\n" + innerEntity + "\r\n--p\r\nContent-Type: application/pgp-signature; name=signature.asc\r\n\r\n" + sig.String() + "\r\n--p--\r\n"
+	msg, err := parseRaw([]byte(signed), nil, cfg)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	s := msg.Security
+	if s == nil || s.Type != "pgp" || !s.SignatureValid || len(s.Signers) != 1 || s.Signers[0].Email != "alice@example.com" || s.Signers[0].Fingerprint == "" {
+		t.Fatalf("signed: security=%+v", s)
+	}
+	if !s.FromMatch || !s.Trusted {
+		t.Fatalf("signed: from_match=%v trusted=%v", s.FromMatch, s.Trusted)
+	}
+	msg, _ = parseRaw([]byte(strings.Replace(signed, "From: alice@example.com", "From: mallory@example.com", 1)), nil, cfg)
+	if s := msg.Security; !s.SignatureValid || s.FromMatch || s.Trusted {
+		t.Fatalf("pgp from mismatch: %+v", s)
+	}
+
+	var enc bytes.Buffer
+	aw, _ := armor.Encode(&enc, "PGP MESSAGE", nil)
+	pw, err := openpgp.Encrypt(aw, []*openpgp.Entity{bob}, alice, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pw.Write([]byte(innerEntity))
+	pw.Close()
+	aw.Close()
+	encrypted := "From: alice@example.com\r\nSubject: pgp encrypted\r\n" +
+		"Content-Type: multipart/encrypted; protocol=\"application/pgp-encrypted\"; boundary=e\r\n\r\n" +
+		"--e\r\nContent-Type: application/pgp-encrypted\r\n\r\nVersion: 1\r\n" +
+		"--e\r\nContent-Type: application/octet-stream; name=encrypted.asc\r\n\r\n" + enc.String() + "\r\n--e--\r\n"
+	msg, err = parseRaw([]byte(encrypted), nil, cfg)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	s = msg.Security
+	if s == nil || !s.Encrypted || !s.Decrypted || !s.Signed || !s.SignatureValid || len(s.Signers) != 1 || s.Signers[0].Name != "Alice" {
+		t.Fatalf("encrypted: security=%+v", s)
+	}
+	if !strings.Contains(msg.Body, "secret body") || msg.HasAttachments {
+		t.Fatalf("decrypted body=%q attachments=%v", msg.Body, msg.AttachmentNames)
+	}
+}
@@ -0,0 +1,228 @@
+package parser
+
+import (
+	"encoding/json"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// StructuredItem HTML 正文中嵌入的一个 schema.org 顶层对象
+type StructuredItem struct {
+	Type    string         `json:"type"`              // schema.org 类型（去掉 https://schema.org/ 前缀）
+	Format  string         `json:"format"`            // json-ld | microdata
+	Valid   bool           `json:"valid"`             // 已知类型的必需属性齐全（其它类型只要求有 @type）
+	Missing []string       `json:"missing,omitempty"` // 缺失的必需属性路径
+	Data    map[string]any `json:"data"`              // 原始对象；microdata 转换为与 JSON-LD 相同的形式
+}
+
+// requiredProps 常见邮件标记类型的必需属性（参考 Gmail 邮件标记文档，按实际发件方的常见写法放宽）；
+// "a|b" 表示任一存在即可，"a.b" 为嵌套路径。
+var requiredProps = map[string][]string{
+	"Order":             {"orderNumber", "merchant|seller"},
+	"FlightReservation": {"reservationNumber", "reservationFor.flightNumber", "reservationFor.departureAirport", "reservationFor.arrivalAirport", "reservationFor.departureTime"},
+	"Invoice":           {"provider|broker", "totalPaymentDue|minimumPaymentDue|paymentDue|paymentDueDate"},
+	"ParcelDelivery":    {"carrier|provider", "trackingNumber|trackingUrl|expectedArrivalUntil"},
+}
+
+// buildStructuredData 提取 JSON-LD 与 microdata 顶层对象并校验已知类型
+func buildStructuredData(rawHTML string) []StructuredItem {
+	if rawHTML == "" {
+		return nil
+	}
+	doc, err := html.Parse(strings.NewReader(rawHTML))
+	if err != nil {
+		return nil
+	}
+	var items []StructuredItem
+	for _, obj := range parseJSONLD(doc) {
+		items = append(items, newStructuredItem(obj, "json-ld"))
+	}
+	for _, obj := range parseMicrodata(doc) {
+		items = append(items, newStructuredItem(obj, "microdata"))
+	}
+	return items
+}
+
+func newStructuredItem(obj map[string]any, format string) StructuredItem {
+	it := StructuredItem{Type: ldTypeName(obj), Format: format, Data: obj}
+	for _, req := range requiredProps[it.Type] {
+		found := false
+		for _, alt := range strings.Split(req, "|") {
+			if len(evalPath(obj, alt)) > 0 {
+				found = true
+				break
+			}
+		}
+		if !found {
+			it.Missing = append(it.Missing, req)
+		}
+	}
+	it.Valid = it.Type != "" && len(it.Missing) == 0
+	return it
+}
+
+// ldTypeName 取 @type（数组时取第一个），去掉 schema.org 前缀
+func ldTypeName(obj map[string]any) string {
+	switch t := obj["@type"].(type) {
+	case string:
+		return trimSchemaOrg(t)
+	case []any:
+		if len(t) > 0 {
+			s, _ := t[0].(string)
+			return trimSchemaOrg(s)
+		}
+	}
+	return ""
+}
+
+func trimSchemaOrg(s string) string {
+	for _, p := range []string{"http://schema.org/", "https://schema.org/", "schema:"} {
+		s = strings.TrimPrefix(s, p)
+	}
+	return s
+}
+
+// parseJSONLD 收集 <script type="application/ld+json"> 中的对象；顶层数组与 @graph 展开
+func parseJSONLD(doc *html.Node) []map[string]any {
+	var out []map[string]any
+	var add func(v any)
+	add = func(v any) {
+		switch t := v.(type) {
+		case []any:
+			for _, e := range t {
+				add(e)
+			}
+		case map[string]any:
+			if g, ok := t["@graph"]; ok {
+				add(g)
+				return
+			}
+			out = append(out, t)
+		}
+	}
+	var visit func(*html.Node)
+	visit = func(n *html.Node) {
+		if n.Type == html.ElementNode && n.DataAtom == atom.Script && strings.EqualFold(strings.TrimSpace(attr(n, "type")), "application/ld+json") {
+			var v any
+			if err := json.Unmarshal([]byte(strings.TrimSpace(nodeText(n))), &v); err == nil {
+				add(v)
+			}
+			return
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			visit(c)
+		}
+	}
+	visit(doc)
+	return out
+}
+
+// hasLDType @type 可为字符串或数组，忽略 schema.org 前缀
+func hasLDType(obj map[string]any, typ string) bool {
+	match := func(v any) bool {
+		s, _ := v.(string)
+		return strings.EqualFold(trimSchemaOrg(s), typ)
+	}
+	switch t := obj["@type"].(type) {
+	case []any:
+		for _, v := range t {
+			if match(v) {
+				return true
+			}
+		}
+		return false
+	default:
+		return match(t)
+	}
+}
+
+// parseMicrodata 解析顶层 microdata 条目（带 itemscope 且不是其它条目属性的元素），
+// 转换为 {"@type": ..., prop: value} 形式；同名属性多次出现时为数组，嵌套条目为对象。
+func parseMicrodata(doc *html.Node) []map[string]any {
+	var out []map[string]any
+	var visit func(*html.Node)
+	visit = func(n *html.Node) {
+		if n.Type == html.ElementNode && hasAttr(n, "itemscope") && !hasAttr(n, "itemprop") {
+			out = append(out, microdataItem(n))
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			visit(c)
+		}
+	}
+	visit(doc)
+	return out
+}
+
+func microdataItem(scope *html.Node) map[string]any {
+	item := make(map[string]any)
+	if types := strings.Fields(attr(scope, "itemtype")); len(types) > 0 {
+		item["@type"] = trimSchemaOrg(types[0])
+	}
+	var collect func(*html.Node)
+	collect = func(n *html.Node) {
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if c.Type != html.ElementNode {
+				continue
+			}
+			if names := strings.Fields(attr(c, "itemprop")); len(names) > 0 {
+				var v any
+				if hasAttr(c, "itemscope") {
+					v = microdataItem(c)
+				} else {
+					v = microdataValue(c)
+				}
+				for _, name := range names {
+					addProp(item, name, v)
+				}
+			}
+			if !hasAttr(c, "itemscope") { // 嵌套条目的属性归属嵌套条目
+				collect(c)
+			}
+		}
+	}
+	collect(scope)
+	return item
+}
+
+func addProp(item map[string]any, name string, v any) {
+	switch cur := item[name].(type) {
+	case nil:
+		item[name] = v
+	case []any:
+		item[name] = append(cur, v)
+	default:
+		item[name] = []any{cur, v}
+	}
+}
+
+// microdataValue 按 HTML 规范取属性值：meta 取 content，链接 / 媒体取 URL，time 取 datetime，其它取文本
+func microdataValue(n *html.Node) string {
+	switch n.DataAtom {
+	case atom.Meta:
+		return strings.TrimSpace(attr(n, "content"))
+	case atom.Audio, atom.Embed, atom.Iframe, atom.Img, atom.Source, atom.Track, atom.Video:
+		return strings.TrimSpace(attr(n, "src"))
+	case atom.A, atom.Area, atom.Link:
+		return strings.TrimSpace(attr(n, "href"))
+	case atom.Object:
+		return strings.TrimSpace(attr(n, "data"))
+	case atom.Data, atom.Meter:
+		return strings.TrimSpace(attr(n, "value"))
+	case atom.Time:
+		if hasAttr(n, "datetime") {
+			return strings.TrimSpace(attr(n, "datetime"))
+		}
+	}
+	return strings.Join(strings.Fields(nodeText(n)), " ")
+}
+
+func hasAttr(n *html.Node, key string) bool {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return true
+		}
+	}
+	return false
+}
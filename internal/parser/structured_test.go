@@ -0,0 +1,81 @@
+package parser
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBuildStructuredDataJSONLD(t *testing.T) {
+	rawHTML := `<html><head>
+<script type="application/ld+json">
+{"@context": "http://schema.org", "@type": "Order", "orderNumber": "A-1001",
+ "merchant": {"@type": "Organization", "name": "Example Shop"}, "price": "29.90", "priceCurrency": "CNY"}
+</script>
+<script type="application/ld+json">
+{"@context": "https://schema.org", "@graph": [
+ {"@type": "FlightReservation", "reservationNumber": "RXJ34P",
+  "reservationFor": {"@type": "Flight", "flightNumber": "110", "departureAirport": {"iataCode": "PEK"}, "arrivalAirport": {"iataCode": "SHA"}}},
+ {"@type": "Person", "name": "张三"}]}
+</script>
+<script type="application/ld+json">{broken</script>
+</head><body>hi</body></html>`
+
+	items := buildStructuredData(rawHTML)
+	if len(items) != 3 {
+		t.Fatalf("items=%+v", items)
+	}
+	if items[0].Type != "Order" || items[0].Format != "json-ld" || !items[0].Valid || items[0].Data["orderNumber"] != "A-1001" {
+		t.Fatalf("order=%+v", items[0])
+	}
+	if items[1].Type != "FlightReservation" || items[1].Valid || !reflect.DeepEqual(items[1].Missing, []string{"reservationFor.departureTime"}) {
+		t.Fatalf("flight=%+v", items[1])
+	}
+	if items[2].Type != "Person" || !items[2].Valid {
+		t.Fatalf("person=%+v", items[2])
+	}
+}
+
+func TestBuildStructuredDataMicrodata(t *testing.T) {
+	rawHTML := `<div itemscope itemtype="http://schema.org/ParcelDelivery">
+  <div itemprop="carrier" itemscope itemtype="http://schema.org/Organization">
+    <meta itemprop="name" content="顺丰速运">
+  </div>
+  <p>运单号：<span itemprop="trackingNumber"> SF 1234 </span></p>
+  <a itemprop="trackingUrl" href="https://example.com/track/SF1234">查看物流</a>
+  <time itemprop="expectedArrivalUntil" datetime="2024-05-01T18:00:00+08:00">5 月 1 日</time>
+  <div itemprop="itemShipped" itemscope itemtype="http://schema.org/Product"><span itemprop="name">键盘</span></div>
+  <div itemprop="itemShipped" itemscope itemtype="http://schema.org/Product"><span itemprop="name">鼠标</span></div>
+</div>
+<div itemscope itemtype="https://schema.org/Invoice"><span itemprop="accountId">42</span></div>`
+
+	items := buildStructuredData(rawHTML)
+	if len(items) != 2 {
+		t.Fatalf("items=%+v", items)
+	}
+	p := items[0]
+	if p.Type != "ParcelDelivery" || p.Format != "microdata" || !p.Valid {
+		t.Fatalf("parcel=%+v", p)
+	}
+	want := map[string]any{
+		"@type":                "ParcelDelivery",
+		"carrier":              map[string]any{"@type": "Organization", "name": "顺丰速运"},
+		"trackingNumber":       "SF 1234",
+		"trackingUrl":          "https://example.com/track/SF1234",
+		"expectedArrivalUntil": "2024-05-01T18:00:00+08:00",
+		"itemShipped": []any{
+			map[string]any{"@type": "Product", "name": "键盘"},
+			map[string]any{"@type": "Product", "name": "鼠标"},
+		},
+	}
+	if !reflect.DeepEqual(p.Data, want) {
+		t.Fatalf("data=%#v", p.Data)
+	}
+	inv := items[1]
+	if inv.Type != "Invoice" || inv.Valid || len(inv.Missing) != 2 {
+		t.Fatalf("invoice=%+v", inv)
+	}
+
+	if buildStructuredData("<p>plain</p>") != nil || buildStructuredData("") != nil {
+		t.Fatal("expected nil without markup")
+	}
+}
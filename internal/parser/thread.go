@@ -0,0 +1,271 @@
+package parser
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	mailpkg "net/mail"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	imap "github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/client"
+	"github.com/emersion/go-imap/commands"
+	"github.com/emersion/go-imap/responses"
+)
+
+// 会话 ID 来源
+const (
+	ThreadSourceGmail      = "gmail"       // X-GM-THRID
+	ThreadSourceServer     = "imap_thread" // IMAP THREAD=REFERENCES
+	ThreadSourceReferences = "references"  // References 首个 ID（会话根）
+	ThreadSourceInReplyTo  = "in_reply_to"
+	ThreadSourceMessageID  = "message_id" // 会话首封邮件
+	ThreadSourceSubject    = "subject"    // 缺少 Message-ID 时按归一化主题
+)
+
+// gmThreadItem Gmail 扩展 fetch 项（需 X-GM-EXT-1 能力）
+const gmThreadItem imap.FetchItem = "X-GM-THRID"
+
+// serverThreadWindow 服务器 THREAD 搜索的时间窗口（避免对整个邮箱做线程计算）
+const serverThreadWindow = 90 * 24 * time.Hour
+
+// replyPrefixRe / forwardPrefixRe 匹配主题开头的一个回复/转发前缀，
+// 兼容 "Re[2]:"、"RE: "、全角冒号 "回复：" 以及常见的德语/北欧/法语写法。
+var (
+	replyPrefixRe   = regexp.MustCompile(`(?i)^\s*(re|aw|sv|vs|antw|答复|回复|回覆)\s*(\[\d+\]|\(\d+\))?\s*[:：]\s*`)
+	forwardPrefixRe = regexp.MustCompile(`(?i)^\s*(fwd?|wg|tr|rv|转发|轉寄|转寄)\s*(\[\d+\]|\(\d+\))?\s*[:：]\s*`)
+)
+
+// normalizeSubject 反复剥离主题开头的回复/转发前缀，返回剩余主题及是否出现过回复/转发前缀
+func normalizeSubject(subject string) (rest string, reply, forward bool) {
+	rest = strings.TrimSpace(subject)
+	for {
+		if loc := replyPrefixRe.FindStringIndex(rest); loc != nil {
+			rest, reply = rest[loc[1]:], true
+			continue
+		}
+		if loc := forwardPrefixRe.FindStringIndex(rest); loc != nil {
+			rest, forward = rest[loc[1]:], true
+			continue
+		}
+		return strings.TrimSpace(rest), reply, forward
+	}
+}
+
+// threadKey 基于头部计算会话键：References 根 > In-Reply-To > 自身 Message-ID > 归一化主题
+func threadKey(msg *Message, normalized string) (key, source string) {
+	switch {
+	case len(msg.References) > 0:
+		return "id:" + msg.References[0], ThreadSourceReferences
+	case msg.InReplyTo != "":
+		return "id:" + msg.InReplyTo, ThreadSourceInReplyTo
+	case msg.MessageID != "":
+		return "id:" + msg.MessageID, ThreadSourceMessageID
+	case normalized != "":
+		return "subject:" + strings.ToLower(strings.Join(strings.Fields(normalized), " ")), ThreadSourceSubject
+	}
+	return "", ""
+}
+
+// hashThreadKey 将会话键映射为稳定的短 ID（同一会话内各邮件一致）
+func hashThreadKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:8])
+}
+
+// applyThread 填充 ThreadID / ThreadSource / IsReply / IsForward（仅依据头部）
+func applyThread(msg *Message) {
+	normalized, reply, forward := normalizeSubject(msg.Subject)
+	msg.IsReply = reply || msg.InReplyTo != ""
+	msg.IsForward = forward
+	if key, source := threadKey(msg, normalized); key != "" {
+		msg.ThreadID, msg.ThreadSource = hashThreadKey(key), source
+	}
+}
+
+// gmailThreadID 读取 fetch 结果中的 X-GM-THRID
+func gmailThreadID(im *imap.Message) string {
+	if im == nil {
+		return ""
+	}
+	v, ok := im.Items[gmThreadItem]
+	if !ok || v == nil {
+		return ""
+	}
+	switch t := v.(type) {
+	case string:
+		return t
+	case imap.RawString:
+		return string(t)
+	}
+	if n, err := imap.ParseNumber(v); err == nil {
+		return strconv.FormatUint(uint64(n), 10)
+	}
+	return ""
+}
+
+// threadCommand UID THREAD REFERENCES UTF-8 <criteria>（RFC 5256）
+type threadCommand struct {
+	Criteria *imap.SearchCriteria
+}
+
+func (cmd *threadCommand) Command() *imap.Command {
+	args := []interface{}{imap.RawString("REFERENCES"), imap.RawString("UTF-8")}
+	return &imap.Command{Name: "THREAD", Arguments: append(args, cmd.Criteria.Format()...)}
+}
+
+// threadResponse 解析 "* THREAD (1 2 (3)(4 5))(6)"：每个顶层列表为一个会话，收集其中全部 UID
+type threadResponse struct {
+	Threads [][]uint32
+}
+
+func (r *threadResponse) Handle(resp imap.Resp) error {
+	name, fields, ok := imap.ParseNamedResp(resp)
+	if !ok || name != "THREAD" {
+		return responses.ErrUnhandled
+	}
+	for _, f := range fields {
+		var ids []uint32
+		collectThreadIDs(f, &ids)
+		if len(ids) > 0 {
+			r.Threads = append(r.Threads, ids)
+		}
+	}
+	return nil
+}
+
+func collectThreadIDs(f interface{}, out *[]uint32) {
+	if list, ok := f.([]interface{}); ok {
+		for _, v := range list {
+			collectThreadIDs(v, out)
+		}
+		return
+	}
+	if n, err := imap.ParseNumber(f); err == nil {
+		*out = append(*out, n)
+	}
+}
+
+// findThread 返回包含 uid 的会话（UID 升序）
+func findThread(threads [][]uint32, uid uint32) []uint32 {
+	for _, t := range threads {
+		for _, id := range t {
+			if id == uid {
+				ids := append([]uint32(nil), t...)
+				sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+				return ids
+			}
+		}
+	}
+	return nil
+}
+
+// threadCache 最近一次 UID THREAD 的结果，按 UIDVALIDITY 与窗口起始日缓存。
+// 新邮件的 UID 总是大于已有邮件，不会改变旧会话的最早邮件，因此只有 uid 超出结果中的最大 UID
+// （缓存之后到达的邮件）时才重新执行；同一批到达的邮件共用一次 THREAD。
+type threadCache struct {
+	mu       sync.Mutex
+	validity uint32
+	since    time.Time
+	maxUID   uint32
+	threads  [][]uint32
+}
+
+var serverThreads threadCache
+
+// lookup 返回包含 uid 的会话（UID 升序），必要时重新执行 UID THREAD
+func (tc *threadCache) lookup(c *client.Client, uid uint32) ([]uint32, error) {
+	var validity uint32
+	if mbox := c.Mailbox(); mbox != nil {
+		validity = mbox.UidValidity
+	}
+	y, m, d := time.Now().Add(-serverThreadWindow).Date() // SEARCH SINCE 只精确到日
+	since := time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	if tc.threads != nil && tc.validity == validity && tc.since.Equal(since) && uid <= tc.maxUID {
+		return findThread(tc.threads, uid), nil // 不在结果中：早于窗口或已删除
+	}
+	criteria := imap.NewSearchCriteria()
+	criteria.Since = since
+	res := new(threadResponse)
+	status, err := c.Execute(&commands.Uid{Cmd: &threadCommand{Criteria: criteria}}, res)
+	if err != nil {
+		return nil, err
+	}
+	if err := status.Err(); err != nil {
+		return nil, err
+	}
+	tc.validity, tc.since, tc.threads, tc.maxUID = validity, since, res.Threads, 0
+	for _, t := range res.Threads {
+		for _, id := range t {
+			tc.maxUID = max(tc.maxUID, id)
+		}
+	}
+	return findThread(res.Threads, uid), nil
+}
+
+// reset 丢弃缓存（会话最早的邮件已被删除时）
+func (tc *threadCache) reset() {
+	tc.mu.Lock()
+	tc.threads = nil
+	tc.mu.Unlock()
+}
+
+// threadHeaderSection 计算会话键所需的头部
+var threadHeaderSection = &imap.BodySectionName{
+	BodyPartName: imap.BodyPartName{Specifier: imap.HeaderSpecifier, Fields: []string{"Message-ID", "In-Reply-To", "References"}},
+	Peek:         true,
+}
+
+// serverThreadID 通过 UID THREAD 找到 uid 所在会话中最早（UID 最小）的邮件，
+// 以其会话键（References 根 > In-Reply-To > 自身 Message-ID）计算 thread_id，与头部模式同一命名空间；
+// 会话根早于窗口或已被删除时，最早邮件的 References 根仍指向同一会话根，因此 ID 不变。
+func serverThreadID(c *client.Client, uid uint32) (string, error) {
+	ids, err := serverThreads.lookup(c, uid)
+	if err != nil || len(ids) == 0 {
+		return "", err
+	}
+	seq := new(imap.SeqSet)
+	seq.AddNum(ids[0])
+	ch := make(chan *imap.Message, 1)
+	if err := c.UidFetch(seq, []imap.FetchItem{threadHeaderSection.FetchItem()}, ch); err != nil {
+		return "", err
+	}
+	first := <-ch
+	if first == nil {
+		serverThreads.reset()
+		return "", nil
+	}
+	for _, lit := range first.Body { // 服务器回显的字段名大小写可能不同，只请求了一个 section
+		if lit != nil {
+			hdr, _ := io.ReadAll(lit)
+			return threadIDFromHeader(hdr), nil
+		}
+	}
+	return "", nil
+}
+
+// threadIDFromHeader 按头部模式的规则由原始头部计算 thread_id；缺少 ID 时返回空
+func threadIDFromHeader(hdr []byte) string {
+	h, err := mailpkg.ReadMessage(bytes.NewReader(append(bytes.TrimRight(hdr, "\r\n"), "\r\n\r\n"...)))
+	if err != nil {
+		return ""
+	}
+	m := &Message{
+		MessageID:  firstMsgID(h.Header.Get("Message-Id")),
+		InReplyTo:  firstMsgID(h.Header.Get("In-Reply-To")),
+		References: parseMsgIDs(h.Header.Get("References")),
+	}
+	if key, _ := threadKey(m, ""); key != "" {
+		return hashThreadKey(key)
+	}
+	return ""
+}
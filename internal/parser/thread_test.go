@@ -0,0 +1,109 @@
+package parser
+
+import (
+	"reflect"
+	"testing"
+
+	imap "github.com/emersion/go-imap"
+
+	"monitor-imap-webhook/internal/config"
+)
+
+func TestNormalizeSubject(t *testing.T) {
+	cases := []struct {
+		in             string
+		want           string
+		reply, forward bool
+	}{
+		{"Re: 项目进度", "项目进度", true, false},
+		{"RE[2]: Re: hello", "hello", true, false},
+		{"Fwd: FW: 报价单", "报价单", false, true},
+		{"回复：转发: 会议纪要", "会议纪要", true, true},
+		{"AW: Termin", "Termin", true, false},
+		{"Regarding: invoice", "Regarding: invoice", false, false},
+		{"Fwd:", "", false, true},
+	}
+	for _, c := range cases {
+		got, reply, forward := normalizeSubject(c.in)
+		if got != c.want || reply != c.reply || forward != c.forward {
+			t.Errorf("%q => %q reply=%v forward=%v", c.in, got, reply, forward)
+		}
+	}
+}
+
+func threadRaw(subject, headers string) []byte {
+	return []byte("From: a@example.com\r\nSubject: " + subject + "\r\n" + headers +
+		"Content-Type: text/plain\r\n\r\nhi\r\n")
+}
+
+func TestThreadIDStableAcrossConversation(t *testing.T) {
+	cfg := &config.Config{HTMLToTextMode: "simple"}
+	root, _ := parseRaw(threadRaw("周报", "Message-ID: <root@x>\r\n"), nil, cfg)
+	reply, _ := parseRaw(threadRaw("Re: 周报", "Message-ID: <r1@x>\r\nIn-Reply-To: <root@x>\r\n"), nil, cfg)
+	deep, _ := parseRaw(threadRaw("回复: Re: 周报", "Message-ID: <r2@x>\r\nIn-Reply-To: <r1@x>\r\nReferences: <root@x> <r1@x>\r\n"), nil, cfg)
+	if root.ThreadID == "" || root.ThreadID != reply.ThreadID || reply.ThreadID != deep.ThreadID {
+		t.Fatalf("thread ids differ: %q %q %q", root.ThreadID, reply.ThreadID, deep.ThreadID)
+	}
+	if root.ThreadSource != ThreadSourceMessageID || reply.ThreadSource != ThreadSourceInReplyTo || deep.ThreadSource != ThreadSourceReferences {
+		t.Fatalf("sources: %s %s %s", root.ThreadSource, reply.ThreadSource, deep.ThreadSource)
+	}
+	if root.IsReply || !reply.IsReply || !deep.IsReply {
+		t.Fatalf("is_reply: %v %v %v", root.IsReply, reply.IsReply, deep.IsReply)
+	}
+}
+
+func TestThreadIDSubjectFallback(t *testing.T) {
+	cfg := &config.Config{HTMLToTextMode: "simple"}
+	a, _ := parseRaw(threadRaw("Invoice  #42", ""), nil, cfg)
+	b, _ := parseRaw(threadRaw("FW: invoice #42", ""), nil, cfg)
+	if a.ThreadSource != ThreadSourceSubject || a.ThreadID != b.ThreadID {
+		t.Fatalf("subject fallback: %+v / %+v", a, b)
+	}
+	if a.IsForward || !b.IsForward {
+		t.Fatalf("is_forward: %v %v", a.IsForward, b.IsForward)
+	}
+}
+
+func TestThreadResponse(t *testing.T) {
+	// * THREAD (2)(3 6 (4 23)(44 7 96))
+	fields := []interface{}{"THREAD",
+		[]interface{}{"2"},
+		[]interface{}{"3", "6", []interface{}{"4", "23"}, []interface{}{"44", "7", "96"}},
+	}
+	res := new(threadResponse)
+	if err := res.Handle(&imap.DataResp{Fields: fields}); err != nil {
+		t.Fatalf("handle: %v", err)
+	}
+	if len(res.Threads) != 2 {
+		t.Fatalf("threads=%v", res.Threads)
+	}
+	if got := findThread(res.Threads, 23); !reflect.DeepEqual(got, []uint32{3, 4, 6, 7, 23, 44, 96}) {
+		t.Fatalf("findThread=%v", got)
+	}
+	if got := findThread(res.Threads, 99); got != nil {
+		t.Fatalf("unexpected thread %v", got)
+	}
+}
+
+func TestGmailThreadID(t *testing.T) {
+	im := &imap.Message{Items: map[imap.FetchItem]interface{}{gmThreadItem: "1266894439832287888"}}
+	if got := gmailThreadID(im); got != "1266894439832287888" {
+		t.Fatalf("got %q", got)
+	}
+	if got := gmailThreadID(&imap.Message{}); got != "" {
+		t.Fatalf("got %q", got)
+	}
+}
+
+func TestThreadIDFromHeader(t *testing.T) {
+	cfg := &config.Config{HTMLToTextMode: "simple"}
+	reply, _ := parseRaw(threadRaw("Re: 周报", "Message-ID: <r2@x>\r\nIn-Reply-To: <r1@x>\r\nReferences: <root@x> <r1@x>\r\n"), nil, cfg)
+	// 会话根已删除时，服务器会话中最早的邮件仍以 References 根计算，与头部模式一致
+	hdr := "Message-ID: <r1@x>\r\nIn-Reply-To: <root@x>\r\nReferences: <root@x>\r\n"
+	if got := threadIDFromHeader([]byte(hdr)); got != reply.ThreadID {
+		t.Fatalf("got %q want %q", got, reply.ThreadID)
+	}
+	if got := threadIDFromHeader([]byte("Subject: x\r\n")); got != "" {
+		t.Fatalf("expected empty, got %q", got)
+	}
+}
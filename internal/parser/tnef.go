@@ -0,0 +1,356 @@
+package parser
+
+import (
+	"encoding/binary"
+	"errors"
+	"mime"
+	"path"
+	"strings"
+	"unicode/utf16"
+)
+
+// TNEF（application/ms-tnef，即 winmail.dat）解码，参考 MS-OXTNEF。
+const tnefSignature = 0x223e9f78
+
+// TNEF 属性 ID（低 16 位；高 16 位为类型，不参与判断）
+const (
+	attSubject       = 0x8004
+	attBody          = 0x800c
+	attAttachData    = 0x800f
+	attAttachTitle   = 0x8010
+	attAttachRenddat = 0x9002
+	attMAPIProps     = 0x9003
+	attAttachment    = 0x9005
+	attOemCodepage   = 0x9007
+)
+
+// MAPI 属性 ID
+const (
+	prBody             = 0x1000
+	prRTFCompressed    = 0x1009
+	prBodyHTML         = 0x1013
+	prDisplayName      = 0x3001
+	prAttachDataBin    = 0x3701
+	prAttachFilename   = 0x3704
+	prAttachLongName   = 0x3707
+	prAttachMimeTag    = 0x370e
+	prAttachContentID  = 0x3712
+	prInternetCodepage = 0x3fde
+)
+
+// MAPI 属性类型
+const (
+	ptShort   = 0x0002
+	ptLong    = 0x0003
+	ptFloat   = 0x0004
+	ptDouble  = 0x0005
+	ptCurr    = 0x0006
+	ptAppTime = 0x0007
+	ptError   = 0x000a
+	ptBoolean = 0x000b
+	ptObject  = 0x000d
+	ptI8      = 0x0014
+	ptString8 = 0x001e
+	ptUnicode = 0x001f
+	ptSysTime = 0x0040
+	ptCLSID   = 0x0048
+	ptBinary  = 0x0102
+	mvFlag    = 0x1000
+)
+
+// tnefMessage 解出的正文与附件
+type tnefMessage struct {
+	Subject     string
+	Text        string // PR_BODY / attBody
+	HTML        string // PR_BODY_HTML 或由 \fromhtml RTF 还原的 HTML
+	RTFText     string // 普通 RTF 转换的纯文本（没有 Text 时使用）
+	Attachments []tnefAttachment
+}
+
+type tnefAttachment struct {
+	Filename    string
+	ContentType string
+	ContentID   string
+	Data        []byte
+}
+
+// mapiValue 一个 MAPI 属性的首个值
+type mapiValue struct {
+	typ  uint16
+	data []byte
+}
+
+func isTNEF(p *mimePart) bool {
+	if p.MediaType == "application/ms-tnef" || p.MediaType == "application/vnd.ms-tnef" {
+		return true
+	}
+	return strings.EqualFold(p.Filename(), "winmail.dat")
+}
+
+// decodeTNEF 解析 TNEF 流；无法识别签名时返回错误，中途截断时返回已解出的内容
+func decodeTNEF(data []byte) (*tnefMessage, error) {
+	if len(data) < 6 || binary.LittleEndian.Uint32(data) != tnefSignature {
+		return nil, errors.New("tnef: bad signature")
+	}
+	m := &tnefMessage{}
+	codepage := 1252
+	var rtf []byte
+	var cur *tnefAttachment
+	var title string
+	finish := func() {
+		if cur != nil && cur.Data != nil {
+			if cur.Filename == "" {
+				cur.Filename = title
+			}
+			m.Attachments = append(m.Attachments, *cur)
+		}
+		cur, title = nil, ""
+	}
+	for p := 6; p+9 <= len(data); {
+		level := data[p]
+		id := binary.LittleEndian.Uint32(data[p+1:]) & 0xffff
+		n := int(binary.LittleEndian.Uint32(data[p+5:]))
+		p += 9
+		if n < 0 || p+n+2 > len(data) {
+			break
+		}
+		val := data[p : p+n]
+		p += n + 2 // 跳过校验和
+		switch {
+		case id == attOemCodepage && len(val) >= 4:
+			codepage = int(binary.LittleEndian.Uint32(val))
+		case level == 1 && id == attSubject:
+			m.Subject = decodeCodepage(trimNUL(val), codepage)
+		case level == 1 && id == attBody:
+			m.Text = decodeCodepage(trimNUL(val), codepage)
+		case level == 1 && id == attMAPIProps:
+			props := parseMAPIProps(val)
+			if v, ok := props[prInternetCodepage]; ok && len(v.data) >= 4 {
+				codepage = int(binary.LittleEndian.Uint32(v.data))
+			}
+			if v, ok := props[prBody]; ok && m.Text == "" {
+				m.Text = mapiString(v, codepage)
+			}
+			if v, ok := props[prBodyHTML]; ok {
+				m.HTML = mapiString(v, codepage)
+			}
+			if v, ok := props[prRTFCompressed]; ok {
+				rtf = v.data
+			}
+		case level == 2 && id == attAttachRenddat:
+			finish()
+			cur = &tnefAttachment{}
+		case level == 2 && cur != nil && id == attAttachTitle:
+			title = decodeCodepage(trimNUL(val), codepage)
+		case level == 2 && cur != nil && id == attAttachData:
+			cur.Data = val
+		case level == 2 && cur != nil && id == attAttachment:
+			props := parseMAPIProps(val)
+			for _, pid := range []uint16{prAttachLongName, prDisplayName, prAttachFilename} {
+				if v, ok := props[pid]; ok {
+					if s := mapiString(v, codepage); s != "" {
+						cur.Filename = s
+						break
+					}
+				}
+			}
+			if v, ok := props[prAttachMimeTag]; ok {
+				cur.ContentType = strings.ToLower(mapiString(v, codepage))
+			}
+			if v, ok := props[prAttachContentID]; ok {
+				cur.ContentID = strings.Trim(mapiString(v, codepage), "<>")
+			}
+			if v, ok := props[prAttachDataBin]; ok && v.typ == ptBinary && cur.Data == nil {
+				cur.Data = v.data
+			}
+		}
+	}
+	finish()
+	if m.HTML == "" && rtf != nil {
+		if raw, err := decompressRTF(rtf); err == nil {
+			if text, isHTML := decodeRTF(raw); isHTML {
+				m.HTML = text
+			} else {
+				m.RTFText = text
+			}
+		}
+	}
+	return m, nil
+}
+
+// parseMAPIProps 解析 MAPI 属性序列，按属性 ID 返回首个值；命名属性（ID >= 0x8000）跳过
+func parseMAPIProps(b []byte) map[uint16]mapiValue {
+	props := make(map[uint16]mapiValue)
+	if len(b) < 4 {
+		return props
+	}
+	count := int(binary.LittleEndian.Uint32(b))
+	p := 4
+	u32 := func() (int, bool) {
+		if p+4 > len(b) {
+			return 0, false
+		}
+		v := int(binary.LittleEndian.Uint32(b[p:]))
+		p += 4
+		return v, v >= 0
+	}
+	for i := 0; i < count && p+4 <= len(b); i++ {
+		typ := binary.LittleEndian.Uint16(b[p:])
+		id := binary.LittleEndian.Uint16(b[p+2:])
+		p += 4
+		if id >= 0x8000 { // 命名属性：GUID + 数字 ID 或 UTF-16 名称
+			p += 16
+			kind, ok := u32()
+			if !ok {
+				return props
+			}
+			if kind == 0 {
+				p += 4
+			} else {
+				n, ok := u32()
+				if !ok {
+					return props
+				}
+				p += pad4(n)
+			}
+		}
+		values := 1
+		base := typ &^ mvFlag
+		if typ&mvFlag != 0 || base == ptString8 || base == ptUnicode || base == ptBinary || base == ptObject {
+			n, ok := u32()
+			if !ok {
+				return props
+			}
+			values = n
+		}
+		for v := 0; v < values; v++ {
+			var data []byte
+			switch base {
+			case ptString8, ptUnicode, ptBinary, ptObject:
+				n, ok := u32()
+				if !ok || p+n > len(b) {
+					return props
+				}
+				data = b[p : p+n]
+				p += pad4(n)
+			default:
+				size := mapiFixedSize(base)
+				if p+size > len(b) {
+					return props
+				}
+				data = b[p : p+size]
+				p += pad4(size)
+			}
+			if v == 0 {
+				if _, dup := props[id]; !dup && id < 0x8000 {
+					props[id] = mapiValue{typ: base, data: data}
+				}
+			}
+		}
+	}
+	return props
+}
+
+func mapiFixedSize(typ uint16) int {
+	switch typ {
+	case ptShort, ptBoolean, ptLong, ptFloat, ptError:
+		return 4
+	case ptDouble, ptCurr, ptAppTime, ptI8, ptSysTime:
+		return 8
+	case ptCLSID:
+		return 16
+	}
+	return 4
+}
+
+func pad4(n int) int {
+	return (n + 3) &^ 3
+}
+
+// mapiString 字符串属性：PT_UNICODE 为 UTF-16LE，PT_STRING8 / PT_BINARY 按代码页解码
+func mapiString(v mapiValue, codepage int) string {
+	if v.typ == ptUnicode {
+		u := make([]uint16, len(v.data)/2)
+		for i := range u {
+			u[i] = binary.LittleEndian.Uint16(v.data[2*i:])
+		}
+		return strings.TrimRight(string(utf16.Decode(u)), "\x00")
+	}
+	return decodeCodepage(trimNUL(v.data), codepage)
+}
+
+func decodeCodepage(b []byte, codepage int) string {
+	if s, ok := decodeWith(codepageCharset(codepage), b); ok {
+		return s
+	}
+	return string(b)
+}
+
+func trimNUL(b []byte) []byte {
+	for len(b) > 0 && b[len(b)-1] == 0 {
+		b = b[:len(b)-1]
+	}
+	return b
+}
+
+// expandTNEF 将 winmail.dat part 替换为其中的正文与附件 part（Container=tnef，Path 沿用 winmail.dat 的编号）；
+// 解码失败或没有任何内容时保留原 part。
+func expandTNEF(parts []mimePart) []mimePart {
+	var out []mimePart
+	for i := range parts {
+		p := parts[i]
+		if !isTNEF(&p) {
+			out = append(out, p)
+			continue
+		}
+		m, err := decodeTNEF(p.Body)
+		if err != nil {
+			out = append(out, p)
+			continue
+		}
+		var expanded []mimePart
+		utf8Params := map[string]string{"charset": "utf-8"}
+		if text := m.Text; text != "" || m.RTFText != "" {
+			if text == "" {
+				text = m.RTFText
+			}
+			expanded = append(expanded, mimePart{Path: p.Path, MediaType: "text/plain", Params: utf8Params, Container: "tnef", Body: []byte(text)})
+		}
+		if m.HTML != "" {
+			expanded = append(expanded, mimePart{Path: p.Path, MediaType: "text/html", Params: utf8Params, Container: "tnef", Body: []byte(m.HTML)})
+		}
+		for _, a := range m.Attachments {
+			ct := a.ContentType
+			if ct == "" {
+				ct, _, _ = strings.Cut(mime.TypeByExtension(strings.ToLower(path.Ext(a.Filename))), ";")
+			}
+			if ct == "" {
+				ct = "application/octet-stream"
+			}
+			disp := "attachment"
+			if a.ContentID != "" {
+				disp = "inline"
+			}
+			name := a.Filename
+			if name == "" {
+				name = "attachment"
+			}
+			expanded = append(expanded, mimePart{
+				Path:        p.Path,
+				MediaType:   ct,
+				Params:      map[string]string{},
+				Disposition: disp,
+				DispParams:  map[string]string{"filename": name},
+				ContentID:   a.ContentID,
+				Container:   "tnef",
+				Body:        a.Data,
+			})
+		}
+		if len(expanded) == 0 {
+			out = append(out, p)
+			continue
+		}
+		out = append(out, expanded...)
+	}
+	return out
+}
@@ -0,0 +1,142 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"strings"
+	"testing"
+	"unicode/utf16"
+
+	"monitor-imap-webhook/internal/config"
+)
+
+// tnefWriter 构造测试用 TNEF 流
+type tnefWriter struct{ bytes.Buffer }
+
+func newTNEFWriter() *tnefWriter {
+	w := &tnefWriter{}
+	binary.Write(w, binary.LittleEndian, uint32(tnefSignature))
+	binary.Write(w, binary.LittleEndian, uint16(0x0001))
+	return w
+}
+
+func (w *tnefWriter) attr(level byte, id uint32, data []byte) {
+	w.WriteByte(level)
+	binary.Write(w, binary.LittleEndian, id)
+	binary.Write(w, binary.LittleEndian, uint32(len(data)))
+	w.Write(data)
+	var sum uint16
+	for _, b := range data {
+		sum += uint16(b)
+	}
+	binary.Write(w, binary.LittleEndian, sum)
+}
+
+type mapiProp struct {
+	typ, id uint16
+	data    []byte
+}
+
+func mapiProps(props ...mapiProp) []byte {
+	var b bytes.Buffer
+	binary.Write(&b, binary.LittleEndian, uint32(len(props)))
+	for _, p := range props {
+		binary.Write(&b, binary.LittleEndian, p.typ)
+		binary.Write(&b, binary.LittleEndian, p.id)
+		if p.id >= 0x8000 { // 命名属性：GUID + 数字 ID
+			b.Write(make([]byte, 16))
+			binary.Write(&b, binary.LittleEndian, uint64(0x8233)<<32)
+		}
+		if p.typ == ptLong {
+			b.Write(p.data)
+			continue
+		}
+		binary.Write(&b, binary.LittleEndian, uint32(1))
+		binary.Write(&b, binary.LittleEndian, uint32(len(p.data)))
+		b.Write(p.data)
+		b.Write(make([]byte, pad4(len(p.data))-len(p.data)))
+	}
+	return b.Bytes()
+}
+
+func utf16LE(s string) []byte {
+	var b bytes.Buffer
+	for _, u := range utf16.Encode([]rune(s + "\x00")) {
+		binary.Write(&b, binary.LittleEndian, u)
+	}
+	return b.Bytes()
+}
+
+func buildTestTNEF() []byte {
+	w := newTNEFWriter()
+	w.attr(1, 0x00069007, []byte{0xa8, 0x03, 0, 0, 0, 0, 0, 0}) // 代码页 936
+	w.attr(1, 0x00018004, []byte("\xd6\xdc\xb1\xa8\x00"))       // GBK "周报"
+	w.attr(1, 0x00069003, mapiProps(
+		mapiProp{typ: ptLong, id: 0x8005, data: []byte{1, 0, 0, 0}},
+		mapiProp{typ: ptBinary, id: prBodyHTML, data: []byte("<html><body><p>\xc4\xe3\xba\xc3 <b>TNEF</b></p></body></html>")},
+		mapiProp{typ: ptLong, id: prInternetCodepage, data: []byte{0xa8, 0x03, 0, 0}},
+	))
+	// 附件 1：文件名只在 attAttachTitle，内容在 attAttachData
+	w.attr(2, 0x00069002, make([]byte, 14))
+	w.attr(2, 0x00018010, []byte("REPORT~1.PDF\x00"))
+	w.attr(2, 0x0006800f, []byte("%PDF-1.4"))
+	w.attr(2, 0x00069005, mapiProps(mapiProp{typ: ptUnicode, id: prAttachLongName, data: utf16LE("季度报告.pdf")}))
+	// 附件 2：内嵌图片，带 MIME 类型与 Content-ID
+	w.attr(2, 0x00069002, make([]byte, 14))
+	w.attr(2, 0x0006800f, []byte("\x89PNG"))
+	w.attr(2, 0x00069005, mapiProps(
+		mapiProp{typ: ptString8, id: prAttachLongName, data: []byte("logo.png\x00")},
+		mapiProp{typ: ptString8, id: prAttachMimeTag, data: []byte("image/png\x00")},
+		mapiProp{typ: ptString8, id: prAttachContentID, data: []byte("logo@01D\x00")},
+	))
+	return w.Bytes()
+}
+
+func TestDecodeTNEF(t *testing.T) {
+	m, err := decodeTNEF(buildTestTNEF())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Subject != "周报" || !strings.Contains(m.HTML, "<p>你好 <b>TNEF</b></p>") {
+		t.Fatalf("subject=%q html=%q", m.Subject, m.HTML)
+	}
+	if len(m.Attachments) != 2 {
+		t.Fatalf("attachments=%+v", m.Attachments)
+	}
+	if a := m.Attachments[0]; a.Filename != "季度报告.pdf" || string(a.Data) != "%PDF-1.4" {
+		t.Fatalf("att0=%+v", a)
+	}
+	if a := m.Attachments[1]; a.Filename != "logo.png" || a.ContentType != "image/png" || a.ContentID != "logo@01D" {
+		t.Fatalf("att1=%+v", a)
+	}
+	if _, err := decodeTNEF([]byte("not tnef")); err == nil {
+		t.Fatal("expected signature error")
+	}
+}
+
+func TestParseTNEFMessage(t *testing.T) {
+	b64 := base64.StdEncoding.EncodeToString(buildTestTNEF())
+	raw := "From: a@example.com\r\nSubject: weekly\r\n" +
+		"Content-Type: multipart/mixed; boundary=b\r\n\r\n" +
+		"--b\r\nContent-Type: application/ms-tnef; name=winmail.dat\r\n" +
+		"Content-Disposition: attachment; filename=winmail.dat\r\nContent-Transfer-Encoding: base64\r\n\r\n" + b64 + "\r\n" +
+		"--b--\r\n"
+	msg, err := parseRaw([]byte(raw), nil, &config.Config{HTMLToTextMode: "simple"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Body != "你好 TNEF" {
+		t.Fatalf("body=%q", msg.Body)
+	}
+	if len(msg.AttachmentNames) != 2 || msg.AttachmentNames[0] != "季度报告.pdf" || msg.AttachmentNames[1] != "logo.png" {
+		t.Fatalf("names=%v", msg.AttachmentNames)
+	}
+	a := msg.Attachments[0]
+	if a.ContentType != "application/pdf" || a.Container != "tnef" || a.PartPath != "1" || a.Disposition != "attachment" {
+		t.Fatalf("att=%+v", a)
+	}
+	if msg.Attachments[1].Disposition != "inline" {
+		t.Fatalf("att1=%+v", msg.Attachments[1])
+	}
+}
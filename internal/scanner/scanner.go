@@ -0,0 +1,182 @@
+// Package scanner 将附件内容交给 clamd（ClamAV 守护进程）以 INSTREAM 协议扫描。
+package scanner
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+// 扫描结论
+const (
+	StatusClean    = "clean"
+	StatusInfected = "infected"
+	StatusError    = "error"
+)
+
+// Verdict 单个附件的扫描结果
+type Verdict struct {
+	Status    string `json:"status"`              // clean | infected | error
+	Signature string `json:"signature,omitempty"` // 病毒特征名（infected）
+	Error     string `json:"error,omitempty"`     // 扫描失败原因（error）
+}
+
+// Summary 一封邮件的扫描汇总
+type Summary struct {
+	Scanned  int      `json:"scanned"`            // 已扫描的附件数
+	Infected []string `json:"infected,omitempty"` // 感染附件的文件名
+	Errors   int      `json:"errors,omitempty"`   // 扫描失败的附件数（strip 时不投递内容）
+	Action   string   `json:"action"`             // 对感染附件的处理：annotate | strip
+}
+
+// Scanner 扫描一段内容
+type Scanner interface {
+	Scan(ctx context.Context, r io.Reader) Verdict
+}
+
+// chunkSize INSTREAM 每个数据块的大小
+const chunkSize = 64 * 1024
+
+// Clamd 通过 unix socket 或 TCP 连接 clamd，每次扫描使用独立连接
+type Clamd struct {
+	network, addr string
+	timeout       time.Duration
+}
+
+// NewClamd 解析地址："unix:/run/clamav/clamd.ctl"、"/run/clamav/clamd.ctl"、"tcp:127.0.0.1:3310" 或 "127.0.0.1:3310"
+func NewClamd(address string, timeout time.Duration) (*Clamd, error) {
+	address = strings.TrimSpace(address)
+	c := &Clamd{network: "tcp", addr: address, timeout: timeout}
+	switch {
+	case strings.HasPrefix(address, "unix:"):
+		c.network, c.addr = "unix", strings.TrimPrefix(strings.TrimPrefix(address, "unix:"), "//")
+	case strings.HasPrefix(address, "/"):
+		c.network = "unix"
+	case strings.HasPrefix(address, "tcp:"):
+		c.addr = strings.TrimPrefix(strings.TrimPrefix(address, "tcp:"), "//")
+	}
+	if c.addr == "" {
+		return nil, errors.New("clamd: empty address")
+	}
+	if c.timeout <= 0 {
+		c.timeout = 30 * time.Second
+	}
+	return c, nil
+}
+
+// dial 建立连接；连接与整次扫描共用 timeout（ctx 的截止时间更早时以 ctx 为准）
+func (c *Clamd) dial(ctx context.Context) (net.Conn, error) {
+	deadline := time.Now().Add(c.timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	dialCtx, cancel := context.WithDeadline(ctx, deadline)
+	defer cancel()
+	var d net.Dialer
+	conn, err := d.DialContext(dialCtx, c.network, c.addr)
+	if err != nil {
+		return nil, err
+	}
+	conn.SetDeadline(deadline)
+	return conn, nil
+}
+
+// Ping 检查 clamd 是否可用
+func (c *Clamd) Ping(ctx context.Context) error {
+	conn, err := c.dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte("zPING\x00")); err != nil {
+		return err
+	}
+	reply, err := readReply(conn)
+	if err != nil {
+		return err
+	}
+	if reply != "PONG" {
+		return fmt.Errorf("clamd: unexpected reply %q", reply)
+	}
+	return nil
+}
+
+// Scan 以 INSTREAM 发送内容：每块为 4 字节大端长度 + 数据，长度 0 表示结束
+func (c *Clamd) Scan(ctx context.Context, r io.Reader) Verdict {
+	conn, err := c.dial(ctx)
+	if err != nil {
+		return Verdict{Status: StatusError, Error: err.Error()}
+	}
+	defer conn.Close()
+	if err := writeStream(conn, r); err != nil {
+		// clamd 超过 StreamMaxLength 时会提前回复并断开，优先返回其回复
+		if reply, rerr := readReply(conn); rerr == nil && reply != "" {
+			return parseReply(reply)
+		}
+		return Verdict{Status: StatusError, Error: err.Error()}
+	}
+	reply, err := readReply(conn)
+	if err != nil {
+		return Verdict{Status: StatusError, Error: err.Error()}
+	}
+	return parseReply(reply)
+}
+
+func writeStream(w io.Writer, r io.Reader) error {
+	bw := bufio.NewWriterSize(w, chunkSize+4)
+	if _, err := bw.WriteString("zINSTREAM\x00"); err != nil {
+		return err
+	}
+	buf := make([]byte, chunkSize)
+	var size [4]byte
+	for {
+		n, err := io.ReadFull(r, buf)
+		if n > 0 {
+			binary.BigEndian.PutUint32(size[:], uint32(n))
+			bw.Write(size[:])
+			if _, werr := bw.Write(buf[:n]); werr != nil {
+				return werr
+			}
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	binary.BigEndian.PutUint32(size[:], 0)
+	bw.Write(size[:])
+	return bw.Flush()
+}
+
+// readReply 读取以 NUL 结尾的回复
+func readReply(r io.Reader) (string, error) {
+	b, err := bufio.NewReader(r).ReadBytes(0)
+	if err != nil && !(err == io.EOF && len(b) > 0) {
+		return "", err
+	}
+	return strings.TrimSpace(string(bytes.TrimRight(b, "\x00"))), nil
+}
+
+// parseReply 解析 "stream: OK"、"stream: Eicar-Signature FOUND"、"INSTREAM size limit exceeded. ERROR"
+func parseReply(reply string) Verdict {
+	_, result, ok := strings.Cut(reply, ": ")
+	if !ok {
+		result = reply
+	}
+	switch {
+	case result == "OK":
+		return Verdict{Status: StatusClean}
+	case strings.HasSuffix(result, " FOUND"):
+		return Verdict{Status: StatusInfected, Signature: strings.TrimSuffix(result, " FOUND")}
+	}
+	return Verdict{Status: StatusError, Error: strings.TrimSuffix(reply, " ERROR")}
+}
@@ -0,0 +1,132 @@
+package scanner
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeStreamMax 模拟 clamd 的 StreamMaxLength
+const fakeStreamMax = 256 * 1024
+
+// fakeClamd 模拟 clamd：PING 回复 PONG，INSTREAM 内容包含 "EICAR" 时报告感染，超过 fakeStreamMax 时回复 ERROR
+func fakeClamd(t *testing.T, network, addr string) (string, *[]int) {
+	t.Helper()
+	ln, err := net.Listen(network, addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	var chunks []int
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			r := bufio.NewReader(conn)
+			cmd, _ := r.ReadString(0)
+			switch cmd {
+			case "zPING\x00":
+				conn.Write([]byte("PONG\x00"))
+			case "zINSTREAM\x00":
+				var body bytes.Buffer
+				var size [4]byte
+				for {
+					if _, err := io.ReadFull(r, size[:]); err != nil {
+						break
+					}
+					n := binary.BigEndian.Uint32(size[:])
+					if n == 0 {
+						break
+					}
+					chunks = append(chunks, int(n))
+					io.CopyN(&body, r, int64(n))
+				}
+				switch {
+				case body.Len() > fakeStreamMax:
+					conn.Write([]byte("INSTREAM size limit exceeded. ERROR\x00"))
+				case bytes.Contains(body.Bytes(), []byte("EICAR")):
+					conn.Write([]byte("stream: Eicar-Test-Signature FOUND\x00"))
+				default:
+					conn.Write([]byte("stream: OK\x00"))
+				}
+			default:
+				conn.Write([]byte("UNKNOWN COMMAND\x00"))
+			}
+			conn.Close()
+		}
+	}()
+	return ln.Addr().String(), &chunks
+}
+
+func TestClamdUnix(t *testing.T) {
+	sock := filepath.Join(t.TempDir(), "clamd.sock")
+	fakeClamd(t, "unix", sock)
+	c, err := NewClamd("unix:"+sock, time.Second)
+	if err != nil || c.network != "unix" || c.addr != sock {
+		t.Fatalf("clamd=%+v err=%v", c, err)
+	}
+	ctx := context.Background()
+	if err := c.Ping(ctx); err != nil {
+		t.Fatalf("ping: %v", err)
+	}
+	if v := c.Scan(ctx, strings.NewReader("hello")); v.Status != StatusClean {
+		t.Fatalf("clean=%+v", v)
+	}
+	v := c.Scan(ctx, strings.NewReader("X5O!P%@AP EICAR"))
+	if v.Status != StatusInfected || v.Signature != "Eicar-Test-Signature" {
+		t.Fatalf("infected=%+v", v)
+	}
+}
+
+func TestClamdTCPChunks(t *testing.T) {
+	addr, chunks := fakeClamd(t, "tcp", "127.0.0.1:0")
+	c, _ := NewClamd("tcp:"+addr, time.Second)
+	if v := c.Scan(context.Background(), bytes.NewReader(make([]byte, chunkSize+10))); v.Status != StatusClean {
+		t.Fatalf("v=%+v", v)
+	}
+	if len(*chunks) != 2 || (*chunks)[0] != chunkSize || (*chunks)[1] != 10 {
+		t.Fatalf("chunks=%v", *chunks)
+	}
+}
+
+func TestClamdUnavailable(t *testing.T) {
+	c, _ := NewClamd(filepath.Join(t.TempDir(), "missing.sock"), time.Second)
+	if v := c.Scan(context.Background(), strings.NewReader("x")); v.Status != StatusError || v.Error == "" {
+		t.Fatalf("v=%+v", v)
+	}
+	if _, err := NewClamd("  ", 0); err == nil {
+		t.Fatal("empty address should fail")
+	}
+}
+
+func TestParseReply(t *testing.T) {
+	for reply, want := range map[string]Verdict{
+		"stream: OK":                          {Status: StatusClean},
+		"stream: Win.Trojan.Agent-1 FOUND":    {Status: StatusInfected, Signature: "Win.Trojan.Agent-1"},
+		"INSTREAM size limit exceeded. ERROR": {Status: StatusError, Error: "INSTREAM size limit exceeded."},
+	} {
+		if got := parseReply(reply); got != want {
+			t.Errorf("%q: got %+v", reply, got)
+		}
+	}
+}
+
+func TestClamdSizeLimitError(t *testing.T) {
+	addr, _ := fakeClamd(t, "tcp", "127.0.0.1:0")
+	c, _ := NewClamd(addr, time.Second)
+	// 超过 StreamMaxLength 的附件（可能藏有恶意内容）必须报告为 error 而不是 clean
+	data := append(make([]byte, fakeStreamMax), []byte("EICAR")...)
+	v := c.Scan(context.Background(), bytes.NewReader(data))
+	if v.Status != StatusError || v.Error != "INSTREAM size limit exceeded." {
+		t.Fatalf("v=%+v", v)
+	}
+}
@@ -0,0 +1,122 @@
+package storage
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// downloadPrefix 下载端点路径前缀：/attachments/<key>?name=..&type=..&exp=..&sig=..
+const downloadPrefix = "/attachments/"
+
+// Signer 生成与校验带过期时间的 HMAC-SHA256 下载链接。
+type Signer struct {
+	secret  []byte
+	baseURL string
+	ttl     time.Duration
+	now     func() time.Time
+}
+
+// NewSigner 创建签名器；baseURL 为外部可访问的下载服务地址（如 https://mail-files.example.com）。
+func NewSigner(secret, baseURL string, ttl time.Duration) *Signer {
+	return &Signer{secret: []byte(secret), baseURL: strings.TrimSuffix(baseURL, "/"), ttl: ttl, now: time.Now}
+}
+
+func (s *Signer) mac(key, name, contentType string, exp int64) string {
+	m := hmac.New(sha256.New, s.secret)
+	fmt.Fprintf(m, "%s\n%s\n%s\n%d", key, name, contentType, exp)
+	return hex.EncodeToString(m.Sum(nil))
+}
+
+// URL 返回签名下载链接及其过期时间（unix 秒）。
+func (s *Signer) URL(key, name, contentType string) (string, int64) {
+	exp := s.now().Add(s.ttl).Unix()
+	q := url.Values{}
+	q.Set("name", name)
+	q.Set("type", contentType)
+	q.Set("exp", strconv.FormatInt(exp, 10))
+	q.Set("sig", s.mac(key, name, contentType, exp))
+	return s.baseURL + downloadPrefix + key + "?" + q.Encode(), exp
+}
+
+// 校验失败原因
+var (
+	errBadSignature = errors.New("invalid signature")
+	errExpired      = errors.New("link expired")
+)
+
+// Verify 校验链接参数
+func (s *Signer) Verify(key string, q url.Values) error {
+	exp, err := strconv.ParseInt(q.Get("exp"), 10, 64)
+	if err != nil {
+		return errBadSignature
+	}
+	want := s.mac(key, q.Get("name"), q.Get("type"), exp)
+	if !hmac.Equal([]byte(want), []byte(q.Get("sig"))) {
+		return errBadSignature
+	}
+	if s.now().Unix() > exp {
+		return errExpired
+	}
+	return nil
+}
+
+// Handler 返回下载端点：校验签名与过期时间后从 Store 流式输出内容。
+func Handler(st Store, signer *Signer) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(downloadPrefix, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		key := strings.TrimPrefix(r.URL.Path, downloadPrefix)
+		if !validKey(key) {
+			http.NotFound(w, r)
+			return
+		}
+		q := r.URL.Query()
+		if err := signer.Verify(key, q); err != nil {
+			status := http.StatusForbidden
+			if errors.Is(err, errExpired) {
+				status = http.StatusGone
+			}
+			http.Error(w, err.Error(), status)
+			return
+		}
+		rc, err := st.Open(r.Context(), key)
+		if errors.Is(err, ErrNotFound) {
+			http.NotFound(w, r)
+			return
+		}
+		if err != nil {
+			log.Printf("storage open key=%s err=%v", key, err)
+			http.Error(w, "storage error", http.StatusBadGateway)
+			return
+		}
+		defer rc.Close()
+		ct := q.Get("type")
+		if ct == "" {
+			ct = "application/octet-stream"
+		}
+		w.Header().Set("Content-Type", ct)
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		if name := q.Get("name"); name != "" {
+			w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name}))
+		}
+		if r.Method == http.MethodHead {
+			return
+		}
+		_, _ = io.Copy(w, rc)
+	})
+	return mux
+}
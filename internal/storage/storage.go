@@ -0,0 +1,95 @@
+// Package storage 保存附件内容（内容寻址），并通过带 HMAC 签名、可过期的下载链接对外提供。
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log"
+	"time"
+)
+
+// ErrNotFound 对象不存在
+var ErrNotFound = errors.New("storage: object not found")
+
+// Object 存储中的一个对象
+type Object struct {
+	Key     string
+	Size    int64
+	ModTime time.Time
+}
+
+// Store 内容寻址的附件存储。Key 为内容的 SHA-256（hex），相同内容只保存一份。
+type Store interface {
+	// Put 保存内容；对象已存在时仅刷新修改时间（延长保留期）。
+	Put(ctx context.Context, key string, data []byte) error
+	Open(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+	List(ctx context.Context) ([]Object, error)
+}
+
+// ContentKey 计算内容寻址 Key
+func ContentKey(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// validKey 仅接受 64 位小写 hex，避免路径穿越
+func validKey(key string) bool {
+	if len(key) != sha256.Size*2 {
+		return false
+	}
+	for i := 0; i < len(key); i++ {
+		c := key[i]
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// Cleanup 删除修改时间早于 retention 的对象，返回删除数量。
+func Cleanup(ctx context.Context, st Store, retention time.Duration) (int, error) {
+	objs, err := st.List(ctx)
+	if err != nil {
+		return 0, err
+	}
+	cutoff := time.Now().Add(-retention)
+	removed := 0
+	for _, o := range objs {
+		if o.ModTime.After(cutoff) {
+			continue
+		}
+		if err := st.Delete(ctx, o.Key); err != nil && !errors.Is(err, ErrNotFound) {
+			return removed, err
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+// RunJanitor 周期性执行 Cleanup，直到 ctx 结束。
+func RunJanitor(ctx context.Context, st Store, retention, interval time.Duration) {
+	if retention <= 0 {
+		return
+	}
+	if interval <= 0 {
+		interval = time.Hour
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if n, err := Cleanup(ctx, st, retention); err != nil {
+			log.Printf("storage cleanup error: %v", err)
+		} else if n > 0 {
+			log.Printf("storage cleanup removed=%d", n)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
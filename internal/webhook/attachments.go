@@ -0,0 +1,265 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"mime/multipart"
+	"net/textproto"
+	"path"
+	"strings"
+
+	"monitor-imap-webhook/internal/config"
+	"monitor-imap-webhook/internal/parser"
+	"monitor-imap-webhook/internal/scanner"
+	"monitor-imap-webhook/internal/storage"
+)
+
+// AttachmentDetail 为 payload 中的单个附件条目：元数据 + 投递结果。
+type AttachmentDetail struct {
+	parser.Attachment
+	Delivery      string           `json:"delivery,omitempty"`       // inline | multipart | store | skipped
+	ContentBase64 string           `json:"content_base64,omitempty"` // inline 模式下的 base64 内容
+	FormField     string           `json:"form_field,omitempty"`     // multipart 模式下对应的表单文件字段名
+	StorageKey    string           `json:"storage_key,omitempty"`    // store 模式下的存储 Key（内容 SHA-256）
+	URL           string           `json:"url,omitempty"`            // store 模式下的签名下载链接
+	URLExpires    int64            `json:"url_expires,omitempty"`    // 下载链接过期时间（unix 秒）
+	SkipReason    string           `json:"skip_reason,omitempty"`    // 未投递内容的原因
+	Scan          *scanner.Verdict `json:"scan,omitempty"`           // clamd 扫描结果（配置 clamd_address 时）
+}
+
+// NewAttachmentDetails 由解析结果生成 payload 附件条目（尚未决定投递方式）。
+func NewAttachmentDetails(atts []parser.Attachment) []AttachmentDetail {
+	if len(atts) == 0 {
+		return nil
+	}
+	out := make([]AttachmentDetail, len(atts))
+	for i, a := range atts {
+		out[i] = AttachmentDetail{Attachment: a}
+	}
+	return out
+}
+
+// ScanAttachments 逐个扫描附件内容，结果写入 details[].Scan；扫描失败计入 Errors（strip / quarantine 时同样不投递内容）。
+func ScanAttachments(ctx context.Context, sc scanner.Scanner, details []AttachmentDetail, policy string) *scanner.Summary {
+	if policy == "quarantine" { // 隔离失败时退回 strip，payload 中不会出现 quarantine
+		policy = "strip"
+	}
+	sum := &scanner.Summary{Action: policy}
+	for i := range details {
+		d := &details[i]
+		v := sc.Scan(ctx, bytes.NewReader(d.Data))
+		d.Scan = &v
+		sum.Scanned++
+		switch v.Status {
+		case scanner.StatusInfected:
+			sum.Infected = append(sum.Infected, d.Filename)
+		case scanner.StatusError:
+			sum.Errors++
+			log.Printf("attachment scan part=%s err=%s", d.PartPath, v.Error)
+		}
+	}
+	return sum
+}
+
+// 附件投递方式与跳过原因
+const (
+	skipDeniedType    = "type_denied"
+	skipDeniedExt     = "extension_denied"
+	skipInlineLimit   = "exceeds_inline_limit"
+	skipTotalLimit    = "exceeds_total_limit"
+	skipStoreFailed   = "store_failed"
+	skipInfected      = "infected"
+	skipScanFailed    = "scan_failed"
+	deliveryInline    = "inline"
+	deliveryMultipart = "multipart"
+	deliveryStore     = "store"
+	deliverySkipped   = "skipped"
+)
+
+// attachmentPolicy 基于配置决定附件内容能否随 webhook 投递
+type attachmentPolicy struct {
+	mode       string
+	inlineMax  int
+	totalMax   int
+	allowTypes []string
+	denyTypes  []string
+	allowExt   []string
+	denyExt    []string
+	strip      bool // scan_policy 不是 annotate 时不投递感染或扫描失败附件的内容
+	store      storage.Store
+	signer     *storage.Signer
+}
+
+func newAttachmentPolicy(cfg *config.Config) attachmentPolicy {
+	return attachmentPolicy{
+		mode:       cfg.AttachmentDelivery,
+		inlineMax:  cfg.AttachmentInlineMax,
+		totalMax:   cfg.AttachmentMaxTotal,
+		allowTypes: splitList(cfg.AttachmentAllowTypes, false),
+		denyTypes:  splitList(cfg.AttachmentDenyTypes, false),
+		allowExt:   splitList(cfg.AttachmentAllowExt, true),
+		denyExt:    splitList(cfg.AttachmentDenyExt, true),
+		strip:      cfg.ScanPolicy != "" && cfg.ScanPolicy != "annotate",
+	}
+}
+
+// splitList 拆分逗号分隔列表并小写；ext=true 时统一补齐前导点
+func splitList(raw string, ext bool) []string {
+	var out []string
+	for _, v := range strings.Split(raw, ",") {
+		v = strings.ToLower(strings.TrimSpace(v))
+		if v == "" {
+			continue
+		}
+		if ext && !strings.HasPrefix(v, ".") {
+			v = "." + v
+		}
+		out = append(out, v)
+	}
+	return out
+}
+
+func matchType(patterns []string, ct string) bool {
+	ct = strings.ToLower(ct)
+	for _, p := range patterns {
+		if p == ct || p == "*/*" {
+			return true
+		}
+		if strings.HasSuffix(p, "/*") && strings.HasPrefix(ct, strings.TrimSuffix(p, "*")) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchExt(exts []string, filename string) bool {
+	ext := strings.ToLower(path.Ext(filename))
+	for _, e := range exts {
+		if e == ext {
+			return true
+		}
+	}
+	return false
+}
+
+// check 返回空字符串表示类型/扩展名允许投递，否则为跳过原因
+func (p attachmentPolicy) check(a parser.Attachment) string {
+	if matchType(p.denyTypes, a.ContentType) || (len(p.allowTypes) > 0 && !matchType(p.allowTypes, a.ContentType)) {
+		return skipDeniedType
+	}
+	if matchExt(p.denyExt, a.Filename) || (len(p.allowExt) > 0 && !matchExt(p.allowExt, a.Filename)) {
+		return skipDeniedExt
+	}
+	return ""
+}
+
+// apply 按投递方式填充附件条目，返回需要作为 multipart 文件上传的条目下标。
+func (p attachmentPolicy) apply(ctx context.Context, details []AttachmentDetail) []int {
+	if p.mode != deliveryInline && p.mode != deliveryMultipart && p.mode != deliveryStore {
+		return nil
+	}
+	var files []int
+	total := 0
+	for i := range details {
+		d := &details[i]
+		reason := p.check(d.Attachment)
+		if p.strip && d.Scan != nil {
+			switch d.Scan.Status {
+			case scanner.StatusInfected:
+				reason = skipInfected
+			case scanner.StatusError: // 无法确认安全（clamd 不可达、超时、超过 StreamMaxLength）时不放行
+				reason = skipScanFailed
+			}
+		}
+		if reason == "" && p.mode == deliveryInline && p.inlineMax > 0 && d.Size > p.inlineMax {
+			reason = skipInlineLimit
+		}
+		if reason == "" && p.totalMax > 0 && total+d.Size > p.totalMax {
+			reason = skipTotalLimit
+		}
+		if reason != "" {
+			d.Delivery, d.SkipReason = deliverySkipped, reason
+			continue
+		}
+		switch p.mode {
+		case deliveryInline:
+			d.ContentBase64 = base64.StdEncoding.EncodeToString(d.Data)
+		case deliveryMultipart:
+			d.FormField = fmt.Sprintf("attachment_%d", i)
+			files = append(files, i)
+		case deliveryStore:
+			key := storage.ContentKey(d.Data)
+			if p.store == nil || p.signer == nil {
+				d.Delivery, d.SkipReason = deliverySkipped, skipStoreFailed
+				continue
+			}
+			if err := p.store.Put(ctx, key, d.Data); err != nil {
+				log.Printf("attachment store part=%s err=%v", d.PartPath, err)
+				d.Delivery, d.SkipReason = deliverySkipped, skipStoreFailed
+				continue
+			}
+			d.StorageKey = key
+			d.URL, d.URLExpires = p.signer.URL(key, d.Filename, d.ContentType)
+		}
+		total += d.Size
+		d.Delivery = p.mode
+	}
+	return files
+}
+
+// encodeBody 序列化 payload：默认 JSON；multipart 模式下为 multipart/form-data，
+// 字段 payload 为 JSON，每个附件为独立文件字段（字段名见 attachments_detail[].form_field）。
+func (s *Sender) encodeBody(p Payload) ([]byte, string, error) {
+	p.AttachmentsDetail = append([]AttachmentDetail(nil), p.AttachmentsDetail...)
+	policy := newAttachmentPolicy(s.cfg)
+	policy.store, policy.signer = s.store, s.signer
+	files := policy.apply(context.Background(), p.AttachmentsDetail)
+	data, err := json.Marshal(p)
+	if err != nil {
+		return nil, "", err
+	}
+	if s.cfg.AttachmentDelivery != deliveryMultipart {
+		return data, "application/json", nil
+	}
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	h := make(textproto.MIMEHeader)
+	h.Set("Content-Disposition", `form-data; name="payload"`)
+	h.Set("Content-Type", "application/json")
+	pw, err := mw.CreatePart(h)
+	if err != nil {
+		return nil, "", err
+	}
+	if _, err := pw.Write(data); err != nil {
+		return nil, "", err
+	}
+	for _, i := range files {
+		d := p.AttachmentsDetail[i]
+		fh := make(textproto.MIMEHeader)
+		fh.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"; filename="%s"`, escapeQuotes(d.FormField), escapeQuotes(d.Filename)))
+		fh.Set("Content-Type", d.ContentType)
+		fw, err := mw.CreatePart(fh)
+		if err != nil {
+			return nil, "", err
+		}
+		if _, err := fw.Write(d.Data); err != nil {
+			return nil, "", err
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return nil, "", err
+	}
+	return buf.Bytes(), mw.FormDataContentType(), nil
+}
+
+// quoteEscaper 同 mime/multipart：quoted-string 中只转义反斜杠与双引号，UTF-8 文件名原样发送（RFC 7578）；
+// CR / LF 替换为空格，避免文件名注入头部
+var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"", "\r", " ", "\n", " ")
+
+func escapeQuotes(s string) string {
+	return quoteEscaper.Replace(s)
+}
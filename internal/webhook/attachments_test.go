@@ -0,0 +1,214 @@
+package webhook
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"monitor-imap-webhook/internal/config"
+	"monitor-imap-webhook/internal/parser"
+	"monitor-imap-webhook/internal/scanner"
+	"monitor-imap-webhook/internal/storage"
+)
+
+func testAttachments() []parser.Attachment {
+	return []parser.Attachment{
+		{Filename: "invoice.pdf", ContentType: "application/pdf", Size: 4, PartPath: "2", Data: []byte("%PDF")},
+		{Filename: "setup.exe", ContentType: "application/octet-stream", Size: 2, PartPath: "3", Data: []byte("MZ")},
+		{Filename: "photo.jpg", ContentType: "image/jpeg", Size: 6, PartPath: "4", Data: []byte("abcdef")},
+	}
+}
+
+func TestInlineAttachmentDelivery(t *testing.T) {
+	cfg := &config.Config{AttachmentDelivery: "inline", AttachmentInlineMax: 5, AttachmentDenyExt: "exe"}
+	s := NewSender(cfg)
+	data, ct, err := s.encodeBody(Payload{AttachmentsDetail: NewAttachmentDetails(testAttachments())})
+	if err != nil || ct != "application/json" {
+		t.Fatalf("encode: %v %s", err, ct)
+	}
+	var got Payload
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	d := got.AttachmentsDetail
+	if d[0].Delivery != "inline" || d[0].ContentBase64 != base64.StdEncoding.EncodeToString([]byte("%PDF")) {
+		t.Errorf("pdf should be inlined: %+v", d[0])
+	}
+	if d[1].Delivery != "skipped" || d[1].SkipReason != skipDeniedExt {
+		t.Errorf("exe should be denied: %+v", d[1])
+	}
+	if d[2].Delivery != "skipped" || d[2].SkipReason != skipInlineLimit {
+		t.Errorf("photo should exceed inline limit: %+v", d[2])
+	}
+}
+
+func TestMultipartAttachmentDelivery(t *testing.T) {
+	type received struct {
+		payload Payload
+		files   map[string]string
+	}
+	ch := make(chan received, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mt, params, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if mt != "multipart/form-data" {
+			t.Errorf("content type = %s", mt)
+		}
+		rec := received{files: map[string]string{}}
+		mr := multipart.NewReader(r.Body, params["boundary"])
+		for {
+			p, err := mr.NextPart()
+			if err != nil {
+				break
+			}
+			b, _ := io.ReadAll(p)
+			if p.FormName() == "payload" {
+				_ = json.Unmarshal(b, &rec.payload)
+				continue
+			}
+			rec.files[p.FormName()+"/"+p.FileName()] = string(b)
+		}
+		ch <- rec
+	}))
+	defer srv.Close()
+
+	cfg := &config.Config{WebhookURL: srv.URL, AttachmentDelivery: "multipart", AttachmentAllowTypes: "application/pdf,image/*", AttachmentMaxTotal: 8}
+	s := NewSender(cfg)
+	if err := s.SendWithRetry(Payload{Subject: "files", AttachmentsDetail: NewAttachmentDetails(testAttachments())}); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	rec := <-ch
+	if rec.payload.Subject != "files" {
+		t.Errorf("payload field missing: %+v", rec.payload)
+	}
+	if len(rec.files) != 1 || rec.files["attachment_0/invoice.pdf"] != "%PDF" {
+		t.Errorf("unexpected files: %v", rec.files)
+	}
+	d := rec.payload.AttachmentsDetail
+	if d[0].FormField != "attachment_0" || d[1].SkipReason != skipDeniedType || d[2].SkipReason != skipTotalLimit {
+		t.Errorf("unexpected details: %+v", d)
+	}
+}
+
+func TestMultipartFilenameQuoting(t *testing.T) {
+	cfg := &config.Config{AttachmentDelivery: "multipart"}
+	atts := []parser.Attachment{
+		{Filename: "发票 2024.pdf", ContentType: "application/pdf", Size: 1, PartPath: "2", Data: []byte("a")},
+		{Filename: `say "hi".txt`, ContentType: "text/plain", Size: 1, PartPath: "3", Data: []byte("b")},
+		{Filename: "notes\u00a0v2.txt", ContentType: "text/plain", Size: 1, PartPath: "4", Data: []byte("c")}, // 不换行空格
+	}
+	data, ct, err := NewSender(cfg).encodeBody(Payload{AttachmentsDetail: NewAttachmentDetails(atts)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), `\u`) || strings.Contains(string(data), `\x`) {
+		t.Fatalf("go-style escapes in body: %s", data)
+	}
+	_, params, _ := mime.ParseMediaType(ct)
+	mr := multipart.NewReader(strings.NewReader(string(data)), params["boundary"])
+	var names []string
+	for {
+		p, err := mr.NextPart()
+		if err != nil {
+			break
+		}
+		if p.FormName() != "payload" {
+			names = append(names, p.FileName())
+		}
+	}
+	if len(names) != 3 || names[0] != "发票 2024.pdf" || names[1] != `say "hi".txt` || names[2] != "notes\u00a0v2.txt" {
+		t.Fatalf("filenames=%q", names)
+	}
+}
+
+func TestStoreAttachmentDelivery(t *testing.T) {
+	st, err := storage.NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := &config.Config{AttachmentDelivery: "store", AttachmentDenyTypes: "application/octet-stream"}
+	s := NewSender(cfg)
+	s.UseStore(st, storage.NewSigner("k", "https://files.example.com", time.Hour))
+	data, _, err := s.encodeBody(Payload{AttachmentsDetail: NewAttachmentDetails(testAttachments())})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got Payload
+	_ = json.Unmarshal(data, &got)
+	d := got.AttachmentsDetail
+	key := storage.ContentKey([]byte("%PDF"))
+	if d[0].Delivery != "store" || d[0].StorageKey != key || d[0].SHA256 != "" || !strings.HasPrefix(d[0].URL, "https://files.example.com/attachments/"+key+"?") || d[0].URLExpires == 0 {
+		t.Errorf("pdf should be stored with signed url: %+v", d[0])
+	}
+	if d[0].ContentBase64 != "" {
+		t.Error("store mode must not inline content")
+	}
+	if d[1].Delivery != "skipped" {
+		t.Errorf("denied type should be skipped: %+v", d[1])
+	}
+	if _, err := st.Open(context.Background(), key); err != nil {
+		t.Errorf("stored object missing: %v", err)
+	}
+}
+
+// stubScanner 文件内容为 "MZ" 时报告感染，"ERR" 时扫描失败
+type stubScanner struct{}
+
+func (stubScanner) Scan(_ context.Context, r io.Reader) scanner.Verdict {
+	b, _ := io.ReadAll(r)
+	switch string(b) {
+	case "MZ":
+		return scanner.Verdict{Status: scanner.StatusInfected, Signature: "Win.Test"}
+	case "ERR":
+		return scanner.Verdict{Status: scanner.StatusError, Error: "timeout"}
+	}
+	return scanner.Verdict{Status: scanner.StatusClean}
+}
+
+func TestScanAttachmentsStrip(t *testing.T) {
+	atts := append(testAttachments(), parser.Attachment{Filename: "odd.bin", Size: 3, PartPath: "5", Data: []byte("ERR")})
+	details := NewAttachmentDetails(atts)
+	sum := ScanAttachments(context.Background(), stubScanner{}, details, "quarantine")
+	if sum.Scanned != 4 || sum.Errors != 1 || len(sum.Infected) != 1 || sum.Infected[0] != "setup.exe" || sum.Action != "strip" {
+		t.Fatalf("summary=%+v", sum)
+	}
+	if details[1].Scan.Signature != "Win.Test" || details[3].Scan.Status != scanner.StatusError {
+		t.Fatalf("verdicts=%+v %+v", details[1].Scan, details[3].Scan)
+	}
+
+	s := NewSender(&config.Config{AttachmentDelivery: "inline", ScanPolicy: "strip"})
+	data, _, err := s.encodeBody(Payload{AttachmentsDetail: details, Scan: sum})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got Payload
+	json.Unmarshal(data, &got)
+	d := got.AttachmentsDetail
+	if d[1].Delivery != "skipped" || d[1].SkipReason != skipInfected || d[1].ContentBase64 != "" {
+		t.Errorf("infected should be stripped: %+v", d[1])
+	}
+	if d[0].Delivery != "inline" {
+		t.Errorf("clean attachment should be delivered: %+v", d[0])
+	}
+	if d[3].Delivery != "skipped" || d[3].SkipReason != skipScanFailed || d[3].ContentBase64 != "" {
+		t.Errorf("scan error should not be delivered under strip: %+v", d[3])
+	}
+
+	// annotate 只标注不剥离
+	s = NewSender(&config.Config{AttachmentDelivery: "inline", ScanPolicy: "annotate"})
+	data, _, _ = s.encodeBody(Payload{AttachmentsDetail: details})
+	json.Unmarshal(data, &got)
+	if got.AttachmentsDetail[1].Delivery != "inline" || got.AttachmentsDetail[1].Scan.Status != scanner.StatusInfected {
+		t.Errorf("annotate: %+v", got.AttachmentsDetail[1])
+	}
+	if got.AttachmentsDetail[3].Delivery != "inline" {
+		t.Errorf("annotate should deliver scan errors: %+v", got.AttachmentsDetail[3])
+	}
+}
@@ -2,14 +2,17 @@ package webhook
 
 import (
 	"bytes"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
 	"strings"
 	"time"
 
+	"monitor-imap-webhook/internal/analysis"
 	"monitor-imap-webhook/internal/config"
+	"monitor-imap-webhook/internal/parser"
+	"monitor-imap-webhook/internal/scanner"
+	"monitor-imap-webhook/internal/storage"
 )
 
 type Payload struct {
@@ -18,27 +21,71 @@ type Payload struct {
 	From            string        `json:"from"`
 	Date            string        `json:"date"`
 	Body            string        `json:"body"`                 // 原始（已做 html->text 处理后的）纯文本
+	BodyNew         string        `json:"body_new,omitempty"`   // 仅新内容（剥离引用历史与签名，需 strip_quotes）
 	BodyLines       []string      `json:"body_lines,omitempty"` // 拆分后的行（去除多余空行）
 	Preview         string        `json:"preview"`              // 前 N 字符预览
 	WordCount       int           `json:"word_count"`
 	Mailbox         string        `json:"mailbox"`
 	Timestamp       int64         `json:"timestamp"`
-	RawHTML         string        `json:"raw_html,omitempty"` // 原始 HTML (可选)
-	Blocks          []interface{} `json:"blocks,omitempty"`   // 结构化 AST blocks (可选)
+	RawHTML         string        `json:"raw_html,omitempty"`      // 原始 HTML (可选)
+	BodyMarkdown    string        `json:"body_markdown,omitempty"` // HTML 正文的 markdown 版本 (html2text=markdown)
+	Blocks          []interface{} `json:"blocks,omitempty"`        // 结构化 AST blocks (可选)
 	HasAttachments  bool          `json:"has_attachments,omitempty"`
 	Attachments     []string      `json:"attachments,omitempty"`
 	AttachmentCount int           `json:"attachment_count,omitempty"`
+	// 附件详细元数据：MIME 类型、大小、disposition、content-id、part 编号、charset、sha256 及投递结果
+	AttachmentsDetail []AttachmentDetail `json:"attachments_detail,omitempty"`
+	BodyCharset       string             `json:"body_charset,omitempty"`     // 正文原始字符集（已转 UTF-8）
+	CharsetDetected   bool               `json:"charset_detected,omitempty"` // 字符集为探测所得（声明缺失/错误）
+	// 信封与头部信息（地址均已解码为 name + address）
+	FromAddress    *parser.Address         `json:"from_address,omitempty"`
+	To             []parser.Address        `json:"to,omitempty"`
+	Cc             []parser.Address        `json:"cc,omitempty"`
+	ReplyTo        []parser.Address        `json:"reply_to,omitempty"`
+	Sender         *parser.Address         `json:"sender,omitempty"`
+	MessageID      string                  `json:"message_id,omitempty"`
+	InReplyTo      string                  `json:"in_reply_to,omitempty"`
+	References     []string                `json:"references,omitempty"`
+	ListID         string                  `json:"list_id,omitempty"`
+	ReturnPath     string                  `json:"return_path,omitempty"`
+	InternalDate   string                  `json:"internal_date,omitempty"` // IMAP INTERNALDATE（RFC 3339）
+	Size           uint32                  `json:"size,omitempty"`          // IMAP RFC822.SIZE
+	Headers        map[string][]string     `json:"headers,omitempty"`       // include_headers 白名单头部（原样）
+	ThreadID       string                  `json:"thread_id,omitempty"`
+	ThreadSource   string                  `json:"thread_source,omitempty"` // gmail | imap_thread | references | in_reply_to | message_id | subject
+	IsReply        bool                    `json:"is_reply"`
+	IsForward      bool                    `json:"is_forward"`
+	Calendar       *parser.Calendar        `json:"calendar,omitempty"`        // 会议邀请（text/calendar VEVENT）
+	Bounce         *parser.Bounce          `json:"bounce,omitempty"`          // 退信 / 投递状态通知（DSN）
+	AutoMail       *parser.AutoMail        `json:"auto_mail,omitempty"`       // 自动回复 / 自动生成 / 群发 / 回环邮件的识别结果
+	Category       string                  `json:"category,omitempty"`        // 启发式分类：transactional | newsletter | notification | personal
+	Auth           *parser.Auth            `json:"auth,omitempty"`            // SPF / DKIM / DMARC / ARC 认证结论
+	Security       *parser.Security        `json:"security,omitempty"`        // S/MIME / PGP 签名与加密信息
+	Links          []parser.Link           `json:"links,omitempty"`           // 正文超链接
+	Unsubscribe    *parser.Unsubscribe     `json:"unsubscribe,omitempty"`     // List-Unsubscribe 退订信息
+	Extracted      map[string]any          `json:"extracted,omitempty"`       // extractors 规则的提取结果
+	StructuredData []parser.StructuredItem `json:"structured_data,omitempty"` // HTML 中的 schema.org JSON-LD / microdata 对象
+	Forwarded      []parser.Forwarded      `json:"forwarded,omitempty"`       // 转发的原始邮件（message/rfc822 附件与内联转发）
+	Scan           *scanner.Summary        `json:"scan,omitempty"`            // 附件病毒扫描汇总（配置 clamd_address 时）
+	Risk           *analysis.Risk          `json:"risk,omitempty"`            // 钓鱼 / 仿冒启发式分析（risk_analysis 启用时）
 }
 
 type Sender struct {
-	cfg *config.Config
-	hc  *http.Client
+	cfg    *config.Config
+	hc     *http.Client
+	store  storage.Store   // attachment_delivery=store 时使用
+	signer *storage.Signer // 下载链接签名
 }
 
 func NewSender(cfg *config.Config) *Sender {
 	return &Sender{cfg: cfg, hc: &http.Client{Timeout: 15 * time.Second}}
 }
 
+// UseStore 设置附件存储与下载链接签名器（attachment_delivery=store）。
+func (s *Sender) UseStore(st storage.Store, signer *storage.Signer) {
+	s.store, s.signer = st, signer
+}
+
 func (s *Sender) parseHeaders(raw string) http.Header {
 	h := http.Header{}
 	if raw == "" {
@@ -60,12 +107,15 @@ func (s *Sender) parseHeaders(raw string) http.Header {
 }
 
 func (s *Sender) SendWithRetry(p Payload) error {
-	data, _ := json.Marshal(p)
+	data, contentType, err := s.encodeBody(p)
+	if err != nil {
+		return fmt.Errorf("encode payload: %w", err)
+	}
 	headers := s.parseHeaders(s.cfg.WebhookHeader)
 	backoff := s.cfg.RetryBaseBackoff
 	for attempt := 0; attempt <= s.cfg.RetryMax; attempt++ {
 		req, _ := http.NewRequest("POST", s.cfg.WebhookURL, bytes.NewReader(data))
-		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Content-Type", contentType)
 		for k, vals := range headers {
 			for _, v := range vals {
 				req.Header.Add(k, v)
@@ -73,6 +123,7 @@ func (s *Sender) SendWithRetry(p Payload) error {
 		}
 		resp, err := s.hc.Do(req)
 		if err == nil && resp.StatusCode >= 200 && resp.StatusCode < 300 {
+			resp.Body.Close()
 			return nil
 		}
 		if resp != nil && resp.Body != nil {
@@ -95,7 +146,11 @@ func BuildPayload(msg *Payload, bodyLimit int) Payload {
 	out := *msg
 	// 先拆行，挑选第一条语义内容行作为 preview 来源
 	var semanticFirst string
-	for _, ln := range strings.Split(out.Body, "\n") {
+	previewSrc := out.Body
+	if strings.TrimSpace(out.BodyNew) != "" { // 启用 strip_quotes 时预览取新内容
+		previewSrc = out.BodyNew
+	}
+	for _, ln := range strings.Split(previewSrc, "\n") {
 		ln = strings.TrimSpace(ln)
 		if ln == "" {
 			continue
@@ -4,6 +4,8 @@ import (
 	"encoding/json"
 	"io"
 	"log"
+	"mime"
+	"mime/multipart"
 	"net/http"
 	"os"
 )
@@ -18,6 +20,8 @@ import (
 //	PORT=9090 PATH=/x-hook SAVE=1
 //
 // If SAVE=1 it will append pretty JSON into received.jsonl
+// multipart/form-data requests (attachment_delivery=multipart) are accepted too:
+// the "payload" field is treated as the JSON body and file parts are logged.
 func main() {
 	port := getenv("PORT", "8080")
 	path := getenv("PATH", "/mail")
@@ -26,7 +30,7 @@ func main() {
 
 	http.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
 		defer r.Body.Close()
-		body, _ := io.ReadAll(r.Body)
+		body := readBody(r)
 		var generic any
 		if err := json.Unmarshal(body, &generic); err != nil {
 			log.Printf("[receiver] invalid json: %v raw=%s", err, string(body))
@@ -52,6 +56,30 @@ func main() {
 	log.Fatal(http.ListenAndServe(":"+port, nil))
 }
 
+// readBody returns the JSON payload, unwrapping multipart/form-data uploads.
+func readBody(r *http.Request) []byte {
+	mt, params, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mt != "multipart/form-data" {
+		body, _ := io.ReadAll(r.Body)
+		return body
+	}
+	var payload []byte
+	mr := multipart.NewReader(r.Body, params["boundary"])
+	for {
+		p, err := mr.NextPart()
+		if err != nil {
+			break
+		}
+		data, _ := io.ReadAll(p)
+		if p.FormName() == "payload" {
+			payload = data
+			continue
+		}
+		log.Printf("[receiver] file field=%s name=%s type=%s size=%d", p.FormName(), p.FileName(), p.Header.Get("Content-Type"), len(data))
+	}
+	return payload
+}
+
 func getenv(k, def string) string {
 	v := os.Getenv(k)
 	if v == "" {